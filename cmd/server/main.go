@@ -2,20 +2,40 @@ package main
 
 import (
 	"Brocker-pet-project/internal/config"
+	"Brocker-pet-project/internal/fx"
 	"Brocker-pet-project/internal/handlers"
+	"Brocker-pet-project/internal/health"
 	"Brocker-pet-project/internal/logger"
+	"Brocker-pet-project/internal/metrics"
 	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/internal/repository/memory"
+	"Brocker-pet-project/internal/tracing"
 	worker2 "Brocker-pet-project/internal/worker"
 	"Brocker-pet-project/pkg/database"
+	"Brocker-pet-project/pkg/hasher"
+	"Brocker-pet-project/pkg/jwt"
 	"Brocker-pet-project/pkg/middleware"
+	"Brocker-pet-project/pkg/money"
 	"Brocker-pet-project/pkg/redis"
+	"Brocker-pet-project/pkg/requestlog"
+	"Brocker-pet-project/pkg/tokenstore"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 )
 
+const defaultShutdownTimeout = 10 * time.Second
+
 func main() {
 	fmt.Println("STARTED")
 
@@ -23,56 +43,340 @@ func main() {
 	if err != nil {
 		log.Fatalf("Error loading config: %v", err)
 	}
-	zaplog, err := logger.InitLogger(cfg)
+	zaplog, logLevel, err := logger.InitLogger(cfg)
 	if err != nil {
 		log.Fatalf("Error initializing logger: %v", err)
 	}
+	zap.ReplaceGlobals(zaplog)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		database.InitDB(cfg)
+		if err := database.WaitForDB(context.Background(), database.ReturnDB(), cfg.Postgres.ConnectTimeout); err != nil {
+			log.Fatalf("Error connecting to database: %v", err)
+		}
+		if err := Migrate(os.Args[2:]); err != nil {
+			log.Fatalf("Error running migrations: %v", err)
+		}
+		return
+	}
 
-	database.InitDB(cfg)
+	flushTraces, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Error initializing tracing: %v", err)
+	}
 
 	r := chi.NewRouter()
+	r.Use(requestlog.RequestID)
+	r.Use(metrics.HTTP)
+	r.Use(tracing.Route)
+	r.Use(requestlog.AccessLog(zaplog, tracing.LogFields))
 
 	redisClient := redis.NewRedisClient(cfg)
-	dealRepository := repository.NewDealRepository(database.ReturnDB(), redisClient)
-	userRepository := repository.NewUserRepository(database.ReturnDB())
-	profitRepository := repository.NewProfitRepository(database.ReturnDB())
 
-	profitHandler := handlers.NewProfitHandler(profitRepository, zaplog)
-	dealHandler := handlers.NewDealHandler(dealRepository, redisClient, zaplog)
-	userHandler := handlers.NewUserHandler(userRepository, zaplog)
+	stores, err := NewStores(cfg, redisClient, zaplog)
+	if err != nil {
+		log.Fatalf("Error opening storage: %v", err)
+	}
+	zaplog.Info("Storage opened", zap.String("backend", stores.Backend))
+
+	if cfg.Fx.RatesFile != "" {
+		rates, err := fx.LoadFile(cfg.Fx.RatesFile)
+		if err != nil {
+			log.Fatalf("Error loading fx rates: %v", err)
+		}
+		if err := stores.Fx.SaveRates(context.Background(), rates); err != nil {
+			log.Fatalf("Error saving fx rates: %v", err)
+		}
+		zaplog.Info("Fx rates loaded", zap.String("file", cfg.Fx.RatesFile), zap.Int("rates", len(rates)))
+	}
+
+	reportingCurrency := money.DefaultCurrency
+	if cfg.Fx.ReportingCurrency != "" {
+		reportingCurrency, err = money.ParseCurrency(cfg.Fx.ReportingCurrency)
+		if err != nil {
+			log.Fatalf("Error reading reporting currency %q: %v", cfg.Fx.ReportingCurrency, err)
+		}
+	}
+
+	profitHandler := handlers.NewProfitHandler(stores.Profit, redisClient, zaplog)
+	dealHandler := handlers.NewDealHandler(stores.Deals, redisClient, zaplog)
+	fxHandler := handlers.NewFxHandler(stores.Fx, zaplog)
+	logLevelHandler := handlers.NewLogLevelHandler(logLevel, zaplog)
+	tokenManager, err := jwt.NewManager(cfg.Jwt)
+	if err != nil {
+		log.Fatalf("Error loading jwt keys: %v", err)
+	}
 
-	r.Post("/api/registration", userHandler.NewUserPost)
-	r.Get("/api/login", userHandler.LoginIn)
+	tokenStore := tokenstore.New(context.Background(), redisClient, zaplog)
+	tokenHandler := handlers.NewTokenHandler(tokenManager, tokenStore, zaplog)
+	userHandler := handlers.NewUserHandler(stores.Users, tokenManager, zaplog)
+	authMiddleware := middleware.NewAuthMiddleware(tokenManager, tokenStore, cfg.Server.RequestTimeout)
+	adminMiddleware := middleware.NewAdminMiddleware(cfg.Admin.UserIds)
 
+	requestTimeout := middleware.Timeout(cfg.Server.RequestTimeout)
+
+	dealWorker := worker2.NewDealWorker(zaplog, stores.Deals, cfg.Worker, reportingCurrency)
+
+	checker, err := NewChecker(stores, redisClient, dealWorker)
+	if err != nil {
+		log.Fatalf("Error creating health checks: %v", err)
+	}
+
+	r.Handle("/metrics", metrics.Handler())
+	r.Get("/healthz", checker.Liveness)
+	r.Get("/readyz", checker.Readiness)
+
+	r.With(requestTimeout).Post("/api/registration", userHandler.NewUserPost)
+	r.With(requestTimeout).Get("/api/login", userHandler.LoginIn)
+	r.With(requestTimeout).Post("/api/token/refresh", tokenHandler.RefreshPost)
+
+	// Export and import stream bodies of any size, so they run without the
+	// request timeout; the token revocation lookup is still bounded by it.
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.AuthMiddleware)
+		r.Use(authMiddleware.Handler)
+
+		r.Get("/api/deals/export", dealHandler.DealsExportGet)
+		r.Post("/api/deals/import", dealHandler.DealsImportPost)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(requestTimeout)
+		r.Use(authMiddleware.Handler)
+
+		r.Post("/api/logout", tokenHandler.LogoutPost)
 
 		r.Post("/api/new_deal", dealHandler.NewDealPost)
 		r.Get("/api/all_deals", dealHandler.AllDealsGet)
+		r.Get("/api/deals", dealHandler.DealsGet)
+		r.Get("/api/deals/{id}", dealHandler.DealGet)
+		r.Patch("/api/deals/{id}", dealHandler.DealPatch)
+		r.Delete("/api/deals/{id}", dealHandler.DealDelete)
+		r.Post("/api/deals/{id}/submit", dealHandler.DealSubmitPost)
+		r.Post("/api/deals/{id}/cancel", dealHandler.DealCancelPost)
+		r.Get("/api/deals/{id}/history", dealHandler.DealHistoryGet)
 		r.Get("/api/all_processed_deals", dealHandler.AllProcessedDealsGet)
 		r.Get("/api/all_not_processed_deals", dealHandler.AllNotProcessedDealsGet)
 		r.Get("/api/all_clear_profit", profitHandler.AllClearProfitGET)
+		r.Get("/api/reports/profit/total", profitHandler.ProfitTotalGet)
+		r.Get("/api/reports/profit/periods", profitHandler.ProfitPeriodsGet)
+		r.Get("/api/reports/profit/top", profitHandler.ProfitTopGet)
+		r.Get("/api/reports/profit/losses", profitHandler.ProfitLossesGet)
+		r.Get("/api/fx_rates", fxHandler.FxRatesGet)
+
+		r.With(adminMiddleware.Handler).Post("/api/admin/fx_rates", fxHandler.FxRatesPost)
+		r.With(adminMiddleware.Handler).Get("/api/admin/log_level", logLevelHandler.LogLevelGet)
+		r.With(adminMiddleware.Handler).Put("/api/admin/log_level", logLevelHandler.LogLevelPut)
 	})
 
-	dealWorker := worker2.NewDealWorker(zaplog, dealRepository, profitRepository)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	go Worker(dealWorker)
+	workerDone := make(chan struct{})
+
+	go func() {
+		defer close(workerDone)
+		dealWorker.Run(ctx)
+	}()
+
+	server := &http.Server{Addr: cfg.Server.Port, Handler: tracing.Handler(r)}
+	serverErr := make(chan error, 1)
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
 
 	zaplog.Info("Program started")
 
-	if err := http.ListenAndServe(cfg.Server.Port, r); err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	select {
+	case <-ctx.Done():
+		zaplog.Info("Shutdown signal received")
+	case err := <-serverErr:
+		zaplog.Error("Error starting server", zap.Error(err))
+	}
+
+	// Stop the worker even when the server failed on its own.
+	stop()
+
+	Shutdown(cfg.Server.ShutdownTimeout, server, workerDone, redisClient, flushTraces, zaplog)
+
+	zaplog.Info("Program stopped")
+}
+
+// Stores are the storage backend the server runs on.
+type Stores struct {
+	Backend string
+	Deals   repository.DealStore
+	Users   repository.UserStore
+	Profit  repository.ProfitStore
+	Fx      repository.FxStore
+}
+
+// NewStores opens the storage backend selected by cfg.Storage.Backend. The
+// Postgres backend connects to the database and applies migrations when
+// AutoMigrate is set; the memory backend starts empty.
+func NewStores(cfg *config.Config, redisClient *goredis.Client, zaplog *zap.Logger) (*Stores, error) {
+	passwordHasher := hasher.NewHasher(cfg.Hasher.Cost)
+
+	switch cfg.Storage.Backend {
+	case "", config.StoragePostgres:
+		database.InitDB(cfg)
+		if err := database.WaitForDB(context.Background(), database.ReturnDB(), cfg.Postgres.ConnectTimeout); err != nil {
+			return nil, err
+		}
+
+		if cfg.Postgres.AutoMigrate {
+			migrator, err := database.NewMigrator(database.ReturnDB())
+			if err != nil {
+				return nil, fmt.Errorf("loading migrations: %w", err)
+			}
+			if _, err := migrator.Up(context.Background()); err != nil {
+				return nil, fmt.Errorf("applying migrations: %w", err)
+			}
+		}
+
+		db := database.ReturnDB()
+		if err := metrics.RegisterDB(db); err != nil {
+			return nil, fmt.Errorf("registering database metrics: %w", err)
+		}
+
+		return &Stores{
+			Backend: config.StoragePostgres,
+			Deals:   repository.NewDealRepository(db, redisClient),
+			Users:   repository.NewUserRepository(db, passwordHasher, zaplog),
+			Profit:  repository.NewProfitRepository(db),
+			Fx:      repository.NewFxRepository(db),
+		}, nil
+	case config.StorageMemory:
+		store := memory.New(redisClient, passwordHasher, zaplog)
+		return &Stores{Backend: config.StorageMemory, Deals: store, Users: store, Profit: store, Fx: store}, nil
+	}
+
+	return nil, fmt.Errorf("unknown storage backend %q (expected %s or %s)",
+		cfg.Storage.Backend, config.StoragePostgres, config.StorageMemory)
+}
+
+// NewChecker returns the readiness checks of the server: Redis, the deal
+// worker loop and, on the Postgres backend, the database and its
+// migrations.
+func NewChecker(stores *Stores, redisClient *goredis.Client, dealWorker *worker2.DealWorker) (*health.Checker, error) {
+	checker := health.NewChecker(health.DefaultTimeout)
+
+	if stores.Backend == config.StoragePostgres {
+		db := database.ReturnDB()
+		migrator, err := database.NewMigrator(db)
+		if err != nil {
+			return nil, fmt.Errorf("loading migrations: %w", err)
+		}
+
+		checker.Add("postgres", db.PingContext)
+		checker.Add("migrations", func(ctx context.Context) error {
+			pending, err := migrator.Pending(ctx)
+			if err != nil {
+				return err
+			}
+			if pending > 0 {
+				return fmt.Errorf("%d migration(s) not applied", pending)
+			}
+			return nil
+		})
 	}
 
+	checker.Add("redis", func(ctx context.Context) error {
+		return redisClient.Ping(ctx).Err()
+	})
+	checker.Add("worker", dealWorker.CheckHeartbeat)
+
+	return checker, nil
 }
 
-func Worker(dealWorker *worker2.DealWorker) {
-	res := true
+// Shutdown drains in-flight requests, waits for the current worker batch,
+// flushes pending spans and closes the database and Redis connections,
+// giving up on waiting once timeout has passed.
+func Shutdown(timeout time.Duration, server *http.Server, workerDone <-chan struct{}, redisClient *goredis.Client,
+	flushTraces func(context.Context) error, zaplog *zap.Logger) {
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	for res == true {
-		time.Sleep(3 * time.Second)
-		dealWorker.MarkAsProcessed()
+	if err := server.Shutdown(ctx); err != nil {
+		zaplog.Error("Error shutting down http server", zap.Error(err))
 	}
+
+	select {
+	case <-workerDone:
+	case <-ctx.Done():
+		zaplog.Warn("Deal worker did not stop before the shutdown deadline")
+	}
+
+	if err := flushTraces(ctx); err != nil {
+		zaplog.Error("Error flushing traces", zap.Error(err))
+	}
+
+	if err := redisClient.Close(); err != nil {
+		zaplog.Error("Error closing redis client", zap.Error(err))
+	}
+
+	if err := database.CloseDB(); err != nil {
+		zaplog.Error("Error closing database", zap.Error(err))
+	}
+}
+
+// Migrate handles "migrate up", "migrate down [steps]" and "migrate status".
+func Migrate(args []string) error {
+	migrator, err := database.NewMigrator(database.ReturnDB())
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		count, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migration(s)\n", count)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		count, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", count)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			if status.Applied {
+				fmt.Printf("%04d_%s\tapplied at %s\n", status.Version, status.Name, status.AppliedAt.Format(time.RFC3339))
+			} else {
+				fmt.Printf("%04d_%s\tpending\n", status.Version, status.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q (expected up, down or status)", command)
+	}
+
+	return nil
 }
 
 //TODO: CI/CD
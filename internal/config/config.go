@@ -10,27 +10,52 @@ type Config struct {
 	Env      string
 	Server   Server
 	Worker   Worker
+	Storage  Storage
 	Postgres Postgres
 	Redis    Redis
 	Jwt      Jwt
+	Hasher   Hasher
+	Fx       Fx
+	Admin    Admin
+	Tracing  Tracing
+	Log      Log
 }
 
 type Server struct {
-	Host string
-	Port string
+	Host            string
+	Port            string
+	ShutdownTimeout time.Duration // how long to wait for requests and the worker on shutdown
+	RequestTimeout  time.Duration // deadline of a request's database and Redis calls, 0 for none
 }
 
 type Worker struct {
-	ProcessedTimeOut time.Duration
+	ProcessedTimeOut time.Duration // poll interval
+	BatchSize        int           // deals processed per tick at most
+	Concurrency      int           // goroutines processing deals of one tick
+	Jitter           time.Duration // random delay added to every poll
+	MaxBackoff       time.Duration // poll interval limit while the database is failing
+	TickTimeout      time.Duration // deadline of the database calls of one tick
+}
+
+// Storage backends.
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory" // nothing is kept across restarts; Postgres is not needed
+)
+
+type Storage struct {
+	Backend string // StoragePostgres when empty
 }
 
 type Postgres struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
+	Host           string
+	Port           string
+	User           string
+	Password       string
+	DBName         string
+	SSLMode        string
+	AutoMigrate    bool
+	ConnectTimeout time.Duration // how long startup waits for Postgres to answer
 }
 
 type Redis struct {
@@ -38,7 +63,83 @@ type Redis struct {
 }
 
 type Jwt struct {
-	Token string
+	Token      string // HS256 secret used when Keys is empty
+	Issuer     string
+	Audience   string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	SigningKey string // kid of the key that signs new tokens
+	Keys       []JwtKey
+}
+
+// JwtKey is one signing or verification key. Keys that are being retired
+// stay listed so tokens they signed remain valid until they expire.
+type JwtKey struct {
+	Kid            string
+	Algorithm      string // HS256, RS256 or EdDSA
+	Secret         string // HS256 only
+	PrivateKeyFile string // PEM, RS256 and EdDSA
+	PublicKeyFile  string // PEM, optional when PrivateKeyFile is set
+}
+
+type Hasher struct {
+	Cost int
+}
+
+type Fx struct {
+	ReportingCurrency string // ISO 4217 code clear profit is also booked in
+	RatesFile         string // .csv or .json rates stored on startup, optional
+}
+
+type Admin struct {
+	UserIds []int64 // users allowed to call the admin endpoints
+}
+
+// Tracing exporters.
+const (
+	TracingNone   = "none"
+	TracingStdout = "stdout" // spans are printed as JSON, for local debugging
+	TracingOTLP   = "otlp"   // spans are sent to a collector over OTLP/HTTP
+)
+
+type Tracing struct {
+	Exporter    string  // TracingNone when empty
+	Endpoint    string  // host:port of the OTLP collector
+	Insecure    bool    // send OTLP over plain HTTP
+	ServiceName string  // "broker" when empty
+	SampleRatio float64 // share of new traces recorded, 0 records all
+}
+
+// Log encodings.
+const (
+	LogJSON    = "json"
+	LogConsole = "console"
+)
+
+type Log struct {
+	Level       string   // debug, info, warn or error; by Env when empty
+	Encoding    string   // LogJSON or LogConsole; by Env when empty
+	OutputPaths []string // "stderr", "stdout" or file paths; ["stderr"] when empty and File.Path is not set
+	File        LogFile
+	Sampling    LogSampling
+}
+
+// LogFile is a log file rotated by size. Rotated files are kept until
+// either limit is reached.
+type LogFile struct {
+	Path       string // no rotated file when empty
+	MaxSizeMB  int    // size that triggers rotation, 100 when 0
+	MaxAgeDays int    // 0 keeps rotated files regardless of age
+	MaxBackups int    // 0 keeps every rotated file
+	Compress   bool   // gzip rotated files
+}
+
+// LogSampling caps repeated entries: of the entries with the same level
+// and message logged within a second, the first Initial are written and
+// then every Thereafter-th.
+type LogSampling struct {
+	Initial    int // by Env when 0 (100/100 in prod, none otherwise), no sampling when negative
+	Thereafter int // must be positive when Initial is
 }
 
 func ConfigLoader(configName string) (*Config, error) {
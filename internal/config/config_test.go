@@ -16,8 +16,15 @@ env: "test"
 server:
   host: "localhost"
   port: "8080"
+  shutdowntimeout: 20s
 worker:
   processedTimeOut: 10s
+  batchsize: 50
+  concurrency: 4
+  jitter: 500ms
+  maxbackoff: 1m
+storage:
+  backend: "memory"
 postgres:
   host: "db.localhost"
   port: "5432"
@@ -29,6 +36,29 @@ redis:
   address: "redis.localhost:6379"
 jwt:
   token: "testtoken"
+fx:
+  reportingcurrency: "EUR"
+  ratesfile: "rates.csv"
+admin:
+  userids: [1, 2]
+tracing:
+  exporter: "otlp"
+  endpoint: "localhost:4318"
+  insecure: true
+  sampleratio: 0.5
+log:
+  level: "warn"
+  encoding: "json"
+  outputpaths: ["stdout"]
+  file:
+    path: "logs/broker.log"
+    maxsizemb: 50
+    maxagedays: 7
+    maxbackups: 3
+    compress: true
+  sampling:
+    initial: 100
+    thereafter: 10
 `
 
 	tmpDir := t.TempDir()
@@ -49,11 +79,19 @@ jwt:
 			want: &Config{
 				Env: "test",
 				Server: Server{
-					Host: "localhost",
-					Port: "8080",
+					Host:            "localhost",
+					Port:            "8080",
+					ShutdownTimeout: 20 * time.Second,
 				},
 				Worker: Worker{
 					ProcessedTimeOut: 10 * time.Second,
+					BatchSize:        50,
+					Concurrency:      4,
+					Jitter:           500 * time.Millisecond,
+					MaxBackoff:       time.Minute,
+				},
+				Storage: Storage{
+					Backend: StorageMemory,
 				},
 				Postgres: Postgres{
 					Host:     "db.localhost",
@@ -69,6 +107,35 @@ jwt:
 				Jwt: Jwt{
 					Token: "testtoken",
 				},
+				Fx: Fx{
+					ReportingCurrency: "EUR",
+					RatesFile:         "rates.csv",
+				},
+				Admin: Admin{
+					UserIds: []int64{1, 2},
+				},
+				Tracing: Tracing{
+					Exporter:    TracingOTLP,
+					Endpoint:    "localhost:4318",
+					Insecure:    true,
+					SampleRatio: 0.5,
+				},
+				Log: Log{
+					Level:       "warn",
+					Encoding:    LogJSON,
+					OutputPaths: []string{"stdout"},
+					File: LogFile{
+						Path:       "logs/broker.log",
+						MaxSizeMB:  50,
+						MaxAgeDays: 7,
+						MaxBackups: 3,
+						Compress:   true,
+					},
+					Sampling: LogSampling{
+						Initial:    100,
+						Thereafter: 10,
+					},
+				},
 			},
 			wantErr: false,
 		},
@@ -0,0 +1,160 @@
+package fx
+
+import (
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/pkg/money"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RateScale is the number of decimal places rates are stored with.
+const RateScale = 10
+
+// maxRate is the first value too large for the NUMERIC(24, 10) rate column.
+var maxRate = decimal.New(1, 24-RateScale)
+
+var (
+	ErrSamePair      = errors.New("base and quote currency are the same")
+	ErrRate          = errors.New("rate must be positive")
+	ErrRateTooLarge  = errors.New("rate is too large")
+	ErrEffectiveAt   = errors.New("missing effective_at")
+	ErrUnknownFormat = errors.New("rates file must be .csv or .json")
+)
+
+// Validate checks a rate and normalises its currency codes.
+func Validate(rate *models.FxRate) error {
+	base, err := money.ParseCurrency(rate.Base)
+	if err != nil {
+		return fmt.Errorf("base %q: %w", rate.Base, err)
+	}
+	quote, err := money.ParseCurrency(rate.Quote)
+	if err != nil {
+		return fmt.Errorf("quote %q: %w", rate.Quote, err)
+	}
+	if base == quote {
+		return ErrSamePair
+	}
+	value, err := NormalizeRate(rate.Rate)
+	if err != nil {
+		return err
+	}
+	if rate.EffectiveAt.IsZero() {
+		return ErrEffectiveAt
+	}
+
+	rate.Base, rate.Quote, rate.Rate = base, quote, value
+
+	return nil
+}
+
+// NormalizeRate rounds rate to RateScale and checks that the result can be
+// stored. It is checked as stored because a rate below the scale rounds to
+// zero.
+func NormalizeRate(rate decimal.Decimal) (decimal.Decimal, error) {
+	rate = rate.Round(RateScale)
+	if !rate.IsPositive() {
+		return rate, ErrRate
+	}
+	if rate.GreaterThanOrEqual(maxRate) {
+		return rate, ErrRateTooLarge
+	}
+	return rate, nil
+}
+
+// Convert returns amount multiplied by rate, rounded to money.Scale.
+func Convert(amount, rate decimal.Decimal) decimal.Decimal {
+	return amount.Mul(rate).Round(money.Scale)
+}
+
+// Invert returns the rate of the reverse pair.
+func Invert(rate decimal.Decimal) decimal.Decimal {
+	return decimal.NewFromInt(1).DivRound(rate, RateScale)
+}
+
+// LoadFile reads rates from a .json file holding an array of models.FxRate
+// or a .csv file with a base,quote,rate,effective_at header. effective_at is
+// RFC 3339 or a plain date taken as midnight UTC.
+func LoadFile(path string) ([]models.FxRate, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rates []models.FxRate
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.NewDecoder(file).Decode(&rates)
+	case ".csv":
+		rates, err = readCSV(file)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i := range rates {
+		if err := Validate(&rates[i]); err != nil {
+			return nil, fmt.Errorf("%s: rate %d: %w", path, i+1, err)
+		}
+	}
+
+	return rates, nil
+}
+
+func readCSV(r io.Reader) ([]models.FxRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if strings.Join(header, ",") != "base,quote,rate,effective_at" {
+		return nil, fmt.Errorf("unexpected header %q", strings.Join(header, ","))
+	}
+
+	var rates []models.FxRate
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rates, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		rate, err := decimal.NewFromString(record[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rate %q", line, record[2])
+		}
+
+		effectiveAt, err := parseTime(record[3])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid effective_at %q", line, record[3])
+		}
+
+		rates = append(rates, models.FxRate{Base: record[0], Quote: record[1], Rate: rate, EffectiveAt: effectiveAt})
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
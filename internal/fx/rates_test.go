@@ -0,0 +1,106 @@
+package fx
+
+import (
+	"Brocker-pet-project/internal/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadFile_CSV(t *testing.T) {
+	path := writeFile(t, "rates.csv", "base,quote,rate,effective_at\n"+
+		"eur,USD,1.0850,2025-01-01\n"+
+		"GBP,USD,1.27,2025-01-02T10:00:00Z\n")
+
+	rates, err := LoadFile(path)
+	require.NoError(t, err)
+	require.Len(t, rates, 2)
+
+	assert.Equal(t, "EUR", rates[0].Base)
+	assert.Equal(t, "USD", rates[0].Quote)
+	assert.True(t, rates[0].Rate.Equal(decimal.RequireFromString("1.085")))
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), rates[0].EffectiveAt)
+	assert.Equal(t, time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC), rates[1].EffectiveAt)
+}
+
+func TestLoadFile_JSON(t *testing.T) {
+	path := writeFile(t, "rates.json", `[{"base": "EUR", "quote": "USD", "rate": "1.085", "effective_at": "2025-01-01T00:00:00Z"}]`)
+
+	rates, err := LoadFile(path)
+	require.NoError(t, err)
+	require.Len(t, rates, 1)
+	assert.Equal(t, "EUR", rates[0].Base)
+}
+
+func TestLoadFile_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"unknown format", "rates.txt", ""},
+		{"bad header", "rates.csv", "from,to,rate,at\n"},
+		{"bad rate", "rates.csv", "base,quote,rate,effective_at\nEUR,USD,abc,2025-01-01\n"},
+		{"negative rate", "rates.csv", "base,quote,rate,effective_at\nEUR,USD,-1,2025-01-01\n"},
+		{"unknown currency", "rates.csv", "base,quote,rate,effective_at\nEUR,ABC,1,2025-01-01\n"},
+		{"same pair", "rates.json", `[{"base": "EUR", "quote": "eur", "rate": "1", "effective_at": "2025-01-01T00:00:00Z"}]`},
+		{"missing effective_at", "rates.json", `[{"base": "EUR", "quote": "USD", "rate": "1"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFile(writeFile(t, tt.file, tt.content))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestValidate_Rate(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     string
+		expected string
+		err      error
+	}{
+		{name: "rounded to the rate scale", rate: "1.08500000004", expected: "1.085"},
+		{name: "smallest stored rate", rate: "0.00000000005", expected: "0.0000000001"},
+		{name: "rounds to zero", rate: "0.00000000001", err: ErrRate},
+		{name: "negative", rate: "-1", err: ErrRate},
+		{name: "largest stored rate", rate: "99999999999999.9999999999", expected: "99999999999999.9999999999"},
+		{name: "too large", rate: "100000000000000", err: ErrRateTooLarge},
+		// Округление может перейти границу столбца
+		{name: "rounds up to too large", rate: "99999999999999.99999999999", err: ErrRateTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate := models.FxRate{Base: "EUR", Quote: "USD", Rate: decimal.RequireFromString(tt.rate), EffectiveAt: time.Now()}
+
+			err := Validate(&rate)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, rate.Rate.String())
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rate := models.FxRate{Rate: decimal.RequireFromString("1.0850")}
+
+	// 100.05 * 1.085 = 108.55425, округляется до четырёх знаков
+	assert.Equal(t, "108.5543", Convert(decimal.RequireFromString("100.05"), rate.Rate).String())
+	assert.Equal(t, "0.9216589862", Invert(rate.Rate).String())
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"Brocker-pet-project/pkg/apierror"
+	"Brocker-pet-project/pkg/middleware"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// requestUserID returns the id of the authenticated caller, writing a 401
+// response when the request did not pass through AuthMiddleware.
+func requestUserID(w http.ResponseWriter, r *http.Request, log *zap.Logger) (int64, bool) {
+	userId, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		log.Error("Missing user id in request context")
+		apierror.Write(w, r, http.StatusUnauthorized, "Unauthorized")
+		return 0, false
+	}
+	return userId, true
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/pkg/apierror"
+	"Brocker-pet-project/pkg/requestlog"
+	"Brocker-pet-project/pkg/xlsx"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dealExportHeader names the columns of CSV and XLSX exports.
+var dealExportHeader = []string{"id", "title", "status", "currency", "expenses", "profit", "created_at",
+	"clear_profit", "reporting_profit", "reporting_currency", "fx_rate", "booked_at"}
+
+// dealExportNumeric marks the dealExportHeader columns written as numbers to XLSX.
+var dealExportNumeric = map[int]bool{0: true, 4: true, 5: true, 7: true, 8: true, 10: true}
+
+// dealExporter writes deals in one export format.
+type dealExporter interface {
+	Write(deal models.DealExport) error
+	Close() error
+}
+
+// dealExportFormats maps the format query parameter to its content type,
+// file extension and exporter.
+var dealExportFormats = map[string]struct {
+	contentType string
+	extension   string
+	exporter    func(w io.Writer) (dealExporter, error)
+}{
+	"csv":   {"text/csv; charset=utf-8", "csv", newCSVDealExporter},
+	"jsonl": {"application/x-ndjson", "jsonl", newJSONLDealExporter},
+	"xlsx":  {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx", newXLSXDealExporter},
+}
+
+// DealsExportGet streams every deal matching the DealsGet filters, with its
+// booked clear profit, as csv (default), jsonl or xlsx. limit and cursor are
+// ignored.
+func (h *DealHandler) DealsExportGet(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	name := query.Get("format")
+	if name == "" {
+		name = "csv"
+	}
+	format, ok := dealExportFormats[name]
+	if !ok {
+		apierror.Write(w, r, http.StatusBadRequest, "format must be csv, xlsx or jsonl")
+		return
+	}
+
+	filter, err := parseDealFilter(query)
+	if err != nil {
+		log.Error("Invalid deal filter", zap.Error(err))
+		apierror.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The response starts with the first row, so an error raised by the
+	// query itself can still be reported with a proper status.
+	var exporter dealExporter
+	start := func() error {
+		w.Header().Set("content-type", format.contentType)
+		w.Header().Set("content-disposition", `attachment; filename="deals.`+format.extension+`"`)
+		var err error
+		exporter, err = format.exporter(w)
+		return err
+	}
+
+	rows := 0
+	err = h.repo.ExportDeals(r.Context(), userId, filter, func(deal models.DealExport) error {
+		if exporter == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		rows++
+		return exporter.Write(deal)
+	})
+	if err == nil && exporter == nil {
+		err = start()
+	}
+	if err == nil {
+		err = exporter.Close()
+	}
+
+	if err != nil {
+		if exporter == nil {
+			if errors.Is(err, repository.ErrInvalidSort) {
+				apierror.Write(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			writeRepositoryError(w, r, log, "Error exporting deals", err)
+			return
+		}
+
+		// Part of the file is already sent; abort the response so the
+		// client does not take it for a complete export.
+		log.Error("Error exporting deals", zap.Error(err), zap.Int("rows", rows))
+		panic(http.ErrAbortHandler)
+	}
+
+	log.Debug("Export deals request successfully handled", zap.String("format", name), zap.Int("deals", rows))
+}
+
+// dealExportRecord returns the dealExportHeader columns of deal; columns
+// without a value are empty.
+func dealExportRecord(deal models.DealExport) []string {
+	record := []string{
+		strconv.FormatInt(deal.Id, 10),
+		spreadsheetText(deal.Title),
+		deal.Status,
+		deal.Currency,
+		deal.Expenses.String(),
+		deal.Profit.String(),
+		deal.CreatedAt.UTC().Format(time.RFC3339),
+		"", "", "", "", "",
+	}
+
+	if deal.ClearProfit != nil {
+		record[7] = deal.ClearProfit.String()
+	}
+	if deal.ReportingProfit != nil {
+		record[8] = deal.ReportingProfit.String()
+	}
+	if deal.ReportingCurrency != nil {
+		record[9] = *deal.ReportingCurrency
+	}
+	if deal.FxRate != nil {
+		record[10] = deal.FxRate.String()
+	}
+	if deal.BookedAt != nil {
+		record[11] = deal.BookedAt.UTC().Format(time.RFC3339)
+	}
+
+	return record
+}
+
+// spreadsheetText keeps user text from being read as a formula by
+// spreadsheet tools: text starting with a formula trigger is prefixed with
+// a quote.
+func spreadsheetText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+type csvDealExporter struct {
+	w *csv.Writer
+}
+
+func newCSVDealExporter(w io.Writer) (dealExporter, error) {
+	e := &csvDealExporter{w: csv.NewWriter(w)}
+	return e, e.w.Write(dealExportHeader)
+}
+
+func (e *csvDealExporter) Write(deal models.DealExport) error {
+	return e.w.Write(dealExportRecord(deal))
+}
+
+func (e *csvDealExporter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonlDealExporter struct {
+	enc *json.Encoder
+}
+
+func newJSONLDealExporter(w io.Writer) (dealExporter, error) {
+	return &jsonlDealExporter{enc: json.NewEncoder(w)}, nil
+}
+
+// Write encodes deal on a line of its own.
+func (e *jsonlDealExporter) Write(deal models.DealExport) error {
+	return e.enc.Encode(deal)
+}
+
+func (e *jsonlDealExporter) Close() error {
+	return nil
+}
+
+type xlsxDealExporter struct {
+	w *xlsx.Writer
+}
+
+func newXLSXDealExporter(w io.Writer) (dealExporter, error) {
+	xw, err := xlsx.NewWriter(w, "Deals")
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]xlsx.Cell, len(dealExportHeader))
+	for i, name := range dealExportHeader {
+		header[i] = xlsx.String(name)
+	}
+
+	return &xlsxDealExporter{w: xw}, xw.WriteRow(header...)
+}
+
+func (e *xlsxDealExporter) Write(deal models.DealExport) error {
+	record := dealExportRecord(deal)
+
+	cells := make([]xlsx.Cell, len(record))
+	for i, value := range record {
+		if dealExportNumeric[i] {
+			cells[i] = xlsx.Number(value)
+		} else {
+			cells[i] = xlsx.String(value)
+		}
+	}
+
+	return e.w.WriteRow(cells...)
+}
+
+func (e *xlsxDealExporter) Close() error {
+	return e.w.Close()
+}
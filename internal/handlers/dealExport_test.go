@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"Brocker-pet-project/internal/repository"
+	"archive/zip"
+	"bytes"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var dealExportColumns = []string{"id", "title", "expenses", "profit", "currency", "status", "user_id", "created_at",
+	"all_profit", "reporting_profit", "reporting_currency", "fx_rate", "booked_at"}
+
+func exportRows() *sqlmock.Rows {
+	createdAt := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	return sqlmock.NewRows(dealExportColumns).
+		AddRow(1, "Deal, 1", "100", "250", "EUR", "processed", 7, createdAt, "150", "162.75", "USD", "1.085", createdAt.Add(time.Minute)).
+		AddRow(2, "Deal 2", "10", "20", "USD", "draft", 7, createdAt, nil, nil, nil, nil, nil)
+}
+
+func TestDealHandler_DealsExportGet_CSV(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	dbMock.ExpectQuery(`FROM \(SELECT \* FROM transactions WHERE user_id=\$1 AND title ILIKE \$2\) AS t LEFT JOIN clear_profit c`).
+		WithArgs(int64(7), "%Deal%").
+		WillReturnRows(exportRows())
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/deals/export?title=Deal", nil), 7)
+	w := httptest.NewRecorder()
+
+	handler.DealsExportGet(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("content-type"))
+	assert.Equal(t, `attachment; filename="deals.csv"`, w.Header().Get("content-disposition"))
+	assert.Equal(t, strings.Join([]string{
+		"id,title,status,currency,expenses,profit,created_at,clear_profit,reporting_profit,reporting_currency,fx_rate,booked_at",
+		`1,"Deal, 1",processed,EUR,100,250,2025-01-10T12:00:00Z,150,162.75,USD,1.085,2025-01-10T12:01:00Z`,
+		"2,Deal 2,draft,USD,10,20,2025-01-10T12:00:00Z,,,,,",
+		"",
+	}, "\n"), w.Body.String())
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDealHandler_DealsExportGet_JSONL(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	dbMock.ExpectQuery(`FROM \(SELECT \* FROM transactions WHERE user_id=\$1\) AS t`).
+		WithArgs(int64(7)).
+		WillReturnRows(exportRows())
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/deals/export?format=jsonl", nil), 7)
+	w := httptest.NewRecorder()
+
+	handler.DealsExportGet(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("content-type"))
+
+	// Одна сделка на строку
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"reporting_profit":"162.75"`)
+	assert.Contains(t, lines[1], `"clear_profit":null`)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDealHandler_DealsExportGet_XLSX(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	dbMock.ExpectQuery(`FROM \(SELECT \* FROM transactions WHERE user_id=\$1\) AS t`).
+		WithArgs(int64(7)).
+		WillReturnRows(exportRows())
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/deals/export?format=xlsx", nil), 7)
+	w := httptest.NewRecorder()
+
+	handler.DealsExportGet(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `attachment; filename="deals.xlsx"`, w.Header().Get("content-disposition"))
+
+	r, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+
+	var sheet []byte
+	for _, f := range r.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			sheet, err = io.ReadAll(rc)
+			require.NoError(t, err)
+			rc.Close()
+		}
+	}
+
+	// Суммы пишутся числами, строка заголовка — первая
+	assert.Contains(t, string(sheet), `<c r="I2"><v>162.75</v></c>`)
+	assert.Contains(t, string(sheet), `<row r="3">`)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+// formulaRows returns deals whose titles a spreadsheet would run as formulas.
+func formulaRows() *sqlmock.Rows {
+	createdAt := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	return sqlmock.NewRows(dealExportColumns).
+		AddRow(1, `=HYPERLINK("http://evil","x")`, "10", "20", "USD", "draft", 7, createdAt, nil, nil, nil, nil, nil).
+		AddRow(2, "-2+3", "10", "20", "USD", "draft", 7, createdAt, nil, nil, nil, nil, nil).
+		AddRow(3, "a=b", "10", "20", "USD", "draft", 7, createdAt, nil, nil, nil, nil, nil)
+}
+
+func TestDealHandler_DealsExportGet_CSV_FormulaTitles(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	dbMock.ExpectQuery(`FROM \(SELECT \* FROM transactions WHERE user_id=\$1\) AS t`).
+		WithArgs(int64(7)).
+		WillReturnRows(formulaRows())
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/deals/export", nil), 7)
+	w := httptest.NewRecorder()
+
+	handler.DealsExportGet(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	require.Len(t, lines, 4)
+	// Заголовки, похожие на формулы, экранируются кавычкой
+	assert.True(t, strings.HasPrefix(lines[1], `1,"'=HYPERLINK(""http://evil"",""x"")",`))
+	assert.True(t, strings.HasPrefix(lines[2], "2,'-2+3,"))
+	assert.True(t, strings.HasPrefix(lines[3], "3,a=b,"))
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDealHandler_DealsExportGet_XLSX_FormulaTitles(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	dbMock.ExpectQuery(`FROM \(SELECT \* FROM transactions WHERE user_id=\$1\) AS t`).
+		WithArgs(int64(7)).
+		WillReturnRows(formulaRows())
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/deals/export?format=xlsx", nil), 7)
+	w := httptest.NewRecorder()
+
+	handler.DealsExportGet(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	sheet := readSheet(t, w.Body.Bytes())
+	assert.Contains(t, sheet, `<c r="B2" t="inlineStr"><is><t xml:space="preserve">&#39;=HYPERLINK(`)
+	assert.Contains(t, sheet, `<c r="B3" t="inlineStr"><is><t xml:space="preserve">&#39;-2+3</t>`)
+	assert.Contains(t, sheet, `<c r="B4" t="inlineStr"><is><t xml:space="preserve">a=b</t>`)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+// readSheet returns the worksheet XML of an XLSX file.
+func readSheet(t *testing.T, file []byte) string {
+	r, err := zip.NewReader(bytes.NewReader(file), int64(len(file)))
+	require.NoError(t, err)
+
+	for _, f := range r.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			defer rc.Close()
+			sheet, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			return string(sheet)
+		}
+	}
+
+	t.Fatal("sheet1.xml not found")
+	return ""
+}
+
+func TestDealHandler_DealsExportGet_BadRequest(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	for _, target := range []string{
+		"/api/deals/export?format=pdf",
+		"/api/deals/export?status=unknown",
+		"/api/deals/export?sort=status",
+	} {
+		req := asUser(httptest.NewRequest(http.MethodGet, target, nil), 7)
+		w := httptest.NewRecorder()
+
+		handler.DealsExportGet(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+		assert.Empty(t, w.Header().Get("content-disposition"), target)
+	}
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDealHandler_DealsExportGet_QueryError(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	dbMock.ExpectQuery(`FROM \(SELECT \* FROM transactions`).
+		WillReturnError(assert.AnError)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/deals/export", nil), 7)
+	w := httptest.NewRecorder()
+
+	handler.DealsExportGet(w, req)
+
+	// Ошибка до первой строки ещё может вернуть код ответа
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
@@ -1,167 +1,555 @@
 package handlers
 
 import (
+	"Brocker-pet-project/internal/metrics"
 	"Brocker-pet-project/internal/models"
 	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/internal/validation"
+	"Brocker-pet-project/pkg/apierror"
+	"Brocker-pet-project/pkg/money"
+	"Brocker-pet-project/pkg/requestlog"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
 	"github.com/redis/go-redis/v9"
+	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type DealHandler struct {
-	repo      *repository.DealRepository
+	repo      repository.DealStore
 	redisRepo *redis.Client
 	log       *zap.Logger
 }
 
-func NewDealHandler(repo *repository.DealRepository, redisRepo *redis.Client, log *zap.Logger) *DealHandler {
+func NewDealHandler(repo repository.DealStore, redisRepo *redis.Client, log *zap.Logger) *DealHandler {
 	return &DealHandler{repo: repo, redisRepo: redisRepo, log: log}
 }
 
 func (h *DealHandler) NewDealPost(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
 
 	if r.Method != http.MethodPost {
-		h.log.Error("Invalid request method", zap.String("excepted: ", http.MethodPost), zap.String("got: ", r.Method))
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		log.Error("Invalid request method", zap.String("expected", http.MethodPost), zap.String("got", r.Method))
+		apierror.Write(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if r.Header.Get("content-type") != "application/json" {
-		h.log.Error("Invalid content type", zap.String("excepted: ", "application/json"), zap.String("got: ", r.Header.Get("content-type")))
-		http.Error(w, "Invalid media type", http.StatusUnsupportedMediaType)
+		log.Error("Invalid content type", zap.String("expected", "application/json"), zap.String("got", r.Header.Get("content-type")))
+		apierror.Write(w, r, http.StatusUnsupportedMediaType, "Invalid media type")
+		return
+	}
+
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
 		return
 	}
 
 	var deal models.Deal
 
 	if err := json.NewDecoder(r.Body).Decode(&deal); err != nil {
-		h.log.Error("Error decoding deal", zap.Error(err))
-		http.Error(w, "Invalid server error", http.StatusInternalServerError)
+		log.Error("Error decoding deal", zap.Error(err))
+		apierror.Write(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	dealResponse := *h.repo.CreateNewDeal(deal.Title, deal.Expenses, deal.Profit)
+	if err := validation.NewDeal(&deal); err != nil {
+		log.Error("Invalid deal", zap.Error(err))
+		writeInvalid(w, r, err)
+		return
+	}
 
-	ctx := context.Background()
-	h.redisRepo.Del(ctx, "notProcessedDeals:all", "processedDeals:all", "allDeals:get")
+	createdDeal, err := h.repo.CreateNewDeal(r.Context(), userId, deal.Title, deal.Expenses, deal.Profit, deal.Currency, deal.Status)
+	if err != nil {
+		writeRepositoryError(w, r, log, "Error creating new deal", err)
+		return
+	}
+	dealResponse := *createdDeal
+
+	// The deal is stored even if the client has gone away.
+	h.redisRepo.Del(context.WithoutCancel(r.Context()), repository.DealCacheKeys(userId)...)
 
 	w.Header().Set("content-type", "application/json")
 	if err := json.NewEncoder(w).Encode(dealResponse); err != nil {
-		h.log.Error("Error encoding deal", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error("Error encoding deal", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	h.log.Debug("New deal post request successfully handled ", zap.Int64("deal id: ", dealResponse.Id))
+	log.Debug("New deal post request successfully handled ", zap.Int64("deal_id", dealResponse.Id))
 }
 
 func (h *DealHandler) AllProcessedDealsGet(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
 	if r.Method != http.MethodGet {
-		h.log.Error("Invalid request method", zap.String("excepted: ", http.MethodGet), zap.String("got: ", r.Method))
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		log.Error("Invalid request method", zap.String("expected", http.MethodGet), zap.String("got", r.Method))
+		apierror.Write(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	ctx := context.Background()
-	cacheKey := "processedDeals:all"
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	cacheKey := repository.ProcessedDealsCacheKey(userId)
 
 	cachedDeals, err := h.redisRepo.Get(ctx, cacheKey).Bytes()
+	metrics.CacheLookup("processedDeals:all", err)
 	if err == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write(cachedDeals)
-		h.log.Debug("Served by redis cache")
+		log.Debug("Served by redis cache")
 		return
 	}
 
-	var deals *[]models.Deal
-
-	deals = h.repo.GetAllProcessedDeals(r.Context())
+	deals, err := h.repo.GetAllProcessedDeals(ctx, userId)
+	if err != nil {
+		writeRepositoryError(w, r, log, "Error getting processed deals", err)
+		return
+	}
 
 	tasksJSON, _ := json.Marshal(deals)
 	h.redisRepo.Set(ctx, cacheKey, tasksJSON, 5*time.Minute)
 
 	w.Header().Set("content-type", "application/json")
 	if err := json.NewEncoder(w).Encode(deals); err != nil {
-		h.log.Error("Error encoding deals", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error("Error encoding deals", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	h.log.Debug("Get all processed deals GET request successfully handled")
+	log.Debug("Get all processed deals GET request successfully handled")
 
 }
 
 func (h *DealHandler) AllNotProcessedDealsGet(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
 	if r.Method != http.MethodGet {
-		h.log.Error("Invalid request method", zap.String("excepted: ", http.MethodGet), zap.String("got: ", r.Method))
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		log.Error("Invalid request method", zap.String("expected", http.MethodGet), zap.String("got", r.Method))
+		apierror.Write(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	ctx := context.Background()
-	cacheKey := "notProcessedDeals:all"
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	cacheKey := repository.NotProcessedDealsCacheKey(userId)
 
 	cachedDeals, err := h.redisRepo.Get(ctx, cacheKey).Bytes()
+	metrics.CacheLookup("notProcessedDeals:all", err)
 	if err == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write(cachedDeals)
-		h.log.Debug("Served by redis cache")
+		log.Debug("Served by redis cache")
 		return
 	}
 
-	var deals *[]models.Deal
-
-	deals = h.repo.GetAllNotProcessedDeals(r.Context())
+	deals, err := h.repo.GetAllNotProcessedDeals(ctx, userId)
+	if err != nil {
+		writeRepositoryError(w, r, log, "Error getting not processed deals", err)
+		return
+	}
 
 	tasksJSON, _ := json.Marshal(deals)
 	h.redisRepo.Set(ctx, cacheKey, tasksJSON, 5*time.Minute)
 
 	w.Header().Set("content-type", "application/json")
 	if err := json.NewEncoder(w).Encode(deals); err != nil {
-		h.log.Error("Error encoding deals", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error("Error encoding deals", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	h.log.Debug("Get all not processed deals GET request successfully handled")
+	log.Debug("Get all not processed deals GET request successfully handled")
 
 }
 
 func (h *DealHandler) AllDealsGet(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
 	if r.Method != http.MethodGet {
-		h.log.Error("Invalid request method", zap.String("excepted: ", http.MethodGet), zap.String("got: ", r.Method))
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		log.Error("Invalid request method", zap.String("expected", http.MethodGet), zap.String("got", r.Method))
+		apierror.Write(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
 		return
 	}
 
-	ctx := context.Background()
-	cacheKey := "allDeals:get"
+	ctx := r.Context()
+	cacheKey := repository.AllDealsCacheKey(userId)
 
 	cachedDeals, err := h.redisRepo.Get(ctx, cacheKey).Bytes()
+	metrics.CacheLookup("allDeals:get", err)
 	if err == nil {
 		w.Header().Set("content-type", "application/json")
 		w.Write(cachedDeals)
-		h.log.Debug("Served by redis cache")
+		log.Debug("Served by redis cache")
 		return
 	}
 
-	var deals *[]models.Deal
-
-	deals = h.repo.GetAllDeals(r.Context())
+	deals, err := h.repo.GetAllDeals(ctx, userId)
+	if err != nil {
+		writeRepositoryError(w, r, log, "Error getting deals", err)
+		return
+	}
 
 	tasksJSON, _ := json.Marshal(deals)
 	h.redisRepo.Set(ctx, cacheKey, tasksJSON, 5*time.Minute)
 
 	w.Header().Set("content-type", "application/json")
 	if err := json.NewEncoder(w).Encode(deals); err != nil {
-		h.log.Error("Error encoding deals", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error("Error encoding deals", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	log.Debug("Get all deals GET request successfully handled")
+
+}
+
+// dealId parses the {id} route parameter, writing a 400 response when it is
+// not a positive integer.
+func (h *DealHandler) dealId(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		log.Error("Invalid deal id", zap.String("got", chi.URLParam(r, "id")))
+		apierror.Write(w, r, http.StatusBadRequest, "Invalid deal id")
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *DealHandler) dealError(w http.ResponseWriter, r *http.Request, id int64, err error) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	switch {
+	case errors.Is(err, repository.ErrDealNotFound):
+		apierror.Write(w, r, http.StatusNotFound, "Deal not found")
+	case errors.Is(err, repository.ErrDealImmutable):
+		apierror.Write(w, r, http.StatusConflict, "Deal can no longer be changed")
+	case errors.Is(err, models.ErrInvalidTransition):
+		apierror.Write(w, r, http.StatusConflict, err.Error())
+	default:
+		writeRepositoryError(w, r, log.With(zap.Int64("deal_id", id)), "Error handling deal", err)
+	}
+}
+
+func (h *DealHandler) writeDeal(w http.ResponseWriter, r *http.Request, deal *models.Deal) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(deal); err != nil {
+		log.Error("Error encoding deal", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+func (h *DealHandler) DealGet(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
+		return
+	}
+
+	id, ok := h.dealId(w, r)
+	if !ok {
+		return
+	}
+
+	deal, err := h.repo.GetDealById(r.Context(), userId, id)
+	if err != nil {
+		h.dealError(w, r, id, err)
+		return
+	}
+
+	h.writeDeal(w, r, deal)
+
+	log.Debug("Get deal request successfully handled", zap.Int64("deal_id", id))
+}
+
+func (h *DealHandler) DealPatch(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	if r.Header.Get("content-type") != "application/json" {
+		log.Error("Invalid content type", zap.String("expected", "application/json"), zap.String("got", r.Header.Get("content-type")))
+		apierror.Write(w, r, http.StatusUnsupportedMediaType, "Invalid media type")
+		return
+	}
+
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
+		return
+	}
+
+	id, ok := h.dealId(w, r)
+	if !ok {
 		return
 	}
 
-	h.log.Debug("Get all deals GET request successfully handled")
+	var patch models.DealPatch
+
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		log.Error("Error decoding deal patch", zap.Error(err))
+		apierror.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if patch.Title == nil && patch.Expenses == nil && patch.Profit == nil && patch.Currency == nil {
+		apierror.Write(w, r, http.StatusBadRequest, "Nothing to update")
+		return
+	}
 
+	if err := validation.DealPatch(&patch); err != nil {
+		log.Error("Invalid deal patch", zap.Error(err))
+		writeInvalid(w, r, err)
+		return
+	}
+
+	deal, err := h.repo.UpdateDeal(r.Context(), userId, id, patch)
+	if err != nil {
+		h.dealError(w, r, id, err)
+		return
+	}
+
+	h.writeDeal(w, r, deal)
+
+	log.Debug("Patch deal request successfully handled", zap.Int64("deal_id", id))
+}
+
+// statusChangeRequest is the optional body of the status change endpoints.
+type statusChangeRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (h *DealHandler) changeStatus(w http.ResponseWriter, r *http.Request, to string) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
+		return
+	}
+
+	id, ok := h.dealId(w, r)
+	if !ok {
+		return
+	}
+
+	var req statusChangeRequest
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Error("Error decoding status change", zap.Error(err))
+			apierror.Write(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	deal, err := h.repo.ChangeDealStatus(r.Context(), userId, id, to, repository.UserActor(userId), req.Reason)
+	if err != nil {
+		h.dealError(w, r, id, err)
+		return
+	}
+
+	h.writeDeal(w, r, deal)
+
+	log.Debug("Deal status change request successfully handled", zap.Int64("deal_id", id), zap.String("status", to))
+}
+
+// DealSubmitPost queues a draft deal for processing.
+func (h *DealHandler) DealSubmitPost(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, models.StatusPending)
+}
+
+func (h *DealHandler) DealCancelPost(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, models.StatusCancelled)
+}
+
+func (h *DealHandler) DealHistoryGet(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
+		return
+	}
+
+	id, ok := h.dealId(w, r)
+	if !ok {
+		return
+	}
+
+	history, err := h.repo.GetDealHistory(r.Context(), userId, id)
+	if err != nil {
+		h.dealError(w, r, id, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		log.Error("Error encoding deal history", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	log.Debug("Get deal history request successfully handled", zap.Int64("deal_id", id))
+}
+
+func (h *DealHandler) DealDelete(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
+		return
+	}
+
+	id, ok := h.dealId(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.DeleteDeal(r.Context(), userId, id); err != nil {
+		h.dealError(w, r, id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	log.Debug("Delete deal request successfully handled", zap.Int64("deal_id", id))
+}
+
+// DealsGet lists the caller's deals a page at a time. Query parameters:
+// limit, cursor, status (repeatable or comma separated), title, min_expenses,
+// max_expenses, min_profit, max_profit, created_from, created_to (RFC 3339
+// or YYYY-MM-DD) and sort (id, created_at, title, expenses or profit, with a
+// "-" prefix for descending order).
+func (h *DealHandler) DealsGet(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
+		return
+	}
+
+	filter, err := parseDealFilter(r.URL.Query())
+	if err != nil {
+		log.Error("Invalid deal filter", zap.Error(err))
+		apierror.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.repo.ListDeals(r.Context(), userId, filter)
+	if errors.Is(err, repository.ErrInvalidCursor) || errors.Is(err, repository.ErrInvalidSort) {
+		apierror.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeRepositoryError(w, r, log, "Error listing deals", err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		log.Error("Error encoding deals", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	log.Debug("List deals request successfully handled", zap.Int("deals", len(page.Deals)))
+}
+
+func parseDealFilter(query url.Values) (models.DealFilter, error) {
+	filter := models.DealFilter{
+		Title:  query.Get("title"),
+		Sort:   query.Get("sort"),
+		Cursor: query.Get("cursor"),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return filter, fmt.Errorf("invalid limit %q", limit)
+		}
+		filter.Limit = n
+	}
+
+	for _, value := range query["status"] {
+		for _, status := range strings.Split(value, ",") {
+			if !models.IsValidStatus(status) {
+				return filter, fmt.Errorf("invalid status %q", status)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	amounts := []struct {
+		name  string
+		value **decimal.Decimal
+	}{
+		{"min_expenses", &filter.MinExpenses},
+		{"max_expenses", &filter.MaxExpenses},
+		{"min_profit", &filter.MinProfit},
+		{"max_profit", &filter.MaxProfit},
+	}
+	for _, amount := range amounts {
+		raw := query.Get(amount.name)
+		if raw == "" {
+			continue
+		}
+		n, err := money.Parse(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: %w", amount.name, err)
+		}
+		*amount.value = &n
+	}
+
+	dates := []struct {
+		name  string
+		value **time.Time
+	}{
+		{"created_from", &filter.CreatedFrom},
+		{"created_to", &filter.CreatedTo},
+	}
+	for _, date := range dates {
+		raw := query.Get(date.name)
+		if raw == "" {
+			continue
+		}
+		t, err := parseQueryTime(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s %q", date.name, raw)
+		}
+		*date.value = &t
+	}
+
+	return filter, nil
+}
+
+// parseQueryTime reads an RFC 3339 time or a YYYY-MM-DD date, which is
+// taken as midnight UTC.
+func parseQueryTime(raw string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, raw)
+	}
+	return t, err
 }
@@ -3,16 +3,23 @@ package handlers
 import (
 	"Brocker-pet-project/internal/models"
 	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/internal/repository/memory"
+	"Brocker-pet-project/pkg/middleware"
+	"Brocker-pet-project/pkg/requestlog"
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-redis/redismock/v9"
 	"github.com/redis/go-redis/v9"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -30,6 +37,11 @@ func setupMockRedis() (*redis.Client, redismock.ClientMock) {
 	return client, mock
 }
 
+// asUser attaches an authenticated user id the way AuthMiddleware does.
+func asUser(req *http.Request, userId int64) *http.Request {
+	return req.WithContext(middleware.WithUserID(req.Context(), userId))
+}
+
 func TestDealHandler_NewDealPost_Success(t *testing.T) {
 	// Setup
 	db, dbMock := setupMockDB(t)
@@ -44,28 +56,33 @@ func TestDealHandler_NewDealPost_Success(t *testing.T) {
 	// Test data
 	newDeal := models.Deal{
 		Title:    "Test Deal",
-		Expenses: 100,
-		Profit:   200,
+		Expenses: decimal.NewFromInt(100),
+		Profit:   decimal.NewFromInt(200),
 	}
 	expectedDeal := models.Deal{
 		Id:       1,
 		Title:    "Test Deal",
-		Expenses: 100,
-		Profit:   200,
-		Status:   "not processed",
+		Expenses: decimal.NewFromInt(100),
+		Profit:   decimal.NewFromInt(200),
+		Currency: "USD",
+		Status:   "pending",
+		UserId:   7,
 	}
 
 	// Mock expectations
+	dbMock.ExpectBegin()
 	dbMock.ExpectQuery(`INSERT INTO transactions`).
-		WithArgs(newDeal.Title, newDeal.Expenses, newDeal.Profit, "not processed").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "status"}).
-			AddRow(expectedDeal.Id, expectedDeal.Title, expectedDeal.Expenses, expectedDeal.Profit, expectedDeal.Status))
+		WithArgs(newDeal.Title, newDeal.Expenses, newDeal.Profit, "USD", "pending", int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}).
+			AddRow(expectedDeal.Id, expectedDeal.Title, expectedDeal.Expenses.String(), expectedDeal.Profit.String(), expectedDeal.Currency, expectedDeal.Status, expectedDeal.UserId))
+	dbMock.ExpectExec(`INSERT INTO deal_status_history`).WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
 
-	redisMock.ExpectDel("notProcessedDeals:all", "processedDeals:all", "allDeals:get").SetVal(1)
+	redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
 
 	// Create request
 	body, _ := json.Marshal(newDeal)
-	req := httptest.NewRequest(http.MethodPost, "/deals", bytes.NewReader(body))
+	req := asUser(httptest.NewRequest(http.MethodPost, "/deals", bytes.NewReader(body)), 7)
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -95,16 +112,16 @@ func TestDealHandler_AllProcessedDealsGet_Cached(t *testing.T) {
 
 	// Test data
 	cachedDeals := []models.Deal{
-		{Id: 1, Title: "Deal 1", Status: "processed"},
-		{Id: 2, Title: "Deal 2", Status: "processed"},
+		{Id: 1, Title: "Deal 1", Expenses: decimal.NewFromInt(100), Profit: decimal.RequireFromString("200.5"), Currency: "USD", Status: "processed"},
+		{Id: 2, Title: "Deal 2", Expenses: decimal.NewFromInt(150), Profit: decimal.NewFromInt(300), Currency: "USD", Status: "processed"},
 	}
 	cachedData, _ := json.Marshal(cachedDeals)
 
 	// Mock expectations
-	redisMock.ExpectGet("processedDeals:all").SetVal(string(cachedData))
+	redisMock.ExpectGet("processedDeals:all:7").SetVal(string(cachedData))
 
 	// Create request
-	req := httptest.NewRequest(http.MethodGet, "/deals/processed", nil)
+	req := asUser(httptest.NewRequest(http.MethodGet, "/deals/processed", nil), 7)
 	w := httptest.NewRecorder()
 
 	// Call handler
@@ -132,25 +149,25 @@ func TestDealHandler_AllNotProcessedDealsGet_NotCached(t *testing.T) {
 
 	// Test data
 	deals := []models.Deal{
-		{Id: 1, Title: "Deal 1", Status: "not processed"},
-		{Id: 2, Title: "Deal 2", Status: "not processed"},
+		{Id: 1, Title: "Deal 1", Expenses: decimal.NewFromInt(100), Profit: decimal.NewFromInt(200), Currency: "USD", Status: "pending", UserId: 7},
+		{Id: 2, Title: "Deal 2", Expenses: decimal.NewFromInt(150), Profit: decimal.NewFromInt(300), Currency: "USD", Status: "pending", UserId: 7},
 	}
 	expectedJSON, _ := json.Marshal(deals)
 
 	// Mock expectations
-	redisMock.ExpectGet("notProcessedDeals:all").RedisNil()
+	redisMock.ExpectGet("notProcessedDeals:all:7").RedisNil()
 
-	dbMock.ExpectQuery(`SELECT \* FROM transactions WHERE status=\$1`).
-		WithArgs("not processed").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "status"}).
-			AddRow(deals[0].Id, deals[0].Title, deals[0].Expenses, deals[0].Profit, deals[0].Status).
-			AddRow(deals[1].Id, deals[1].Title, deals[1].Expenses, deals[1].Profit, deals[1].Status))
+	dbMock.ExpectQuery(`SELECT (.+) FROM transactions WHERE user_id=\$1 AND status IN \(\$2, \$3, \$4\)`).
+		WithArgs(int64(7), "draft", "pending", "failed", repository.MaxDealPageSize+1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id", "sort_key"}).
+			AddRow(deals[0].Id, deals[0].Title, deals[0].Expenses.String(), deals[0].Profit.String(), deals[0].Currency, deals[0].Status, deals[0].UserId, "1").
+			AddRow(deals[1].Id, deals[1].Title, deals[1].Expenses.String(), deals[1].Profit.String(), deals[1].Currency, deals[1].Status, deals[1].UserId, "2"))
 
 	// Исправленная часть - используем точное значение JSON вместо mock.Anything
-	redisMock.ExpectSet("notProcessedDeals:all", expectedJSON, 5*time.Minute).SetVal("OK")
+	redisMock.ExpectSet("notProcessedDeals:all:7", expectedJSON, 5*time.Minute).SetVal("OK")
 
 	// Create request
-	req := httptest.NewRequest(http.MethodGet, "/deals/not-processed", nil)
+	req := asUser(httptest.NewRequest(http.MethodGet, "/deals/not-processed", nil), 7)
 	w := httptest.NewRecorder()
 
 	// Call handler
@@ -187,3 +204,365 @@ func TestDealHandler_AllDealsGet_WrongMethod(t *testing.T) {
 	// Verify
 	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
 }
+
+func TestDealHandler_AllDealsGet_Unauthenticated(t *testing.T) {
+	// Setup
+	db, _ := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, redisMock := setupMockRedis()
+	logger := zap.NewNop()
+
+	dealRepo := repository.NewDealRepository(db, redisClient)
+	handler := NewDealHandler(dealRepo, redisClient, logger)
+
+	// Request without user id in context
+	req := httptest.NewRequest(http.MethodGet, "/deals", nil)
+	w := httptest.NewRecorder()
+
+	// Call handler
+	handler.AllDealsGet(w, req)
+
+	// Verify
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+// withDealId routes the request through chi so {id} is populated.
+func withDealId(req *http.Request, id string) *http.Request {
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("id", id)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx))
+}
+
+func TestDealHandler_DealGet(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, _ := setupMockRedis()
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	dbMock.ExpectQuery(`SELECT (.+) FROM transactions WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(1), int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}).
+			AddRow(1, "Deal 1", 100, 200, "USD", "pending", 7))
+
+	req := withDealId(asUser(httptest.NewRequest(http.MethodGet, "/api/deals/1", nil), 7), "1")
+	w := httptest.NewRecorder()
+
+	handler.DealGet(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.Deal
+	json.NewDecoder(w.Body).Decode(&response)
+	assert.Equal(t, int64(1), response.Id)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+
+	// Некорректный id
+	w = httptest.NewRecorder()
+	handler.DealGet(w, withDealId(asUser(httptest.NewRequest(http.MethodGet, "/api/deals/abc", nil), 7), "abc"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDealHandler_DealPatch_Processed(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, redisMock := setupMockRedis()
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	dbMock.ExpectQuery(`UPDATE transactions`).WillReturnError(sql.ErrNoRows)
+	dbMock.ExpectQuery(`SELECT (.+) FROM transactions WHERE id=\$1 AND user_id=\$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}).
+			AddRow(1, "Deal 1", 100, 200, "USD", "processed", 7))
+
+	req := withDealId(asUser(httptest.NewRequest(http.MethodPatch, "/api/deals/1", strings.NewReader(`{"expenses": 150}`)), 7), "1")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.DealPatch(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+
+	// Пустой патч
+	req = withDealId(asUser(httptest.NewRequest(http.MethodPatch, "/api/deals/1", strings.NewReader(`{}`)), 7), "1")
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	handler.DealPatch(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDealHandler_DealDelete(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, redisMock := setupMockRedis()
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	dbMock.ExpectQuery(`DELETE FROM transactions`).
+		WithArgs(int64(1), int64(7), "processing", "processed").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}).
+			AddRow(1, "Deal 1", 100, 200, "USD", "pending", 7))
+	redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
+
+	req := withDealId(asUser(httptest.NewRequest(http.MethodDelete, "/api/deals/1", nil), 7), "1")
+	w := httptest.NewRecorder()
+
+	handler.DealDelete(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+
+	// Сделка другого пользователя
+	dbMock.ExpectQuery(`DELETE FROM transactions`).WillReturnError(sql.ErrNoRows)
+	dbMock.ExpectQuery(`SELECT (.+) FROM transactions WHERE id=\$1 AND user_id=\$2`).WillReturnError(sql.ErrNoRows)
+
+	w = httptest.NewRecorder()
+	handler.DealDelete(w, withDealId(asUser(httptest.NewRequest(http.MethodDelete, "/api/deals/1", nil), 8), "1"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDealHandler_NewDealPost_InvalidStatus(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, _ := setupMockRedis()
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/api/new_deal", strings.NewReader(`{"title": "Deal", "status": "processed"}`)), 7)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.NewDealPost(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDealHandler_NewDealPost_InvalidAmount(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, _ := setupMockRedis()
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	// Больше четырёх знаков после запятой округлять нельзя
+	req := asUser(httptest.NewRequest(http.MethodPost, "/api/new_deal", strings.NewReader(`{"title": "Deal", "expenses": "0.00001", "profit": 10}`)), 7)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.NewDealPost(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "expenses")
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+
+	// Неизвестная валюта
+	req = asUser(httptest.NewRequest(http.MethodPost, "/api/new_deal", strings.NewReader(`{"title": "Deal", "expenses": 1, "profit": 10, "currency": "ABC"}`)), 7)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+
+	handler.NewDealPost(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "currency")
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDealHandler_NewDealPost_ValidationEnvelope(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, _ := setupMockRedis()
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	// Ошибки всех полей возвращаются разом вместе с идентификатором запроса
+	req := asUser(httptest.NewRequest(http.MethodPost, "/api/new_deal", strings.NewReader(`{"title": "", "expenses": -5, "profit": 10}`)), 7)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestlog.Header, "req-1")
+	w := httptest.NewRecorder()
+
+	requestlog.RequestID(http.HandlerFunc(handler.NewDealPost)).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.JSONEq(t, `{"error": {
+		"code": "validation_failed",
+		"message": "Validation failed",
+		"fields": [
+			{"field": "title", "message": "must not be empty"},
+			{"field": "expenses", "message": "must not be negative"}
+		],
+		"request_id": "req-1"
+	}}`, w.Body.String())
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDealHandler_NewDealPost_MalformedJSON(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, _ := setupMockRedis()
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/api/new_deal", strings.NewReader(`{"title": `)), 7)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.NewDealPost(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"bad_request"`)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDealHandler_DealCancelPost_InvalidTransition(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, redisMock := setupMockRedis()
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery(`SELECT (.+) FROM transactions WHERE id=\$1 AND user_id=\$2 FOR UPDATE`).
+		WithArgs(int64(1), int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}).
+			AddRow(1, "Deal 1", 100, 200, "USD", "processed", 7))
+	dbMock.ExpectRollback()
+
+	req := withDealId(asUser(httptest.NewRequest(http.MethodPost, "/api/deals/1/cancel", strings.NewReader(`{"reason": "mistake"}`)), 7), "1")
+	w := httptest.NewRecorder()
+
+	handler.DealCancelPost(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestDealHandler_DealHistoryGet(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, _ := setupMockRedis()
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	dbMock.ExpectQuery(`SELECT (.+) FROM transactions WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(1), int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}).
+			AddRow(1, "Deal 1", 100, 200, "USD", "cancelled", 7))
+	dbMock.ExpectQuery(`SELECT (.+) FROM deal_status_history`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "deal_id", "from_status", "to_status", "actor", "reason", "created_at"}).
+			AddRow(1, 1, "", "pending", "user:7", "created", createdAt).
+			AddRow(2, 1, "pending", "cancelled", "user:7", "mistake", createdAt))
+
+	req := withDealId(asUser(httptest.NewRequest(http.MethodGet, "/api/deals/1/history", nil), 7), "1")
+	w := httptest.NewRecorder()
+
+	handler.DealHistoryGet(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+
+	var response []models.DealStatusChange
+	json.NewDecoder(w.Body).Decode(&response)
+	assert.Len(t, response, 2)
+	assert.Equal(t, "cancelled", response[1].ToStatus)
+	assert.Equal(t, "mistake", response[1].Reason)
+}
+
+func TestDealHandler_DealsGet(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, _ := setupMockRedis()
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	dbMock.ExpectQuery(`SELECT (.+) FROM transactions WHERE user_id=\$1 AND status IN \(\$2, \$3\) AND profit >= \$4 ORDER BY profit DESC, id DESC LIMIT \$5`).
+		WithArgs(int64(7), "pending", "processed", decimal.NewFromInt(100), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id", "sort_key"}).
+			AddRow(1, "Deal 1", 100, 200, "USD", "pending", 7, "200"))
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/deals?status=pending,processed&min_profit=100&sort=-profit&limit=1", nil), 7)
+	w := httptest.NewRecorder()
+
+	handler.DealsGet(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+
+	var response models.DealPage
+	json.NewDecoder(w.Body).Decode(&response)
+	assert.Len(t, response.Deals, 1)
+	assert.Empty(t, response.NextCursor)
+}
+
+func TestDealHandler_DealsGet_BadRequest(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, _ := setupMockRedis()
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	for _, query := range []string{
+		"limit=-1",
+		"status=unknown",
+		"min_expenses=abc",
+		"created_from=yesterday",
+		"sort=password",
+		"cursor=broken!",
+	} {
+		req := asUser(httptest.NewRequest(http.MethodGet, "/api/deals?"+query, nil), 7)
+		w := httptest.NewRecorder()
+
+		handler.DealsGet(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDealHandler_MemoryStore(t *testing.T) {
+	// Хранилище в памяти: без sqlmock и регулярных выражений SQL
+	redisClient, _ := setupMockRedis()
+	handler := NewDealHandler(memory.New(nil, nil, zap.NewNop()), redisClient, zap.NewNop())
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/api/new_deal",
+		strings.NewReader(`{"title": "Deal", "expenses": "100", "profit": "250", "status": "draft"}`)), 7)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.NewDealPost(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.DealSubmitPost(w, withDealId(asUser(httptest.NewRequest(http.MethodPost, "/api/deals/1/submit", nil), 7), "1"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"Status":"pending"`)
+
+	w = httptest.NewRecorder()
+	handler.DealCancelPost(w, withDealId(asUser(httptest.NewRequest(http.MethodPost, "/api/deals/1/cancel", nil), 7), "1"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Отменённую сделку нельзя снова отправить
+	w = httptest.NewRecorder()
+	handler.DealSubmitPost(w, withDealId(asUser(httptest.NewRequest(http.MethodPost, "/api/deals/1/submit", nil), 7), "1"))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.DealHistoryGet(w, withDealId(asUser(httptest.NewRequest(http.MethodGet, "/api/deals/1/history", nil), 7), "1"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var history []models.DealStatusChange
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Len(t, history, 3)
+
+	w = httptest.NewRecorder()
+	handler.DealGet(w, withDealId(asUser(httptest.NewRequest(http.MethodGet, "/api/deals/1", nil), 8), "1"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/internal/validation"
+	"Brocker-pet-project/pkg/apierror"
+	"Brocker-pet-project/pkg/money"
+	"Brocker-pet-project/pkg/requestlog"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxImportRows caps the deals a single import may contain.
+	MaxImportRows = 10000
+	// MaxImportSize caps the size of an uploaded import file in bytes.
+	MaxImportSize = 10 << 20
+)
+
+var (
+	errImportTooLarge = fmt.Errorf("import has more than %d rows", MaxImportRows)
+	errImportHeader   = errors.New("invalid csv header")
+)
+
+// importRow is a deal read from an import file, or the reason it could not
+// be read.
+type importRow struct {
+	line int
+	deal models.Deal
+	err  error
+}
+
+// DealsImportPost creates deals in bulk from a CSV (text/csv) or JSON lines
+// (application/x-ndjson) upload. CSV files start with a header naming the
+// title, expenses, profit and the optional currency and status columns.
+// Every row is validated; the valid ones are stored in one transaction and
+// the others are listed in the report by line. With dry_run=true nothing is
+// stored.
+func (h *DealHandler) DealsImportPost(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
+		return
+	}
+
+	dryRun := false
+	if raw := r.URL.Query().Get("dry_run"); raw != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(raw); err != nil {
+			apierror.Write(w, r, http.StatusBadRequest, fmt.Sprintf("invalid dry_run %q", raw))
+			return
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("content-type"))
+
+	var readRows func(io.Reader) ([]importRow, error)
+	switch mediaType {
+	case "text/csv":
+		readRows = readCSVImport
+	case "application/x-ndjson", "application/jsonl":
+		readRows = readJSONLImport
+	default:
+		log.Error("Invalid content type", zap.String("expected", "text/csv or application/x-ndjson"), zap.String("got", r.Header.Get("content-type")))
+		apierror.Write(w, r, http.StatusUnsupportedMediaType, "Invalid media type")
+		return
+	}
+
+	rows, err := readRows(http.MaxBytesReader(w, r.Body, MaxImportSize))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		apierror.Write(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("import is larger than %d bytes", MaxImportSize))
+		return
+	}
+	if err != nil {
+		log.Error("Error reading deal import", zap.Error(err))
+		apierror.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report := models.DealImportReport{DryRun: dryRun, Rows: len(rows), Ids: []int64{}, Errors: []models.DealImportError{}}
+	var deals []models.Deal
+
+	for _, row := range rows {
+		if row.err == nil {
+			row.err = validation.NewDeal(&row.deal)
+		}
+		if row.err != nil {
+			report.Errors = append(report.Errors, models.DealImportError{Row: row.line, Error: row.err.Error()})
+			continue
+		}
+		deals = append(deals, row.deal)
+	}
+
+	if !dryRun && len(deals) > 0 {
+		ids, err := h.repo.ImportDeals(r.Context(), userId, deals)
+		if err != nil {
+			writeRepositoryError(w, r, log, "Error importing deals", err)
+			return
+		}
+		report.Ids = ids
+		report.Created = len(ids)
+
+		h.redisRepo.Del(context.WithoutCancel(r.Context()), repository.DealCacheKeys(userId)...)
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Error("Error encoding import report", zap.Error(err))
+		return
+	}
+
+	log.Info("Deal import handled", zap.Int64("user_id", userId), zap.Bool("dry_run", dryRun),
+		zap.Int("rows", report.Rows), zap.Int("created", report.Created), zap.Int("rejected", len(report.Errors)))
+}
+
+// readCSVImport reads a CSV import. A record that cannot be read becomes a
+// row error; only a broken header or an oversized file fails the import.
+func readCSVImport(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: file is empty", errImportHeader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		// Spreadsheets often save CSV with a byte order mark.
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		switch name {
+		case "title", "expenses", "profit", "currency", "status":
+		default:
+			return nil, fmt.Errorf("%w: unknown column %q", errImportHeader, name)
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("%w: duplicate column %q", errImportHeader, name)
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"title", "expenses", "profit"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", errImportHeader, name)
+		}
+	}
+
+	var rows []importRow
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, importRow{line: parseErr.StartLine, err: parseErr.Err})
+		} else if err != nil {
+			return nil, err
+		} else {
+			line, _ := reader.FieldPos(0)
+			rows = append(rows, csvImportRow(line, record, header, columns))
+		}
+
+		if len(rows) > MaxImportRows {
+			return nil, errImportTooLarge
+		}
+	}
+}
+
+func csvImportRow(line int, record, header []string, columns map[string]int) importRow {
+	row := importRow{line: line}
+
+	if len(record) != len(header) {
+		row.err = fmt.Errorf("expected %d fields, got %d", len(header), len(record))
+		return row
+	}
+
+	row.deal.Title = record[columns["title"]]
+
+	var err error
+	if row.deal.Expenses, err = money.Parse(strings.TrimSpace(record[columns["expenses"]])); err != nil {
+		row.err = fmt.Errorf("expenses: %w", err)
+		return row
+	}
+	if row.deal.Profit, err = money.Parse(strings.TrimSpace(record[columns["profit"]])); err != nil {
+		row.err = fmt.Errorf("profit: %w", err)
+		return row
+	}
+
+	if i, ok := columns["currency"]; ok {
+		row.deal.Currency = strings.TrimSpace(record[i])
+	}
+	if i, ok := columns["status"]; ok {
+		row.deal.Status = strings.TrimSpace(record[i])
+	}
+
+	return row
+}
+
+// readJSONLImport reads one deal object per line; blank lines are skipped.
+func readJSONLImport(body io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxImportSize)
+
+	var rows []importRow
+
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		row := importRow{line: line}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row.deal); err != nil {
+			row.err = fmt.Errorf("invalid json: %w", err)
+		} else if decoder.More() {
+			row.err = errors.New("invalid json: more than one value on the line")
+		}
+
+		// Ids and owners are assigned on insert, never taken from the file.
+		row.deal.Id, row.deal.UserId = 0, 0
+
+		rows = append(rows, row)
+		if len(rows) > MaxImportRows {
+			return nil, errImportTooLarge
+		}
+	}
+
+	return rows, scanner.Err()
+}
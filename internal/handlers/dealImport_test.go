@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/internal/repository"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDealHandler_DealsImportPost_CSV(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+	redisClient, redisMock := setupMockRedis()
+
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	body := "\ufeffTitle,expenses,profit,currency\n" +
+		"Deal 1,100,250.5,eur\n" +
+		",10,20,USD\n" +
+		"Deal 3,-1,20,USD\n" +
+		"Deal 4,10,abc,USD\n" +
+		"Deal 5,10\n" +
+		"Deal 6,0,0,\n"
+
+	// Сохраняются только валидные строки, одной транзакцией
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery(`INSERT INTO transactions`).
+		WithArgs(int64(7), "user:7",
+			"Deal 1", decimal.NewFromInt(100), decimal.RequireFromString("250.5"), "EUR", "pending",
+			"Deal 6", decimal.Zero, decimal.Zero, "USD", "pending").
+		WillReturnRows(sqlmock.NewRows([]string{"deal_id"}).AddRow(1).AddRow(2))
+	dbMock.ExpectCommit()
+	redisMock.ExpectDel(repository.DealCacheKeys(7)...).SetVal(1)
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/api/deals/import", strings.NewReader(body)), 7)
+	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	w := httptest.NewRecorder()
+
+	handler.DealsImportPost(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var report models.DealImportReport
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.False(t, report.DryRun)
+	assert.Equal(t, 6, report.Rows)
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, []int64{1, 2}, report.Ids)
+
+	require.Len(t, report.Errors, 4)
+	assert.Equal(t, models.DealImportError{Row: 3, Error: "title: must not be empty"}, report.Errors[0])
+	assert.Equal(t, models.DealImportError{Row: 4, Error: "expenses: must not be negative"}, report.Errors[1])
+	assert.Equal(t, 5, report.Errors[2].Row)
+	assert.Contains(t, report.Errors[2].Error, "profit:")
+	assert.Equal(t, models.DealImportError{Row: 6, Error: "expected 4 fields, got 2"}, report.Errors[3])
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestDealHandler_DealsImportPost_JSONLDryRun(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+	redisClient, redisMock := setupMockRedis()
+
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	body := `{"title": "Deal 1", "expenses": "10", "profit": "20", "status": "draft"}` + "\n" +
+		"\n" +
+		`{"title": "Deal 2", "expenses": "10", "profit": "20", "status": "processed"}` + "\n" +
+		`{"title": "Deal 3", "expenses": 10, "profit": 20, "owner": 1}` + "\n" +
+		`{"title": "Deal 4",` + "\n"
+
+	// При dry_run база и кэш не трогаются
+	req := asUser(httptest.NewRequest(http.MethodPost, "/api/deals/import?dry_run=true", strings.NewReader(body)), 7)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+
+	handler.DealsImportPost(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var report models.DealImportReport
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 4, report.Rows)
+	assert.Equal(t, 0, report.Created)
+	assert.Empty(t, report.Ids)
+
+	require.Len(t, report.Errors, 3)
+	assert.Equal(t, 3, report.Errors[0].Row)
+	assert.Contains(t, report.Errors[0].Error, "status:")
+	assert.Equal(t, 4, report.Errors[1].Row)
+	assert.Contains(t, report.Errors[1].Error, "unknown field")
+	assert.Equal(t, 5, report.Errors[2].Row)
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestDealHandler_DealsImportPost_Rejected(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	handler := NewDealHandler(repository.NewDealRepository(db, redisClient), redisClient, zap.NewNop())
+
+	tests := []struct {
+		name        string
+		contentType string
+		target      string
+		body        string
+		code        int
+	}{
+		{"unsupported media type", "application/json", "/api/deals/import", `[]`, http.StatusUnsupportedMediaType},
+		{"unknown column", "text/csv", "/api/deals/import", "title,expenses,profit,owner\n", http.StatusBadRequest},
+		{"missing column", "text/csv", "/api/deals/import", "title,expenses\n", http.StatusBadRequest},
+		{"empty file", "text/csv", "/api/deals/import", "", http.StatusBadRequest},
+		{"invalid dry_run", "text/csv", "/api/deals/import?dry_run=maybe", "title,expenses,profit\n", http.StatusBadRequest},
+		{"too many rows", "text/csv", "/api/deals/import?dry_run=true",
+			"title,expenses,profit\n" + strings.Repeat("Deal,1,2\n", MaxImportRows+1), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := asUser(httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body)), 7)
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			handler.DealsImportPost(w, req)
+
+			assert.Equal(t, tt.code, w.Code, w.Body.String())
+		})
+	}
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
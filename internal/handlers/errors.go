@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/internal/validation"
+	"Brocker-pet-project/pkg/apierror"
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// writeInvalid answers 422 with the fields a validation error rejected.
+func writeInvalid(w http.ResponseWriter, r *http.Request, err error) {
+	fields, _ := validation.Fields(err)
+	apierror.Write(w, r, http.StatusUnprocessableEntity, "Validation failed", fields...)
+}
+
+// writeRepositoryError answers with the status a repository error stands
+// for: 404, 409, 503 when the database cannot be reached, 504 when the
+// request deadline passed, and 500 for anything unexpected. msg is logged
+// with the errors the client cannot fix. A request the client gave up on
+// is only logged at debug level.
+func writeRepositoryError(w http.ResponseWriter, r *http.Request, log *zap.Logger, msg string, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		log.Debug(msg, zap.Error(err))
+		apierror.Write(w, r, http.StatusServiceUnavailable, "Request cancelled")
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Warn(msg, zap.Error(err))
+		apierror.Write(w, r, http.StatusGatewayTimeout, "Request timed out")
+	case errors.Is(err, repository.ErrNotFound):
+		apierror.Write(w, r, http.StatusNotFound, "Not found")
+	case errors.Is(err, repository.ErrConflict):
+		apierror.Write(w, r, http.StatusConflict, "Conflict")
+	case errors.Is(err, repository.ErrUnavailable):
+		log.Error(msg, zap.Error(err))
+		apierror.Write(w, r, http.StatusServiceUnavailable, "Service temporarily unavailable")
+	default:
+		log.Error(msg, zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
+	}
+}
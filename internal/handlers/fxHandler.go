@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/internal/validation"
+	"Brocker-pet-project/pkg/apierror"
+	"Brocker-pet-project/pkg/requestlog"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type FxHandler struct {
+	repo repository.FxStore
+	log  *zap.Logger
+}
+
+func NewFxHandler(repo repository.FxStore, log *zap.Logger) *FxHandler {
+	return &FxHandler{repo: repo, log: log}
+}
+
+// FxRatesGet lists every stored FX rate.
+func (h *FxHandler) FxRatesGet(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	rates, err := h.repo.GetRates(r.Context())
+	if err != nil {
+		writeRepositoryError(w, r, log, "Error reading fx rates", err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(rates); err != nil {
+		log.Error("Error encoding response", zap.Error(err))
+		return
+	}
+
+	log.Debug("Fx rates get request successfully handled")
+}
+
+// FxRatesPost stores an array of rates. Either all of them are stored or,
+// when one is invalid, none.
+func (h *FxHandler) FxRatesPost(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	if r.Header.Get("content-type") != "application/json" {
+		log.Error("Invalid content type", zap.String("expected", "application/json"), zap.String("got", r.Header.Get("content-type")))
+		apierror.Write(w, r, http.StatusUnsupportedMediaType, "Invalid media type")
+		return
+	}
+
+	var rates []models.FxRate
+
+	if err := json.NewDecoder(r.Body).Decode(&rates); err != nil {
+		log.Error("Error decoding fx rates", zap.Error(err))
+		apierror.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.FxRates(rates); err != nil {
+		log.Error("Invalid fx rates", zap.Error(err))
+		writeInvalid(w, r, err)
+		return
+	}
+
+	if err := h.repo.SaveRates(r.Context(), rates); err != nil {
+		writeRepositoryError(w, r, log, "Error saving fx rates", err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(rates); err != nil {
+		log.Error("Error encoding response", zap.Error(err))
+		return
+	}
+
+	log.Info("Fx rates saved", zap.Int("rates", len(rates)))
+}
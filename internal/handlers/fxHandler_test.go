@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"Brocker-pet-project/internal/repository"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFxHandler_FxRatesPost(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	handler := NewFxHandler(repository.NewFxRepository(db), zap.NewNop())
+
+	effectiveAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`INSERT INTO fx_rates`).
+		WithArgs("EUR", "USD", decimal.RequireFromString("1.085"), effectiveAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/fx_rates",
+		strings.NewReader(`[{"base": "eur", "quote": "usd", "rate": "1.085", "effective_at": "2025-01-01T00:00:00Z"}]`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.FxRatesPost(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"base":"EUR"`)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestFxHandler_FxRatesPost_Invalid(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	handler := NewFxHandler(repository.NewFxRepository(db), zap.NewNop())
+
+	// Одна неверная ставка отклоняет весь запрос
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/fx_rates",
+		strings.NewReader(`[{"base": "EUR", "quote": "USD", "rate": "1.085", "effective_at": "2025-01-01T00:00:00Z"},
+		{"base": "EUR", "quote": "USD", "rate": "0", "effective_at": "2025-01-02T00:00:00Z"}]`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.FxRatesPost(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"rates[1].rate"`)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
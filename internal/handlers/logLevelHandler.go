@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"Brocker-pet-project/pkg/apierror"
+	"Brocker-pet-project/pkg/requestlog"
+	"encoding/json"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+)
+
+// logLevelBody is the body of both log level endpoints.
+type logLevelBody struct {
+	Level string `json:"level"`
+}
+
+type LogLevelHandler struct {
+	level zap.AtomicLevel
+	log   *zap.Logger
+}
+
+func NewLogLevelHandler(level zap.AtomicLevel, log *zap.Logger) *LogLevelHandler {
+	return &LogLevelHandler{level: level, log: log}
+}
+
+// LogLevelGet returns the current log level.
+func (h *LogLevelHandler) LogLevelGet(w http.ResponseWriter, r *http.Request) {
+	h.writeLevel(w, r)
+}
+
+// LogLevelPut changes the log level until the next restart.
+func (h *LogLevelHandler) LogLevelPut(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	if r.Header.Get("content-type") != "application/json" {
+		log.Error("Invalid content type", zap.String("expected", "application/json"), zap.String("got", r.Header.Get("content-type")))
+		apierror.Write(w, r, http.StatusUnsupportedMediaType, "Invalid media type")
+		return
+	}
+
+	var body logLevelBody
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Error("Error decoding log level", zap.Error(err))
+		apierror.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	level, err := zapcore.ParseLevel(body.Level)
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, "Invalid log level")
+		return
+	}
+
+	previous := h.level.Level()
+	h.level.SetLevel(level)
+
+	// Logged at warn so the change is recorded whatever the new level is.
+	log.Warn("Log level changed", zap.Stringer("from", previous), zap.Stringer("to", level))
+
+	h.writeLevel(w, r)
+}
+
+func (h *LogLevelHandler) writeLevel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(logLevelBody{Level: h.level.String()}); err != nil {
+		requestlog.Logger(r.Context(), h.log).Error("Error encoding response", zap.Error(err))
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogLevelHandler_LogLevelGet(t *testing.T) {
+	handler := NewLogLevelHandler(zap.NewAtomicLevelAt(zap.InfoLevel), zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/log_level", nil)
+	w := httptest.NewRecorder()
+
+	handler.LogLevelGet(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"level": "info"}`, w.Body.String())
+}
+
+func TestLogLevelHandler_LogLevelPut(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantLevel   string
+	}{
+		{name: "Changes level", contentType: "application/json", body: `{"level": "debug"}`, wantStatus: http.StatusOK, wantLevel: "debug"},
+		{name: "Unknown level", contentType: "application/json", body: `{"level": "verbose"}`, wantStatus: http.StatusBadRequest, wantLevel: "info"},
+		{name: "Invalid body", contentType: "application/json", body: `{`, wantStatus: http.StatusBadRequest, wantLevel: "info"},
+		{name: "Invalid content type", contentType: "text/plain", body: `{"level": "debug"}`, wantStatus: http.StatusUnsupportedMediaType, wantLevel: "info"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level := zap.NewAtomicLevelAt(zap.InfoLevel)
+			handler := NewLogLevelHandler(level, zap.NewNop())
+
+			req := httptest.NewRequest(http.MethodPut, "/api/admin/log_level", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			handler.LogLevelPut(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			// Уровень меняется только при корректном запросе
+			assert.Equal(t, tt.wantLevel, level.String())
+		})
+	}
+}
@@ -1,43 +1,219 @@
 package handlers
 
 import (
+	"Brocker-pet-project/internal/models"
 	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/pkg/apierror"
+	"Brocker-pet-project/pkg/requestlog"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 )
 
+const reportCacheTTL = 5 * time.Minute
+
 type ProfitHandler struct {
-	repo *repository.ProfitRepository
-	log  *zap.Logger
+	repo      repository.ProfitStore
+	redisRepo *redis.Client
+	log       *zap.Logger
 }
 
-func NewProfitHandler(repo *repository.ProfitRepository, log *zap.Logger) *ProfitHandler {
-	return &ProfitHandler{repo: repo, log: log}
+func NewProfitHandler(repo repository.ProfitStore, redisRepo *redis.Client, log *zap.Logger) *ProfitHandler {
+	return &ProfitHandler{repo: repo, redisRepo: redisRepo, log: log}
 }
 
 func (h *ProfitHandler) AllClearProfitGET(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
 
 	if r.Method != http.MethodGet {
-		h.log.Error("Invalid request method", zap.String("excepted: ", http.MethodGet), zap.String("got: ", r.Method))
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		log.Error("Method not allowed", zap.String("expected", http.MethodGet), zap.String("got", r.Method))
+		apierror.Write(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
 		return
 	}
 
-	profits := h.repo.GetAllProfitInfo(r.Context())
-	if profits == nil {
-		h.log.Error("Error reading sql response")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	profits, err := h.repo.GetAllProfitInfo(r.Context(), userId)
+	if err != nil {
+		writeRepositoryError(w, r, log, "Error getting clear profit", err)
 		return
 	}
 
 	w.Header().Set("content-type", "application/json")
 	if err := json.NewEncoder(w).Encode(profits); err != nil {
-		h.log.Error("Error encoding response", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error("Error encoding response", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	h.log.Debug("All clear profit get request successfully handled")
+	log.Debug("All clear profit get request successfully handled")
+
+}
+
+// ProfitTotalGet reports the total clear profit. Query parameters: from and
+// to (RFC 3339 or YYYY-MM-DD, to is exclusive).
+func (h *ProfitHandler) ProfitTotalGet(w http.ResponseWriter, r *http.Request) {
+	h.serveReport(w, r, "total", func(ctx context.Context, userId int64, query url.Values) (any, error) {
+		rng, err := parseProfitRange(query)
+		if err != nil {
+			return nil, err
+		}
+		return h.repo.ProfitTotals(ctx, userId, rng)
+	})
+}
+
+// ProfitPeriodsGet reports clear profit and its running total per period.
+// Query parameters: period (day, week or month, default month), from and to.
+func (h *ProfitHandler) ProfitPeriodsGet(w http.ResponseWriter, r *http.Request) {
+	h.serveReport(w, r, "periods", func(ctx context.Context, userId int64, query url.Values) (any, error) {
+		rng, err := parseProfitRange(query)
+		if err != nil {
+			return nil, err
+		}
+		period := query.Get("period")
+		if period == "" {
+			period = "month"
+		}
+		return h.repo.ProfitByPeriod(ctx, userId, period, rng)
+	})
+}
+
+// ProfitTopGet lists the most profitable deals. Query parameters: limit,
+// from and to.
+func (h *ProfitHandler) ProfitTopGet(w http.ResponseWriter, r *http.Request) {
+	h.serveReport(w, r, "top", func(ctx context.Context, userId int64, query url.Values) (any, error) {
+		rng, limit, err := parseProfitDealsQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		return h.repo.TopProfitDeals(ctx, userId, rng, limit)
+	})
+}
+
+// ProfitLossesGet lists loss-making deals, the largest loss first. Query
+// parameters: limit, from and to.
+func (h *ProfitHandler) ProfitLossesGet(w http.ResponseWriter, r *http.Request) {
+	h.serveReport(w, r, "losses", func(ctx context.Context, userId int64, query url.Values) (any, error) {
+		rng, limit, err := parseProfitDealsQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		return h.repo.LossDeals(ctx, userId, rng, limit)
+	})
+}
+
+// errBadReportQuery marks report errors caused by the query parameters.
+var errBadReportQuery = errors.New("invalid report query")
+
+type reportFunc func(ctx context.Context, userId int64, query url.Values) (any, error)
+
+// serveReport answers from the Redis cache when the report was computed
+// since the user's profit last changed, and computes and caches it
+// otherwise. Redis errors only disable the cache.
+func (h *ProfitHandler) serveReport(w http.ResponseWriter, r *http.Request, name string, report reportFunc) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	userId, ok := requestUserID(w, r, log)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	cacheKey := ""
+	version, err := h.redisRepo.Get(ctx, repository.ReportVersionKey(userId)).Int64()
+	if errors.Is(err, redis.Nil) {
+		version, err = 0, nil
+	}
+	if err != nil {
+		log.Error("Error reading report cache version", zap.Error(err))
+	} else {
+		cacheKey = repository.ReportCacheKey(userId, version, name, query.Encode())
+
+		if cached, err := h.redisRepo.Get(ctx, cacheKey).Bytes(); err == nil {
+			w.Header().Set("content-type", "application/json")
+			w.Write(cached)
+			log.Debug("Served by redis cache", zap.String("report", name))
+			return
+		}
+	}
+
+	result, err := report(ctx, userId, query)
+	if errors.Is(err, errBadReportQuery) || errors.Is(err, repository.ErrInvalidPeriod) {
+		apierror.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeRepositoryError(w, r, log.With(zap.String("report", name)), "Error computing profit report", err)
+		return
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		log.Error("Error encoding response", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if cacheKey != "" {
+		h.redisRepo.Set(ctx, cacheKey, body, reportCacheTTL)
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.Write(body)
+
+	log.Debug("Profit report request successfully handled", zap.String("report", name))
+}
+
+func parseProfitRange(query url.Values) (models.ProfitRange, error) {
+	var rng models.ProfitRange
+
+	dates := []struct {
+		name  string
+		value **time.Time
+	}{
+		{"from", &rng.From},
+		{"to", &rng.To},
+	}
+	for _, date := range dates {
+		raw := query.Get(date.name)
+		if raw == "" {
+			continue
+		}
+		t, err := parseQueryTime(raw)
+		if err != nil {
+			return rng, fmt.Errorf("%w: %s %q", errBadReportQuery, date.name, raw)
+		}
+		*date.value = &t
+	}
+
+	return rng, nil
+}
+
+func parseProfitDealsQuery(query url.Values) (models.ProfitRange, int, error) {
+	rng, err := parseProfitRange(query)
+	if err != nil {
+		return rng, 0, err
+	}
+
+	limit := 0
+	if raw := query.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return rng, 0, fmt.Errorf("%w: limit %q", errBadReportQuery, raw)
+		}
+	}
 
+	return rng, limit, nil
 }
@@ -3,18 +3,23 @@ package handlers
 import (
 	"Brocker-pet-project/internal/models"
 	"Brocker-pet-project/internal/repository"
-	"database/sql"
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
+var profitColumns = []string{"id", "deals_id", "user_id", "all_profit", "currency", "reporting_profit", "reporting_currency", "fx_rate"}
+
 func TestProfitHandler_AllClearProfitGET_Success(t *testing.T) {
 	// Setup
 	db, dbMock := setupMockDB(t)
@@ -22,24 +27,27 @@ func TestProfitHandler_AllClearProfitGET_Success(t *testing.T) {
 
 	logger := zap.NewNop()
 	profitRepo := repository.NewProfitRepository(db)
-	handler := NewProfitHandler(profitRepo, logger)
+	handler := NewProfitHandler(profitRepo, nil, logger)
 
 	// Test data
 	expectedProfits := []models.ProfitSQLDeal{
-		{Id: 1, DealId: 1, AllProfit: 100},
-		{Id: 2, DealId: 2, AllProfit: 200},
+		{Id: 1, DealId: 1, UserId: 7, AllProfit: decimal.NewFromInt(100), Currency: "USD",
+			ReportingProfit: decimal.NewFromInt(100), ReportingCurrency: "USD", FxRate: decimal.NewFromInt(1)},
+		{Id: 2, DealId: 2, UserId: 7, AllProfit: decimal.NewFromInt(200), Currency: "EUR",
+			ReportingProfit: decimal.NewFromInt(217), ReportingCurrency: "USD", FxRate: decimal.RequireFromString("1.085")},
 	}
 
 	// Mock expectations
-	rows := sqlmock.NewRows([]string{"id", "deals_id", "all_profit"}).
-		AddRow(expectedProfits[0].Id, expectedProfits[0].DealId, expectedProfits[0].AllProfit).
-		AddRow(expectedProfits[1].Id, expectedProfits[1].DealId, expectedProfits[1].AllProfit)
+	rows := sqlmock.NewRows(profitColumns).
+		AddRow(expectedProfits[0].Id, expectedProfits[0].DealId, expectedProfits[0].UserId, expectedProfits[0].AllProfit.String(), expectedProfits[0].Currency, expectedProfits[0].ReportingProfit.String(), expectedProfits[0].ReportingCurrency, expectedProfits[0].FxRate.String()).
+		AddRow(expectedProfits[1].Id, expectedProfits[1].DealId, expectedProfits[1].UserId, expectedProfits[1].AllProfit.String(), expectedProfits[1].Currency, expectedProfits[1].ReportingProfit.String(), expectedProfits[1].ReportingCurrency, expectedProfits[1].FxRate.String())
 
-	dbMock.ExpectQuery(`SELECT id, deals_id, all_profit FROM clear_profit`).
+	dbMock.ExpectQuery(`SELECT (.+) FROM clear_profit WHERE user_id=\$1`).
+		WithArgs(int64(7)).
 		WillReturnRows(rows)
 
 	// Create request
-	req := httptest.NewRequest(http.MethodGet, "/profits", nil)
+	req := asUser(httptest.NewRequest(http.MethodGet, "/profits", nil), 7)
 	w := httptest.NewRecorder()
 
 	// Call handler
@@ -62,7 +70,7 @@ func TestProfitHandler_AllClearProfitGET_WrongMethod(t *testing.T) {
 
 	logger := zap.NewNop()
 	profitRepo := repository.NewProfitRepository(db)
-	handler := NewProfitHandler(profitRepo, logger)
+	handler := NewProfitHandler(profitRepo, nil, logger)
 
 	// Create request with wrong method
 	req := httptest.NewRequest(http.MethodPost, "/profits", nil)
@@ -82,14 +90,15 @@ func TestProfitHandler_AllClearProfitGET_DBError(t *testing.T) {
 
 	logger := zap.NewNop()
 	profitRepo := repository.NewProfitRepository(db)
-	handler := NewProfitHandler(profitRepo, logger)
+	handler := NewProfitHandler(profitRepo, nil, logger)
 
 	// Mock expectations
-	dbMock.ExpectQuery(`SELECT id, deals_id, all_profit FROM clear_profit`).
-		WillReturnError(sql.ErrNoRows)
+	dbMock.ExpectQuery(`SELECT (.+) FROM clear_profit WHERE user_id=\$1`).
+		WithArgs(int64(7)).
+		WillReturnError(errors.New("database error"))
 
 	// Create request
-	req := httptest.NewRequest(http.MethodGet, "/profits", nil)
+	req := asUser(httptest.NewRequest(http.MethodGet, "/profits", nil), 7)
 	w := httptest.NewRecorder()
 
 	// Call handler
@@ -100,6 +109,47 @@ func TestProfitHandler_AllClearProfitGET_DBError(t *testing.T) {
 	assert.NoError(t, dbMock.ExpectationsWereMet())
 }
 
+func TestProfitHandler_AllClearProfitGET_Unavailable(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	handler := NewProfitHandler(repository.NewProfitRepository(db), nil, zap.NewNop())
+
+	// База недоступна — клиент может повторить запрос позже
+	dbMock.ExpectQuery(`SELECT (.+) FROM clear_profit WHERE user_id=\$1`).
+		WithArgs(int64(7)).
+		WillReturnError(&pq.Error{Code: "08006"})
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/profits", nil), 7)
+	w := httptest.NewRecorder()
+
+	handler.AllClearProfitGET(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"unavailable"`)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestProfitHandler_AllClearProfitGET_Timeout(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	handler := NewProfitHandler(repository.NewProfitRepository(db), nil, zap.NewNop())
+
+	// Срок запроса уже истёк — до базы дело не доходит
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/profits", nil).WithContext(ctx), 7)
+	w := httptest.NewRecorder()
+
+	handler.AllClearProfitGET(w, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"timeout"`)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
 func TestProfitHandler_AllClearProfitGET_EncodeError(t *testing.T) {
 	// Setup
 	db, dbMock := setupMockDB(t)
@@ -110,22 +160,24 @@ func TestProfitHandler_AllClearProfitGET_EncodeError(t *testing.T) {
 	observedLogger := zap.New(observedZapCore)
 
 	profitRepo := repository.NewProfitRepository(db)
-	handler := NewProfitHandler(profitRepo, observedLogger)
+	handler := NewProfitHandler(profitRepo, nil, observedLogger)
 
 	// Test data
 	testProfits := []models.ProfitSQLDeal{
-		{Id: 1, DealId: 1, AllProfit: 100},
+		{Id: 1, DealId: 1, UserId: 7, AllProfit: decimal.NewFromInt(100), Currency: "USD",
+			ReportingProfit: decimal.NewFromInt(100), ReportingCurrency: "USD", FxRate: decimal.NewFromInt(1)},
 	}
 
 	// Mock database response
-	rows := sqlmock.NewRows([]string{"id", "deals_id", "all_profit"}).
-		AddRow(testProfits[0].Id, testProfits[0].DealId, testProfits[0].AllProfit)
+	rows := sqlmock.NewRows(profitColumns).
+		AddRow(testProfits[0].Id, testProfits[0].DealId, testProfits[0].UserId, testProfits[0].AllProfit.String(), testProfits[0].Currency, testProfits[0].ReportingProfit.String(), testProfits[0].ReportingCurrency, testProfits[0].FxRate.String())
 
-	dbMock.ExpectQuery(`SELECT id, deals_id, all_profit FROM clear_profit`).
+	dbMock.ExpectQuery(`SELECT (.+) FROM clear_profit WHERE user_id=\$1`).
+		WithArgs(int64(7)).
 		WillReturnRows(rows)
 
 	// Create request
-	req := httptest.NewRequest(http.MethodGet, "/profits", nil)
+	req := asUser(httptest.NewRequest(http.MethodGet, "/profits", nil), 7)
 
 	// Create response writer that will fail on Write
 	w := &failingResponseWriter{
@@ -144,6 +196,91 @@ func TestProfitHandler_AllClearProfitGET_EncodeError(t *testing.T) {
 	assert.NoError(t, dbMock.ExpectationsWereMet())
 }
 
+func TestProfitHandler_ProfitTotalGet_NotCached(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, redisMock := setupMockRedis()
+	handler := NewProfitHandler(repository.NewProfitRepository(db), redisClient, zap.NewNop())
+
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	expectedJSON := `[{"currency":"USD","total":"150.5","deals":2}]`
+
+	// Версии ещё нет - отчёт кэшируется под нулевой версией
+	redisMock.ExpectGet("profitReports:version:7").RedisNil()
+	redisMock.ExpectGet("profitReports:7:0:total:from=2025-01-01").RedisNil()
+	dbMock.ExpectQuery(`FROM clear_profit c WHERE c.user_id=\$1 AND c.booked_at >= \$2 GROUP BY c.reporting_currency`).
+		WithArgs(int64(7), from).
+		WillReturnRows(sqlmock.NewRows([]string{"reporting_currency", "sum", "count"}).AddRow("USD", "150.5", 2))
+	redisMock.ExpectSet("profitReports:7:0:total:from=2025-01-01", []byte(expectedJSON), reportCacheTTL).SetVal("OK")
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/reports/profit/total?from=2025-01-01", nil), 7)
+	w := httptest.NewRecorder()
+
+	handler.ProfitTotalGet(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, expectedJSON, w.Body.String())
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestProfitHandler_ProfitTopGet_Cached(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, redisMock := setupMockRedis()
+	handler := NewProfitHandler(repository.NewProfitRepository(db), redisClient, zap.NewNop())
+
+	cached := `[{"deal_id":3,"title":"Deal 3"}]`
+
+	redisMock.ExpectGet("profitReports:version:7").SetVal("4")
+	redisMock.ExpectGet("profitReports:7:4:top:limit=5").SetVal(cached)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/reports/profit/top?limit=5", nil), 7)
+	w := httptest.NewRecorder()
+
+	handler.ProfitTopGet(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, cached, w.Body.String())
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestProfitHandler_Reports_BadRequest(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, redisMock := setupMockRedis()
+	handler := NewProfitHandler(repository.NewProfitRepository(db), redisClient, zap.NewNop())
+
+	tests := []struct {
+		name    string
+		url     string
+		handler http.HandlerFunc
+	}{
+		{"unknown period", "/api/reports/profit/periods?period=year", handler.ProfitPeriodsGet},
+		{"invalid date", "/api/reports/profit/total?from=yesterday", handler.ProfitTotalGet},
+		{"invalid limit", "/api/reports/profit/losses?limit=-1", handler.ProfitLossesGet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redisMock.ExpectGet("profitReports:version:7").RedisNil()
+			redisMock.Regexp().ExpectGet(`profitReports:7:0:.*`).RedisNil()
+
+			w := httptest.NewRecorder()
+			tt.handler(w, asUser(httptest.NewRequest(http.MethodGet, tt.url, nil), 7))
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
 // failingResponseWriter fails on Write to simulate json encode error
 type failingResponseWriter struct {
 	header     http.Header
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"Brocker-pet-project/pkg/apierror"
+	"Brocker-pet-project/pkg/jwt"
+	"Brocker-pet-project/pkg/middleware"
+	"Brocker-pet-project/pkg/requestlog"
+	"Brocker-pet-project/pkg/tokenstore"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+type TokenHandler struct {
+	tokens *jwt.Manager
+	store  tokenstore.Store
+	log    *zap.Logger
+}
+
+func NewTokenHandler(tokens *jwt.Manager, store tokenstore.Store, log *zap.Logger) *TokenHandler {
+	return &TokenHandler{tokens: tokens, store: store, log: log}
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshPost exchanges a refresh token for a new token pair. Each refresh
+// token can be used once; presenting it again revokes its whole family.
+func (h *TokenHandler) RefreshPost(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	if r.Method != http.MethodPost {
+		log.Error("Invalid request method", zap.String("expected", http.MethodPost), zap.String("got", r.Method))
+		apierror.Write(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req refreshRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error("Error decoding refresh request", zap.Error(err))
+		apierror.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	claims, err := h.tokens.ValidateRefreshToken(req.RefreshToken)
+	if err != nil {
+		log.Debug("Invalid refresh token", zap.Error(err))
+		apierror.Write(w, r, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	ctx := r.Context()
+
+	revoked, err := h.store.IsFamilyRevoked(ctx, claims.Family)
+	if err != nil {
+		log.Error("Error checking token family", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if revoked {
+		apierror.Write(w, r, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	first, err := h.store.MarkUsed(ctx, claims.ID, time.Until(claims.ExpiresAt.Time))
+	if err != nil {
+		log.Error("Error marking refresh token as used", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if !first {
+		log.Warn("Refresh token reuse detected, revoking token family",
+			zap.Int64("user_id", claims.UserID), zap.String("family", claims.Family))
+		if err := h.store.RevokeFamily(ctx, claims.Family, h.tokens.RefreshTTL()); err != nil {
+			log.Error("Error revoking token family", zap.Error(err))
+		}
+		apierror.Write(w, r, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	tokens, err := h.tokens.RotateTokenPair(claims)
+	if err != nil {
+		log.Error("Failed to generate token", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(tokens); err != nil {
+		log.Error("Error encoding response", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	log.Debug("Token refresh request successfully handled", zap.Int64("user_id", claims.UserID))
+}
+
+// LogoutPost revokes the caller's access token and its refresh token family.
+func (h *TokenHandler) LogoutPost(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
+	if r.Method != http.MethodPost {
+		log.Error("Invalid request method", zap.String("expected", http.MethodPost), zap.String("got", r.Method))
+		apierror.Write(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
+		log.Error("Missing token claims in request context")
+		apierror.Write(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := h.store.RevokeFamily(ctx, claims.Family, h.tokens.RefreshTTL()); err != nil {
+		log.Error("Error revoking token family", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if err := h.store.Revoke(ctx, claims.ID, time.Until(claims.ExpiresAt.Time)); err != nil {
+		log.Error("Error revoking access token", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	log.Debug("Logout request successfully handled", zap.Int64("user_id", claims.UserID))
+}
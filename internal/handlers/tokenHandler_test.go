@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"Brocker-pet-project/internal/config"
+	"Brocker-pet-project/pkg/jwt"
+	"Brocker-pet-project/pkg/middleware"
+	"Brocker-pet-project/pkg/tokenstore"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testTokenManager(t *testing.T) *jwt.Manager {
+	tokens, err := jwt.NewManager(config.Jwt{Token: "test_secret_key"})
+	require.NoError(t, err)
+	return tokens
+}
+
+func refreshRequestFor(refreshToken string) *http.Request {
+	body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	req := httptest.NewRequest(http.MethodPost, "/api/token/refresh", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestTokenHandler_RefreshPost_Rotates(t *testing.T) {
+	// Setup
+	tokens := testTokenManager(t)
+	store := tokenstore.NewMemoryStore()
+	handler := NewTokenHandler(tokens, store, zap.NewNop())
+
+	pair, err := tokens.GenerateTokenPair(3)
+	require.NoError(t, err)
+
+	// Call handler
+	w := httptest.NewRecorder()
+	handler.RefreshPost(w, refreshRequestFor(pair.RefreshToken))
+
+	// Verify
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response jwt.TokenPair
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.NotEmpty(t, response.AccessToken)
+	assert.NotEqual(t, pair.RefreshToken, response.RefreshToken)
+
+	claims, err := tokens.ValidateRefreshToken(response.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), claims.UserID)
+}
+
+func TestTokenHandler_RefreshPost_ReuseRevokesFamily(t *testing.T) {
+	// Setup
+	tokens := testTokenManager(t)
+	store := tokenstore.NewMemoryStore()
+	handler := NewTokenHandler(tokens, store, zap.NewNop())
+
+	pair, err := tokens.GenerateTokenPair(3)
+	require.NoError(t, err)
+
+	// First use rotates the pair
+	w := httptest.NewRecorder()
+	handler.RefreshPost(w, refreshRequestFor(pair.RefreshToken))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var rotated jwt.TokenPair
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&rotated))
+
+	// Replaying the old token is rejected
+	w = httptest.NewRecorder()
+	handler.RefreshPost(w, refreshRequestFor(pair.RefreshToken))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// ...and the rotated token from the same family stops working too
+	w = httptest.NewRecorder()
+	handler.RefreshPost(w, refreshRequestFor(rotated.RefreshToken))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	claims, err := tokens.ValidateToken(rotated.AccessToken)
+	require.NoError(t, err)
+	revoked, err := store.IsFamilyRevoked(context.Background(), claims.Family)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestTokenHandler_RefreshPost_InvalidToken(t *testing.T) {
+	tokens := testTokenManager(t)
+	handler := NewTokenHandler(tokens, tokenstore.NewMemoryStore(), zap.NewNop())
+
+	pair, err := tokens.GenerateTokenPair(3)
+	require.NoError(t, err)
+
+	// Access tokens are not accepted as refresh tokens
+	w := httptest.NewRecorder()
+	handler.RefreshPost(w, refreshRequestFor(pair.AccessToken))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.RefreshPost(w, refreshRequestFor("invalid.token.here"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTokenHandler_LogoutPost(t *testing.T) {
+	// Setup
+	tokens := testTokenManager(t)
+	store := tokenstore.NewMemoryStore()
+	handler := NewTokenHandler(tokens, store, zap.NewNop())
+
+	pair, err := tokens.GenerateTokenPair(3)
+	require.NoError(t, err)
+	claims, err := tokens.ValidateToken(pair.AccessToken)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/logout", nil)
+	req = req.WithContext(middleware.WithClaims(req.Context(), claims))
+	w := httptest.NewRecorder()
+
+	// Call handler
+	handler.LogoutPost(w, req)
+
+	// Verify
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	revoked, err := store.IsRevoked(context.Background(), claims.ID)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	// The refresh token of the logged out session can no longer be used
+	w = httptest.NewRecorder()
+	handler.RefreshPost(w, refreshRequestFor(pair.RefreshToken))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTokenHandler_LogoutPost_Unauthenticated(t *testing.T) {
+	tokens := testTokenManager(t)
+	handler := NewTokenHandler(tokens, tokenstore.NewMemoryStore(), zap.NewNop())
+
+	w := httptest.NewRecorder()
+	handler.LogoutPost(w, httptest.NewRequest(http.MethodPost, "/api/logout", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
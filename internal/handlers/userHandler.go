@@ -3,94 +3,121 @@ package handlers
 import (
 	"Brocker-pet-project/internal/models"
 	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/internal/validation"
+	"Brocker-pet-project/pkg/apierror"
 	"Brocker-pet-project/pkg/jwt"
+	"Brocker-pet-project/pkg/requestlog"
 	"encoding/json"
+	"errors"
 	"go.uber.org/zap"
 	"net/http"
 )
 
 type UserHandler struct {
-	repo *repository.UserRepository
-	log  *zap.Logger
+	repo   repository.UserStore
+	tokens *jwt.Manager
+	log    *zap.Logger
 }
 
-func NewUserHandler(repo *repository.UserRepository, log *zap.Logger) *UserHandler {
-	return &UserHandler{repo: repo, log: log}
+func NewUserHandler(repo repository.UserStore, tokens *jwt.Manager, log *zap.Logger) *UserHandler {
+	return &UserHandler{repo: repo, tokens: tokens, log: log}
 }
 
 func (h *UserHandler) NewUserPost(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
+
 	if r.Method != http.MethodPost {
-		h.log.Error("Invalid request method", zap.String("excepted: ", http.MethodPost), zap.String("got: ", r.Method))
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		log.Error("Method not allowed", zap.String("expected", http.MethodPost), zap.String("got", r.Method))
+		apierror.Write(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if r.Header.Get("content-type") != "application/json" {
-		h.log.Error("Invalid content type", zap.String("excepted: ", "application/json"), zap.String("got: ", r.Header.Get("content-type")))
-		http.Error(w, "Invalid content type", http.StatusUnsupportedMediaType)
+		log.Error("Invalid content type", zap.String("expected", "application/json"), zap.String("got", r.Header.Get("content-type")))
+		apierror.Write(w, r, http.StatusUnsupportedMediaType, "Invalid content type")
 		return
 	}
 
 	var user models.User
 
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		h.log.Error("Error decoding user", zap.Error(err))
-		http.Error(w, "Invalid server error", http.StatusInternalServerError)
+		log.Error("Error decoding user", zap.Error(err))
+		apierror.Write(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	userResponse := h.repo.NewUser(user.Username, user.Password)
+	if err := validation.Registration(&user); err != nil {
+		log.Error("Invalid user", zap.Error(err))
+		writeInvalid(w, r, err)
+		return
+	}
 
-	if userResponse == nil {
-		h.log.Error("Error creating new user")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	userResponse, err := h.repo.NewUser(r.Context(), user.Username, user.Password)
+	if errors.Is(err, repository.ErrUsernameTaken) {
+		log.Error("Username already taken", zap.String("username", user.Username))
+		apierror.Write(w, r, http.StatusConflict, "Username already taken")
+		return
+	}
+	if err != nil {
+		writeRepositoryError(w, r, log, "Error creating new user", err)
 		return
 	}
 
 	w.Header().Set("content-type", "application/json")
 	if err := json.NewEncoder(w).Encode(userResponse); err != nil {
-		h.log.Error("Error encoding response", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error("Error encoding response", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	h.log.Debug("User post request successfully handled", zap.Int64("id: ", user.Id), zap.String(" username: ", user.Username))
+	log.Debug("User post request successfully handled", zap.Int64("id", user.Id), zap.String("username", user.Username))
 
 }
 
 func (h *UserHandler) LoginIn(w http.ResponseWriter, r *http.Request) {
+	log := requestlog.Logger(r.Context(), h.log)
 
 	if r.Method != http.MethodGet {
-		h.log.Error("Invalid request method", zap.String("excepted: ", http.MethodGet), zap.String("got: ", r.Method))
-		http.Error(w, "Invalid request method ", http.StatusMethodNotAllowed)
+		log.Error("Method not allowed", zap.String("expected", http.MethodGet), zap.String("got", r.Method))
+		apierror.Write(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var user models.User
 
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		h.log.Error("Error decoding user", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error("Error decoding user", zap.Error(err))
+		apierror.Write(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	userResponse := h.repo.GetUserByUsername(user.Username, user.Password)
-	if userResponse == nil {
-		h.log.Error("Error getting user by username", zap.String("username: ", user.Username))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if err := validation.Credentials(&user); err != nil {
+		log.Error("Invalid credentials", zap.Error(err))
+		writeInvalid(w, r, err)
+		return
+	}
+
+	userResponse, err := h.repo.Authenticate(r.Context(), user.Username, user.Password)
+	if errors.Is(err, repository.ErrInvalidCredentials) {
+		log.Error("Error authenticating user", zap.String("username", user.Username))
+		apierror.Write(w, r, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
+	if err != nil {
+		writeRepositoryError(w, r, log, "Error authenticating user", err)
 		return
 	}
 
-	token, err := jwt.GenerateToken(userResponse.Id)
+	tokens, err := h.tokens.GenerateTokenPair(userResponse.Id)
 	if err != nil {
-		h.log.Error("Failed to generate token", zap.Error(err))
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error("Failed to generate token", zap.Error(err))
+		apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	json.NewEncoder(w).Encode(tokens)
 
-	h.log.Debug("User get request successfully handled", zap.String("username: ", user.Username))
+	log.Debug("User get request successfully handled", zap.String("username", user.Username))
 
 }
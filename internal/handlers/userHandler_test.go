@@ -3,20 +3,38 @@ package handlers
 import (
 	"Brocker-pet-project/internal/models"
 	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/internal/repository/memory"
+	"Brocker-pet-project/pkg/apierror"
+	"Brocker-pet-project/pkg/hasher"
 	"Brocker-pet-project/pkg/jwt"
 	"bytes"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 )
 
+// hashOf matches a bcrypt hash of the given password.
+type hashOf string
+
+func (p hashOf) Match(v driver.Value) bool {
+	hash, ok := v.(string)
+	return ok && bcrypt.CompareHashAndPassword([]byte(hash), []byte(p)) == nil
+}
+
+func testHasher() *hasher.Hasher {
+	return hasher.NewHasher(bcrypt.MinCost)
+}
+
 func TestUserHandler_NewUserPost_Success(t *testing.T) {
 	// Setup
 	db, dbMock := setupMockDB(t)
@@ -25,8 +43,8 @@ func TestUserHandler_NewUserPost_Success(t *testing.T) {
 	observedZapCore, observedLogs := observer.New(zap.DebugLevel)
 	logger := zap.New(observedZapCore)
 
-	userRepo := repository.NewUserRepository(db)
-	handler := NewUserHandler(userRepo, logger)
+	userRepo := repository.NewUserRepository(db, testHasher(), zap.NewNop())
+	handler := NewUserHandler(userRepo, testTokenManager(t), logger)
 
 	// Test data
 	newUser := models.User{
@@ -40,7 +58,7 @@ func TestUserHandler_NewUserPost_Success(t *testing.T) {
 
 	// Mock expectations
 	dbMock.ExpectQuery(`INSERT INTO users`).
-		WithArgs(newUser.Username, newUser.Password).
+		WithArgs(newUser.Username, hashOf(newUser.Password)).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).
 			AddRow(expectedResponse.Id, expectedResponse.Username))
 
@@ -72,8 +90,8 @@ func TestUserHandler_NewUserPost_InvalidMethod(t *testing.T) {
 	defer db.Close()
 
 	logger := zap.NewNop()
-	userRepo := repository.NewUserRepository(db)
-	handler := NewUserHandler(userRepo, logger)
+	userRepo := repository.NewUserRepository(db, testHasher(), zap.NewNop())
+	handler := NewUserHandler(userRepo, testTokenManager(t), logger)
 
 	// Create request with wrong method
 	req := httptest.NewRequest(http.MethodGet, "/users", nil)
@@ -92,8 +110,8 @@ func TestUserHandler_NewUserPost_InvalidContentType(t *testing.T) {
 	defer db.Close()
 
 	logger := zap.NewNop()
-	userRepo := repository.NewUserRepository(db)
-	handler := NewUserHandler(userRepo, logger)
+	userRepo := repository.NewUserRepository(db, testHasher(), zap.NewNop())
+	handler := NewUserHandler(userRepo, testTokenManager(t), logger)
 
 	// Create request with wrong content type
 	req := httptest.NewRequest(http.MethodPost, "/users", nil)
@@ -115,8 +133,8 @@ func TestUserHandler_NewUserPost_DecodeError(t *testing.T) {
 	observedZapCore, observedLogs := observer.New(zap.ErrorLevel)
 	logger := zap.New(observedZapCore)
 
-	userRepo := repository.NewUserRepository(db)
-	handler := NewUserHandler(userRepo, logger)
+	userRepo := repository.NewUserRepository(db, testHasher(), zap.NewNop())
+	handler := NewUserHandler(userRepo, testTokenManager(t), logger)
 
 	// Create request with invalid JSON
 	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader([]byte("{invalid}")))
@@ -127,10 +145,35 @@ func TestUserHandler_NewUserPost_DecodeError(t *testing.T) {
 	handler.NewUserPost(w, req)
 
 	// Verify
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Equal(t, 1, observedLogs.FilterMessage("Error decoding user").Len())
 }
 
+func TestUserHandler_NewUserPost_Invalid(t *testing.T) {
+	// Setup
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	userRepo := repository.NewUserRepository(db, testHasher(), zap.NewNop())
+	handler := NewUserHandler(userRepo, testTokenManager(t), zap.NewNop())
+
+	// Пустой пароль не доходит до базы
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader([]byte(`{"username": "testuser", "password": ""}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.NewUserPost(w, req)
+
+	// Verify
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var response apierror.Response
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, "validation_failed", response.Error.Code)
+	assert.Equal(t, []apierror.FieldError{{Field: "password", Message: "must not be empty"}}, response.Error.Fields)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
 func TestUserHandler_NewUserPost_DBError(t *testing.T) {
 	// Setup
 	db, dbMock := setupMockDB(t)
@@ -139,8 +182,8 @@ func TestUserHandler_NewUserPost_DBError(t *testing.T) {
 	observedZapCore, observedLogs := observer.New(zap.ErrorLevel)
 	logger := zap.New(observedZapCore)
 
-	userRepo := repository.NewUserRepository(db)
-	handler := NewUserHandler(userRepo, logger)
+	userRepo := repository.NewUserRepository(db, testHasher(), zap.NewNop())
+	handler := NewUserHandler(userRepo, testTokenManager(t), logger)
 
 	// Test data
 	newUser := models.User{
@@ -150,7 +193,7 @@ func TestUserHandler_NewUserPost_DBError(t *testing.T) {
 
 	// Mock expectations - return error
 	dbMock.ExpectQuery(`INSERT INTO users`).
-		WithArgs(newUser.Username, newUser.Password).
+		WithArgs(newUser.Username, hashOf(newUser.Password)).
 		WillReturnError(errors.New("database error"))
 
 	// Create request
@@ -168,6 +211,38 @@ func TestUserHandler_NewUserPost_DBError(t *testing.T) {
 	assert.Equal(t, 1, observedLogs.FilterMessage("Error creating new user").Len())
 }
 
+func TestUserHandler_NewUserPost_UsernameTaken(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	handler := NewUserHandler(repository.NewUserRepository(db, testHasher(), zap.NewNop()), testTokenManager(t), zap.NewNop())
+
+	newUser := models.User{
+		Username: "testuser",
+		Password: "testpass",
+	}
+
+	// Нарушение уникальности username
+	dbMock.ExpectQuery(`INSERT INTO users`).
+		WithArgs(newUser.Username, hashOf(newUser.Password)).
+		WillReturnError(&pq.Error{Code: "23505"})
+
+	body, _ := json.Marshal(newUser)
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.NewUserPost(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var response apierror.Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "conflict", response.Error.Code)
+	assert.Equal(t, "Username already taken", response.Error.Message)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
 func TestUserHandler_LoginIn_Success(t *testing.T) {
 	// Setup
 	db, dbMock := setupMockDB(t)
@@ -176,23 +251,24 @@ func TestUserHandler_LoginIn_Success(t *testing.T) {
 	observedZapCore, observedLogs := observer.New(zap.DebugLevel)
 	logger := zap.New(observedZapCore)
 
-	userRepo := repository.NewUserRepository(db)
-	handler := NewUserHandler(userRepo, logger)
+	userRepo := repository.NewUserRepository(db, testHasher(), zap.NewNop())
+	handler := NewUserHandler(userRepo, testTokenManager(t), logger)
 
 	// Test data
 	loginUser := models.User{
 		Username: "testuser",
 		Password: "testpass",
 	}
+	passwordHash, _ := testHasher().Hash(loginUser.Password)
 	dbUser := models.User{
 		Id:       1,
 		Username: "testuser",
-		Password: "testpass",
+		Password: passwordHash,
 	}
 
 	// Исправленный запрос - должен соответствовать тому, что в обработчике
-	dbMock.ExpectQuery(`SELECT \* FROM users WHERE username=\$1 AND password=\$2`).
-		WithArgs(loginUser.Username, loginUser.Password).
+	dbMock.ExpectQuery(`SELECT id, username, password FROM users WHERE username=\$1`).
+		WithArgs(loginUser.Username).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).
 			AddRow(dbUser.Id, dbUser.Username, dbUser.Password))
 
@@ -208,10 +284,11 @@ func TestUserHandler_LoginIn_Success(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.NoError(t, dbMock.ExpectationsWereMet())
 
-	var response map[string]string
+	var response jwt.TokenPair
 	err := json.NewDecoder(w.Body).Decode(&response)
 	assert.NoError(t, err)
-	assert.NotEmpty(t, response["token"])
+	assert.NotEmpty(t, response.AccessToken)
+	assert.NotEmpty(t, response.RefreshToken)
 
 	// Check logs
 	assert.Equal(t, 1, observedLogs.FilterMessage("User get request successfully handled").Len())
@@ -225,8 +302,8 @@ func TestUserHandler_LoginIn_UserNotFound(t *testing.T) {
 	observedZapCore, observedLogs := observer.New(zap.ErrorLevel)
 	logger := zap.New(observedZapCore)
 
-	userRepo := repository.NewUserRepository(db)
-	handler := NewUserHandler(userRepo, logger)
+	userRepo := repository.NewUserRepository(db, testHasher(), zap.NewNop())
+	handler := NewUserHandler(userRepo, testTokenManager(t), logger)
 
 	// Test data
 	loginUser := models.User{
@@ -235,8 +312,8 @@ func TestUserHandler_LoginIn_UserNotFound(t *testing.T) {
 	}
 
 	// Исправленный запрос
-	dbMock.ExpectQuery(`SELECT \* FROM users WHERE username=\$1 AND password=\$2`).
-		WithArgs(loginUser.Username, loginUser.Password).
+	dbMock.ExpectQuery(`SELECT id, username, password FROM users WHERE username=\$1`).
+		WithArgs(loginUser.Username).
 		WillReturnError(sql.ErrNoRows)
 
 	// Create request
@@ -248,9 +325,9 @@ func TestUserHandler_LoginIn_UserNotFound(t *testing.T) {
 	handler.LoginIn(w, req)
 
 	// Verify
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
 	assert.NoError(t, dbMock.ExpectationsWereMet())
-	assert.Equal(t, 1, observedLogs.FilterMessage("Error getting user by username").Len())
+	assert.Equal(t, 1, observedLogs.FilterMessage("Error authenticating user").Len())
 }
 
 func TestUserHandler_LoginIn_InvalidMethod(t *testing.T) {
@@ -259,8 +336,8 @@ func TestUserHandler_LoginIn_InvalidMethod(t *testing.T) {
 	defer db.Close()
 
 	logger := zap.NewNop()
-	userRepo := repository.NewUserRepository(db)
-	handler := NewUserHandler(userRepo, logger)
+	userRepo := repository.NewUserRepository(db, testHasher(), zap.NewNop())
+	handler := NewUserHandler(userRepo, testTokenManager(t), logger)
 
 	// Create request with wrong method
 	req := httptest.NewRequest(http.MethodPost, "/login", nil)
@@ -281,8 +358,8 @@ func TestUserHandler_LoginIn_DecodeError(t *testing.T) {
 	observedZapCore, observedLogs := observer.New(zap.ErrorLevel)
 	logger := zap.New(observedZapCore)
 
-	userRepo := repository.NewUserRepository(db)
-	handler := NewUserHandler(userRepo, logger)
+	userRepo := repository.NewUserRepository(db, testHasher(), zap.NewNop())
+	handler := NewUserHandler(userRepo, testTokenManager(t), logger)
 
 	// Create request with invalid JSON
 	req := httptest.NewRequest(http.MethodGet, "/login", bytes.NewReader([]byte("{invalid}")))
@@ -292,9 +369,25 @@ func TestUserHandler_LoginIn_DecodeError(t *testing.T) {
 	handler.LoginIn(w, req)
 
 	// Verify
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Equal(t, 1, observedLogs.FilterMessage("Error decoding user").Len())
 }
 
-// Helper to mock jwt.GenerateToken
-var jwtGenerate = jwt.GenerateToken
+func TestUserHandler_RegisterThenLogin_PaddedUsername(t *testing.T) {
+	handler := NewUserHandler(memory.New(nil, testHasher(), zap.NewNop()), testTokenManager(t), zap.NewNop())
+
+	body := `{"username": " bob", "password": "password1"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/api/registration", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.NewUserPost(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"username":"bob"`)
+
+	// Вход с тем же именем с пробелом проходит
+	req = httptest.NewRequest(http.MethodGet, "/api/login", bytes.NewBufferString(body))
+	w = httptest.NewRecorder()
+	handler.LoginIn(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
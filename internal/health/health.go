@@ -0,0 +1,119 @@
+// Package health serves the liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds every readiness check.
+const DefaultTimeout = 2 * time.Second
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check reports whether a dependency can serve requests.
+type Check func(ctx context.Context) error
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Response struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker runs the named readiness checks.
+type Checker struct {
+	timeout time.Duration
+	names   []string
+	checks  map[string]Check
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{timeout: timeout, checks: map[string]Check{}}
+}
+
+// Add registers check under name, replacing a check of the same name.
+func (c *Checker) Add(name string, check Check) {
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Run runs every check at once, each bounded by the checker timeout, and
+// reports whether all of them passed.
+func (c *Checker) Run(ctx context.Context) Response {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make(map[string]CheckResult, len(c.names))
+	)
+
+	for _, name := range c.names {
+		wg.Add(1)
+
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			result := CheckResult{Status: StatusOK}
+			if err := check(ctx); err != nil {
+				result = CheckResult{Status: StatusUnavailable, Error: err.Error()}
+			}
+
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, c.checks[name])
+	}
+
+	wg.Wait()
+
+	response := Response{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status != StatusOK {
+			response.Status = StatusUnavailable
+		}
+	}
+
+	return response
+}
+
+// Liveness answers 200 as long as the process can serve HTTP at all.
+func (c *Checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, http.StatusOK, Response{Status: StatusOK})
+}
+
+// Readiness answers 200 when every check passed and 503 otherwise, with
+// the status of each dependency.
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	response := c.Run(r.Context())
+
+	status := http.StatusOK
+	if response.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeResponse(w, status, response)
+}
+
+func writeResponse(w http.ResponseWriter, status int, response Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,56 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker_Readiness(t *testing.T) {
+	checker := NewChecker(50 * time.Millisecond)
+	checker.Add("postgres", func(ctx context.Context) error { return nil })
+
+	w := httptest.NewRecorder()
+	checker.Readiness(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status": "ok", "checks": {"postgres": {"status": "ok"}}}`, w.Body.String())
+
+	checker.Add("redis", func(ctx context.Context) error { return errors.New("connection refused") })
+	// Зависшая проверка прерывается по таймауту
+	checker.Add("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	w = httptest.NewRecorder()
+	checker.Readiness(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	var resp Response
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, StatusUnavailable, resp.Status)
+	assert.Equal(t, CheckResult{Status: StatusOK}, resp.Checks["postgres"])
+	assert.Equal(t, CheckResult{Status: StatusUnavailable, Error: "connection refused"}, resp.Checks["redis"])
+	assert.Equal(t, CheckResult{Status: StatusUnavailable, Error: context.DeadlineExceeded.Error()}, resp.Checks["worker"])
+}
+
+func TestChecker_Liveness(t *testing.T) {
+	checker := NewChecker(0)
+	checker.Add("postgres", func(ctx context.Context) error { return errors.New("down") })
+
+	// Liveness не зависит от внешних сервисов
+	w := httptest.NewRecorder()
+	checker.Liveness(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status": "ok"}`, w.Body.String())
+}
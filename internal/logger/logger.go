@@ -2,24 +2,139 @@ package logger
 
 import (
 	"Brocker-pet-project/internal/config"
+	"fmt"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"os"
+	"time"
 )
 
-func InitLogger(cfg *config.Config) (*zap.Logger, error) {
+// defaultMaxSizeMB is the size a log file is rotated at when none is set.
+const defaultMaxSizeMB = 100
 
-	switch cfg.Env {
-	case "dev":
-		cfg := zap.NewDevelopmentConfig()
-		cfg.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
-		return cfg.Build()
-	case "prod":
-		cfg := zap.NewProductionConfig()
-		cfg.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
-		return cfg.Build()
-	default: //local
-		cfg := zap.NewDevelopmentConfig()
-		cfg.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
-		return cfg.Build()
+// prodSampling is the sampling of zap's production preset, kept as the
+// default in prod.
+var prodSampling = config.LogSampling{Initial: 100, Thereafter: 100}
+
+// InitLogger builds the logger described by cfg.Log. Fields left empty take
+// the defaults of cfg.Env: debug level, console encoding and no sampling in
+// dev and local; info level, JSON and sampling at 100/100 in prod. The
+// returned level changes the level of the logger while it runs.
+func InitLogger(cfg *config.Config) (*zap.Logger, zap.AtomicLevel, error) {
+	development := cfg.Env != "prod"
+
+	level := zap.NewAtomicLevelAt(zap.DebugLevel)
+	if !development {
+		level.SetLevel(zap.InfoLevel)
+	}
+	if cfg.Log.Level != "" {
+		l, err := zapcore.ParseLevel(cfg.Log.Level)
+		if err != nil {
+			return nil, level, err
+		}
+		level.SetLevel(l)
+	}
+
+	encoder, err := newEncoder(cfg.Log.Encoding, development)
+	if err != nil {
+		return nil, level, err
+	}
+
+	output, err := newOutput(cfg.Log)
+	if err != nil {
+		return nil, level, err
+	}
+
+	sampling, err := newSampling(cfg.Log.Sampling, development)
+	if err != nil {
+		return nil, level, err
+	}
+
+	core := zapcore.NewCore(encoder, output, level)
+	if sampling.Initial > 0 {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, sampling.Initial, sampling.Thereafter)
+	}
+
+	opts := []zap.Option{zap.AddCaller(), zap.ErrorOutput(zapcore.Lock(os.Stderr))}
+	if development {
+		opts = append(opts, zap.Development(), zap.AddStacktrace(zap.WarnLevel))
+	} else {
+		opts = append(opts, zap.AddStacktrace(zap.ErrorLevel))
+	}
+
+	return zap.New(core, opts...), level, nil
+}
+
+func newEncoder(encoding string, development bool) (zapcore.Encoder, error) {
+	encoderCfg := zap.NewProductionEncoderConfig()
+	if development {
+		encoderCfg = zap.NewDevelopmentEncoderConfig()
+	}
+
+	if encoding == "" {
+		encoding = config.LogJSON
+		if development {
+			encoding = config.LogConsole
+		}
+	}
+
+	switch encoding {
+	case config.LogJSON:
+		return zapcore.NewJSONEncoder(encoderCfg), nil
+	case config.LogConsole:
+		return zapcore.NewConsoleEncoder(encoderCfg), nil
+	default:
+		return nil, fmt.Errorf("unknown log encoding %q", encoding)
+	}
+}
+
+// newSampling returns the sampling to apply; Initial is 0 when entries are
+// not sampled.
+func newSampling(sampling config.LogSampling, development bool) (config.LogSampling, error) {
+	switch {
+	case sampling.Initial < 0:
+		return config.LogSampling{}, nil
+	case sampling.Initial == 0 && development:
+		return config.LogSampling{}, nil
+	case sampling.Initial == 0:
+		return prodSampling, nil
+	case sampling.Thereafter <= 0:
+		return sampling, fmt.Errorf("log sampling thereafter must be positive, got %d", sampling.Thereafter)
+	default:
+		return sampling, nil
+	}
+}
+
+// newOutput opens every output path and the rotated log file.
+func newOutput(cfg config.Log) (zapcore.WriteSyncer, error) {
+	paths := cfg.OutputPaths
+	if len(paths) == 0 && cfg.File.Path == "" {
+		paths = []string{"stderr"}
+	}
+
+	var outputs []zapcore.WriteSyncer
+	if len(paths) > 0 {
+		sink, _, err := zap.Open(paths...)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, sink)
+	}
+
+	if cfg.File.Path != "" {
+		maxSize := cfg.File.MaxSizeMB
+		if maxSize == 0 {
+			maxSize = defaultMaxSizeMB
+		}
+		outputs = append(outputs, zapcore.AddSync(&lumberjack.Logger{
+			Filename:   cfg.File.Path,
+			MaxSize:    maxSize,
+			MaxAge:     cfg.File.MaxAgeDays,
+			MaxBackups: cfg.File.MaxBackups,
+			Compress:   cfg.File.Compress,
+		}))
 	}
 
+	return zapcore.NewMultiWriteSyncer(outputs...), nil
 }
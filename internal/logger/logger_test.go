@@ -2,6 +2,10 @@ package logger
 
 import (
 	"Brocker-pet-project/internal/config"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"go.uber.org/zap"
@@ -45,9 +49,10 @@ func TestInitLogger(t *testing.T) {
 
 			cfg := &config.Config{Env: tt.env}
 
-			logger, err := InitLogger(cfg)
+			logger, level, err := InitLogger(cfg)
 			require.NoError(t, err)
 			require.NotNil(t, logger)
+			assert.Equal(t, tt.expected, level.Level())
 
 			observedZapCore, observedLogs := observer.New(tt.expected)
 			observedLogger := zap.New(observedZapCore)
@@ -72,3 +77,114 @@ func TestInitLogger(t *testing.T) {
 		})
 	}
 }
+
+func TestInitLogger_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broker.log")
+	cfg := &config.Config{
+		Env: "prod",
+		Log: config.Log{
+			Level: "warn",
+			File:  config.LogFile{Path: path, MaxSizeMB: 1},
+		},
+	}
+
+	logger, level, err := InitLogger(cfg)
+	require.NoError(t, err)
+
+	logger.Info("info message")
+	logger.Warn("warn message", zap.String("key", "value"))
+
+	// Уровень меняется без пересоздания логгера
+	level.SetLevel(zap.InfoLevel)
+	logger.Info("info after level change")
+	require.NoError(t, logger.Sync())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "warn message", entry["msg"])
+	assert.Equal(t, "value", entry["key"])
+	assert.Contains(t, lines[1], "info after level change")
+}
+
+func TestInitLogger_Sampling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broker.log")
+	cfg := &config.Config{
+		Env: "prod",
+		Log: config.Log{
+			OutputPaths: []string{path},
+			Sampling:    config.LogSampling{Initial: 2, Thereafter: 100},
+		},
+	}
+
+	logger, _, err := InitLogger(cfg)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		logger.Info("repeated message")
+	}
+	require.NoError(t, logger.Sync())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	// Записаны только первые два одинаковых сообщения
+	assert.Equal(t, 2, strings.Count(string(content), "repeated message"))
+}
+
+func TestInitLogger_SamplingDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		sampling config.LogSampling
+		written  int
+	}{
+		{name: "prod samples at 100/100", env: "prod", written: 100},
+		{name: "prod sampling disabled", env: "prod", sampling: config.LogSampling{Initial: -1}, written: 150},
+		{name: "local does not sample", env: "local", written: 150},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "broker.log")
+			cfg := &config.Config{
+				Env: tt.env,
+				Log: config.Log{OutputPaths: []string{path}, Sampling: tt.sampling},
+			}
+
+			logger, _, err := InitLogger(cfg)
+			require.NoError(t, err)
+
+			for i := 0; i < 150; i++ {
+				logger.Info("repeated message")
+			}
+			require.NoError(t, logger.Sync())
+
+			content, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.written, strings.Count(string(content), "repeated message"))
+		})
+	}
+}
+
+func TestInitLogger_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		log  config.Log
+	}{
+		{name: "unknown level", log: config.Log{Level: "verbose"}},
+		{name: "unknown encoding", log: config.Log{Encoding: "xml"}},
+		{name: "sampling without thereafter", log: config.Log{Sampling: config.LogSampling{Initial: 10}}},
+		{name: "unopenable output", log: config.Log{OutputPaths: []string{filepath.Join(t.TempDir(), "missing", "broker.log")}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := InitLogger(&config.Config{Env: "local", Log: tt.log})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTP(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(HTTP)
+	r.Get("/api/deals/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.Handle("/metrics", Handler())
+
+	found := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/api/deals/{id}", "404"))
+	unmatched := testutil.ToFloat64(httpRequests.WithLabelValues("GET", unmatchedRoute, "404"))
+
+	// Идентификатор сделки не должен попадать в метку маршрута
+	for _, path := range []string{"/api/deals/1", "/api/deals/2", "/no/such/route"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, found+2, testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/api/deals/{id}", "404")))
+	assert.Equal(t, unmatched+1, testutil.ToFloat64(httpRequests.WithLabelValues("GET", unmatchedRoute, "404")))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `broker_http_request_duration_seconds_count{method="GET",route="/api/deals/{id}"} `)
+	assert.Contains(t, body, "broker_worker_backlog_deals")
+}
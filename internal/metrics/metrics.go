@@ -0,0 +1,98 @@
+// Package metrics holds the Prometheus collectors of the service and the
+// /metrics handler exposing them.
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"net/http"
+)
+
+const namespace = "broker"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by method, chi route pattern and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method and chi route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// WorkerBatchDeals observes how many deals a DealWorker batch processed.
+	WorkerBatchDeals = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "batch_deals",
+		Help:      "Deals processed per worker batch.",
+		Buckets:   []float64{0, 1, 5, 10, 25, 50, 100, 250, 500},
+	})
+
+	// WorkerBatchDuration observes how long a DealWorker batch took.
+	WorkerBatchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "batch_duration_seconds",
+		Help:      "Duration of worker batches.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// WorkerBatchFailures counts batches stopped by a database error.
+	WorkerBatchFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "batch_failures_total",
+		Help:      "Worker batches that failed with a database error.",
+	})
+
+	// WorkerBacklog is the number of pending deals left after the last batch.
+	WorkerBacklog = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "backlog_deals",
+		Help:      "Pending deals waiting to be processed.",
+	})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Redis cache lookups by cache and result: hit, miss or error.",
+	}, []string{"cache", "result"})
+)
+
+// Handler serves the collected metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterDB exposes the connection pool statistics of db.
+func RegisterDB(db *sql.DB) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, "postgres"))
+}
+
+// CacheLookup counts a Redis lookup of cache by the error Get returned: nil
+// is a hit, redis.Nil a miss, anything else an error. cache is the key
+// prefix, never the full key, to keep user ids out of the labels.
+func CacheLookup(cache string, err error) {
+	result := "hit"
+	switch {
+	case errors.Is(err, redis.Nil):
+		result = "miss"
+	case err != nil:
+		result = "error"
+	}
+	cacheRequests.WithLabelValues(cache, result).Inc()
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheLookup(t *testing.T) {
+	hits := testutil.ToFloat64(cacheRequests.WithLabelValues("allDeals:get", "hit"))
+	misses := testutil.ToFloat64(cacheRequests.WithLabelValues("allDeals:get", "miss"))
+	failures := testutil.ToFloat64(cacheRequests.WithLabelValues("allDeals:get", "error"))
+
+	CacheLookup("allDeals:get", nil)
+	CacheLookup("allDeals:get", redis.Nil)
+	CacheLookup("allDeals:get", errors.New("connection refused"))
+
+	assert.Equal(t, hits+1, testutil.ToFloat64(cacheRequests.WithLabelValues("allDeals:get", "hit")))
+	assert.Equal(t, misses+1, testutil.ToFloat64(cacheRequests.WithLabelValues("allDeals:get", "miss")))
+	assert.Equal(t, failures+1, testutil.ToFloat64(cacheRequests.WithLabelValues("allDeals:get", "error")))
+}
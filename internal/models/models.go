@@ -1,17 +1,95 @@
 package models
 
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
 type Deal struct {
-	Id       int64   `json:"id"`
-	Title    string  `json:"title"`
-	Expenses float64 `json:"expenses"`
-	Profit   float64 `json:"profit"`
-	Status   string  //"processed" or "not processed"
+	Id       int64           `json:"id"`
+	Title    string          `json:"title"`
+	Expenses decimal.Decimal `json:"expenses"`
+	Profit   decimal.Decimal `json:"profit"`
+	Currency string          `json:"currency"` // ISO 4217 code of Expenses and Profit
+	Status   string          //one of the Status* constants
+	UserId   int64           `json:"user_id"`
+}
+
+// DealPatch holds the deal fields a client may change; nil fields are kept.
+type DealPatch struct {
+	Title    *string          `json:"title"`
+	Expenses *decimal.Decimal `json:"expenses"`
+	Profit   *decimal.Decimal `json:"profit"`
+	Currency *string          `json:"currency"`
+}
+
+// DealFilter narrows and orders a deal listing. Zero values mean no filter.
+// Sort is a column name, optionally prefixed with "-" for descending order.
+type DealFilter struct {
+	Statuses    []string
+	Title       string // case-insensitive substring
+	MinExpenses *decimal.Decimal
+	MaxExpenses *decimal.Decimal
+	MinProfit   *decimal.Decimal
+	MaxProfit   *decimal.Decimal
+	CreatedFrom *time.Time // inclusive
+	CreatedTo   *time.Time // exclusive
+	Sort        string
+	Limit       int
+	Cursor      string
+}
+
+type DealPage struct {
+	Deals      []Deal `json:"deals"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// DealExport is a deal with the clear profit booked for it. The profit
+// fields are nil while the deal has not been processed.
+type DealExport struct {
+	Deal
+	CreatedAt         time.Time        `json:"created_at"`
+	ClearProfit       *decimal.Decimal `json:"clear_profit"`
+	ReportingProfit   *decimal.Decimal `json:"reporting_profit"`
+	ReportingCurrency *string          `json:"reporting_currency"`
+	FxRate            *decimal.Decimal `json:"fx_rate"`
+	BookedAt          *time.Time       `json:"booked_at"`
+}
+
+// DealImportError is a rejected row of a deal import. Row is the line of
+// the uploaded file the deal was read from.
+type DealImportError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// DealImportReport is the outcome of a deal import. Ids are in the order the
+// valid rows appear in the file; they are empty on a dry run.
+type DealImportReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Rows    int               `json:"rows"`
+	Created int               `json:"created"`
+	Ids     []int64           `json:"ids"`
+	Errors  []DealImportError `json:"errors"`
+}
+
+// DealStatusChange is a row of deal_status_history. FromStatus is empty for
+// the row written when the deal is created.
+type DealStatusChange struct {
+	Id         int64     `json:"id"`
+	DealId     int64     `json:"deal_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Actor      string    `json:"actor"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 type User struct {
 	Id       int64  `json:"id"`
 	Username string `json:"username"`
-	Password string `json:"password"` //in a real project, store a hash
+	Password string `json:"password"` //bcrypt hash when read from the database
 }
 
 type NewUserResponse struct {
@@ -24,8 +102,59 @@ type LogUserResponse struct {
 	Status   string `json:"status"`
 }
 
+// ProfitSQLDeal is a row of clear_profit. AllProfit is in the deal's
+// Currency; ReportingProfit is the same amount converted at FxRate.
 type ProfitSQLDeal struct {
-	Id        int64
-	DealId    int64
-	AllProfit float64
+	Id                int64
+	DealId            int64
+	UserId            int64
+	AllProfit         decimal.Decimal
+	Currency          string
+	ReportingProfit   decimal.Decimal
+	ReportingCurrency string
+	FxRate            decimal.Decimal
+}
+
+// FxRate is the price of one unit of Base in Quote from EffectiveAt until
+// the next rate of the same pair takes effect.
+type FxRate struct {
+	Base        string          `json:"base"`
+	Quote       string          `json:"quote"`
+	Rate        decimal.Decimal `json:"rate"`
+	EffectiveAt time.Time       `json:"effective_at"`
+}
+
+// ProfitRange limits a profit report to profit booked in [From, To). Nil
+// bounds are open.
+type ProfitRange struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// ProfitTotal is the clear profit booked in one reporting currency.
+type ProfitTotal struct {
+	Currency string          `json:"currency"`
+	Total    decimal.Decimal `json:"total"`
+	Deals    int64           `json:"deals"`
+}
+
+// ProfitPeriod is the clear profit booked in one day, week or month.
+// RunningTotal adds up Total of every period of the report up to this one.
+type ProfitPeriod struct {
+	Period       time.Time       `json:"period"`
+	Currency     string          `json:"currency"`
+	Total        decimal.Decimal `json:"total"`
+	Deals        int64           `json:"deals"`
+	RunningTotal decimal.Decimal `json:"running_total"`
+}
+
+// ProfitDeal is a booked deal as listed by the top and loss reports.
+type ProfitDeal struct {
+	DealId            int64           `json:"deal_id"`
+	Title             string          `json:"title"`
+	Profit            decimal.Decimal `json:"profit"`
+	Currency          string          `json:"currency"`
+	ReportingProfit   decimal.Decimal `json:"reporting_profit"`
+	ReportingCurrency string          `json:"reporting_currency"`
+	BookedAt          time.Time       `json:"booked_at"`
 }
@@ -0,0 +1,50 @@
+package models
+
+import "errors"
+
+const (
+	StatusDraft      = "draft"
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusProcessed  = "processed"
+	StatusFailed     = "failed"
+	StatusCancelled  = "cancelled"
+)
+
+// NotProcessedStatuses are the statuses of deals whose profit is not booked
+// and may still be, as listed by the legacy not-processed endpoint.
+var NotProcessedStatuses = []string{StatusDraft, StatusPending, StatusFailed}
+
+var ErrInvalidTransition = errors.New("invalid deal status transition")
+
+// transitions lists the statuses each status may move to. A deal is booked
+// into clear_profit only on the processing -> processed step; failed deals
+// can be queued again.
+var transitions = map[string][]string{
+	StatusDraft:      {StatusPending, StatusCancelled},
+	StatusPending:    {StatusProcessing, StatusCancelled},
+	StatusProcessing: {StatusProcessed, StatusFailed},
+	StatusFailed:     {StatusPending, StatusCancelled},
+}
+
+func IsValidStatus(status string) bool {
+	switch status {
+	case StatusDraft, StatusPending, StatusProcessing, StatusProcessed, StatusFailed, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEditable reports whether the deal fields may still be changed.
+func IsEditable(status string) bool {
+	return status == StatusDraft || status == StatusPending
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{StatusDraft, StatusPending, true},
+		{StatusDraft, StatusCancelled, true},
+		{StatusDraft, StatusProcessed, false},
+		{StatusPending, StatusProcessing, true},
+		{StatusPending, StatusCancelled, true},
+		{StatusPending, StatusProcessed, false},
+		{StatusProcessing, StatusProcessed, true},
+		{StatusProcessing, StatusFailed, true},
+		{StatusProcessing, StatusCancelled, false},
+		{StatusFailed, StatusPending, true},
+		{StatusProcessed, StatusCancelled, false},
+		{StatusProcessed, StatusPending, false},
+		{StatusCancelled, StatusPending, false},
+		{"not processed", StatusProcessing, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, CanTransition(tt.from, tt.to), "%s -> %s", tt.from, tt.to)
+	}
+}
+
+func TestIsValidStatus(t *testing.T) {
+	assert.True(t, IsValidStatus(StatusDraft))
+	assert.True(t, IsValidStatus(StatusCancelled))
+	assert.False(t, IsValidStatus("not processed"))
+	assert.False(t, IsValidStatus(""))
+}
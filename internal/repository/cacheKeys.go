@@ -0,0 +1,36 @@
+package repository
+
+import "fmt"
+
+// Deal listings are cached in Redis per user, so one user's writes never
+// serve stale or foreign data to another.
+
+func ProcessedDealsCacheKey(userId int64) string {
+	return fmt.Sprintf("processedDeals:all:%d", userId)
+}
+
+func NotProcessedDealsCacheKey(userId int64) string {
+	return fmt.Sprintf("notProcessedDeals:all:%d", userId)
+}
+
+func AllDealsCacheKey(userId int64) string {
+	return fmt.Sprintf("allDeals:get:%d", userId)
+}
+
+// DealCacheKeys returns every cached listing key of the user.
+func DealCacheKeys(userId int64) []string {
+	return []string{NotProcessedDealsCacheKey(userId), ProcessedDealsCacheKey(userId), AllDealsCacheKey(userId)}
+}
+
+// Profit reports take query parameters, so they are not deleted one by one.
+// Their keys carry a per-user version instead, which is bumped whenever new
+// profit is booked; reports cached under an old version are never read
+// again and expire on their own.
+
+func ReportVersionKey(userId int64) string {
+	return fmt.Sprintf("profitReports:version:%d", userId)
+}
+
+func ReportCacheKey(userId, version int64, report, params string) string {
+	return fmt.Sprintf("profitReports:%d:%d:%s:%s", userId, version, report, params)
+}
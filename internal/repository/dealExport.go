@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"Brocker-pet-project/internal/models"
+	"context"
+	"strconv"
+	"strings"
+)
+
+// ExportDeals streams every deal of userId matching filter to fn, joined with
+// its clear profit. Rows are handed over as they are read, so the listing is
+// never held in memory; an error returned by fn stops the export. Limit and
+// Cursor of filter are ignored.
+func (h *DealRepository) ExportDeals(ctx context.Context, userId int64, filter models.DealFilter, fn func(models.DealExport) error) error {
+	_, sortColumn, desc, err := parseDealSort(filter.Sort)
+	if err != nil {
+		return err
+	}
+
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	where := dealFilterConditions(userId, filter, arg)
+
+	query := `SELECT t.id, t.title, t.expenses, t.profit, t.currency, t.status, COALESCE(t.user_id, 0), t.created_at,
+	c.all_profit, c.reporting_profit, c.reporting_currency, c.fx_rate, c.booked_at
+	FROM (SELECT * FROM transactions WHERE ` + strings.Join(where, " AND ") + `) AS t
+	LEFT JOIN clear_profit c ON c.deals_id = t.id
+	ORDER BY ` + dealOrderBy(sortColumn.column, desc, "t.") + `;`
+
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return mapError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deal models.DealExport
+
+		if err := rows.Scan(&deal.Id, &deal.Title, &deal.Expenses, &deal.Profit, &deal.Currency, &deal.Status, &deal.UserId, &deal.CreatedAt,
+			&deal.ClearProfit, &deal.ReportingProfit, &deal.ReportingCurrency, &deal.FxRate, &deal.BookedAt); err != nil {
+			return mapError(err)
+		}
+
+		if err := fn(deal); err != nil {
+			return err
+		}
+	}
+
+	return mapError(rows.Err())
+}
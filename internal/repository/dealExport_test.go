@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"Brocker-pet-project/internal/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var dealExportColumns = []string{"id", "title", "expenses", "profit", "currency", "status", "user_id", "created_at",
+	"all_profit", "reporting_profit", "reporting_currency", "fx_rate", "booked_at"}
+
+func TestDealRepository_ExportDeals(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	repo := NewDealRepository(db, redisClient)
+
+	createdAt := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	bookedAt := createdAt.Add(time.Minute)
+
+	// Фильтры те же, что у листинга, но без курсора и LIMIT
+	mock.ExpectQuery(`FROM \(SELECT \* FROM transactions WHERE user_id=\$1 AND status IN \(\$2\)\) AS t LEFT JOIN clear_profit c ON c.deals_id = t.id ORDER BY t.profit DESC, t.id DESC;`).
+		WithArgs(int64(7), "processed").
+		WillReturnRows(sqlmock.NewRows(dealExportColumns).
+			AddRow(2, "Deal 2", "100", "250", "EUR", "processed", 7, createdAt, "150", "162.75", "USD", "1.085", bookedAt).
+			AddRow(1, "Deal 1", "10", "20", "USD", "processed", 7, createdAt, nil, nil, nil, nil, nil))
+
+	var deals []models.DealExport
+	err := repo.ExportDeals(context.Background(), 7, models.DealFilter{Statuses: []string{"processed"}, Sort: "-profit"}, func(deal models.DealExport) error {
+		deals = append(deals, deal)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, deals, 2)
+
+	assert.Equal(t, "EUR", deals[0].Currency)
+	require.NotNil(t, deals[0].ReportingProfit)
+	assert.Equal(t, "162.75", deals[0].ReportingProfit.String())
+	assert.Equal(t, bookedAt, *deals[0].BookedAt)
+
+	// Сделка без clear_profit выгружается с пустыми полями прибыли
+	assert.Nil(t, deals[1].ClearProfit)
+	assert.Nil(t, deals[1].ReportingCurrency)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDealRepository_ExportDeals_Stop(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	repo := NewDealRepository(db, redisClient)
+
+	createdAt := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`FROM \(SELECT \* FROM transactions WHERE user_id=\$1\) AS t`).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows(dealExportColumns).
+			AddRow(1, "Deal 1", "10", "20", "USD", "draft", 7, createdAt, nil, nil, nil, nil, nil).
+			AddRow(2, "Deal 2", "10", "20", "USD", "draft", 7, createdAt, nil, nil, nil, nil, nil))
+
+	// Ошибка колбэка прерывает выгрузку
+	errStop := errors.New("client gone")
+	calls := 0
+	err := repo.ExportDeals(context.Background(), 7, models.DealFilter{}, func(models.DealExport) error {
+		calls++
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, calls)
+
+	err = repo.ExportDeals(context.Background(), 7, models.DealFilter{Sort: "status"}, func(models.DealExport) error { return nil })
+	assert.ErrorIs(t, err, ErrInvalidSort)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"Brocker-pet-project/internal/models"
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// importBatchSize is the number of deals inserted per statement, keeping a
+// batch well under the 65535 parameters a statement may bind.
+const importBatchSize = 500
+
+// ImportDeals inserts deals for userId in batched multi-row inserts within a
+// single transaction, recording the creation of each in
+// deal_status_history. Either every deal is stored or none is. The deals
+// must already be validated; their ids are returned in order.
+func (h *DealRepository) ImportDeals(ctx context.Context, userId int64, deals []models.Deal) ([]int64, error) {
+	ids, err := h.importDeals(ctx, userId, deals)
+	return ids, mapError(err)
+}
+
+func (h *DealRepository) importDeals(ctx context.Context, userId int64, deals []models.Deal) ([]int64, error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int64, 0, len(deals))
+
+	for start := 0; start < len(deals); start += importBatchSize {
+		batch := deals[start:min(start+importBatchSize, len(deals))]
+
+		args := []any{userId, UserActor(userId)}
+		values := make([]string, len(batch))
+		for i, deal := range batch {
+			n := len(args)
+			args = append(args, deal.Title, deal.Expenses, deal.Profit, deal.Currency, deal.Status)
+			values[i] = "($" + strconv.Itoa(n+1) + ", $" + strconv.Itoa(n+2) + ", $" + strconv.Itoa(n+3) +
+				", $" + strconv.Itoa(n+4) + ", $" + strconv.Itoa(n+5) + ", $1)"
+		}
+
+		query := `WITH inserted AS (
+			INSERT INTO transactions (title, expenses, profit, currency, status, user_id)
+			VALUES ` + strings.Join(values, ", ") + `
+			RETURNING id, status
+		)
+		INSERT INTO deal_status_history (deal_id, to_status, actor, reason)
+		SELECT id, status, $2, 'imported' FROM inserted
+		RETURNING deal_id;`
+
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		batchIds := make([]int64, 0, len(batch))
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			batchIds = append(batchIds, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		// The ids come from the sequence in VALUES order, but RETURNING does
+		// not promise to keep it.
+		slices.Sort(batchIds)
+		ids = append(ids, batchIds...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"Brocker-pet-project/internal/models"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDealRepository_ImportDeals(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	repo := NewDealRepository(db, redisClient)
+
+	deals := []models.Deal{
+		{Title: "Deal 1", Expenses: decimal.NewFromInt(10), Profit: decimal.NewFromInt(20), Currency: "USD", Status: "pending"},
+		{Title: "Deal 2", Expenses: decimal.NewFromInt(5), Profit: decimal.NewFromInt(1), Currency: "EUR", Status: "draft"},
+	}
+
+	mock.ExpectBegin()
+	// Одна вставка на пачку, история статусов пишется тем же запросом
+	mock.ExpectQuery(`WITH inserted AS \( INSERT INTO transactions \(title, expenses, profit, currency, status, user_id\) VALUES \(\$3, \$4, \$5, \$6, \$7, \$1\), \(\$8, \$9, \$10, \$11, \$12, \$1\) RETURNING id, status \) INSERT INTO deal_status_history \(deal_id, to_status, actor, reason\) SELECT id, status, \$2, 'imported' FROM inserted RETURNING deal_id`).
+		WithArgs(int64(7), "user:7",
+			"Deal 1", decimal.NewFromInt(10), decimal.NewFromInt(20), "USD", "pending",
+			"Deal 2", decimal.NewFromInt(5), decimal.NewFromInt(1), "EUR", "draft").
+		WillReturnRows(sqlmock.NewRows([]string{"deal_id"}).AddRow(12).AddRow(11))
+	mock.ExpectCommit()
+
+	ids, err := repo.ImportDeals(context.Background(), 7, deals)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{11, 12}, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDealRepository_ImportDeals_Batches(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	repo := NewDealRepository(db, redisClient)
+
+	deals := make([]models.Deal, importBatchSize+1)
+	for i := range deals {
+		deals[i] = models.Deal{Title: fmt.Sprintf("Deal %d", i), Currency: "USD", Status: "pending"}
+	}
+
+	firstBatch := sqlmock.NewRows([]string{"deal_id"})
+	for i := range importBatchSize {
+		firstBatch.AddRow(i + 1)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO transactions`).WillReturnRows(firstBatch)
+	// Ошибка во второй пачке откатывает и первую
+	mock.ExpectQuery(`INSERT INTO transactions`).WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	ids, err := repo.ImportDeals(context.Background(), 7, deals)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Nil(t, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
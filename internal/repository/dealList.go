@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"Brocker-pet-project/internal/models"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultDealPageSize = 50
+	MaxDealPageSize     = 200
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort")
+)
+
+// dealSortColumns maps the sort options of ListDeals to their column and the
+// type a cursor value is cast back to.
+var dealSortColumns = map[string]struct{ column, cast string }{
+	"id":         {"id", "bigint"},
+	"created_at": {"created_at", "timestamptz"},
+	"title":      {"title", "text"},
+	"expenses":   {"expenses", "numeric"},
+	"profit":     {"profit", "numeric"},
+}
+
+// dealCursor points just after the last deal of a page. It carries the sort
+// it was issued for, so it cannot be replayed against a different order.
+type dealCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	Id    int64  `json:"id"`
+}
+
+func encodeDealCursor(cursor dealCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeDealCursor(s string) (dealCursor, error) {
+	var cursor dealCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// ListDeals returns one page of the deals owned by userId. Pages are read
+// with keyset pagination on (sort column, id), so a page costs the same no
+// matter how deep the cursor is.
+func (h *DealRepository) ListDeals(ctx context.Context, userId int64, filter models.DealFilter) (*models.DealPage, error) {
+	sort, sortColumn, desc, err := parseDealSort(filter.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultDealPageSize
+	}
+	limit = min(limit, MaxDealPageSize)
+
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	where := dealFilterConditions(userId, filter, arg)
+
+	comparison := ">"
+	if desc {
+		comparison = "<"
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := decodeDealCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != sort {
+			return nil, fmt.Errorf("%w: issued for sort %q", ErrInvalidCursor, cursor.Sort)
+		}
+
+		if sortColumn.column == "id" {
+			where = append(where, "id "+comparison+" "+arg(cursor.Id))
+		} else {
+			where = append(where, fmt.Sprintf("(%s, id) %s (%s::%s, %s)",
+				sortColumn.column, comparison, arg(cursor.Value), sortColumn.cast, arg(cursor.Id)))
+		}
+	}
+
+	orderBy := dealOrderBy(sortColumn.column, desc, "")
+
+	// One extra row tells whether there is a next page.
+	query := `SELECT ` + dealColumns + `, ` + sortColumn.column + `::text FROM transactions
+	WHERE ` + strings.Join(where, " AND ") + `
+	ORDER BY ` + orderBy + `
+	LIMIT ` + arg(limit+1) + `;`
+
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	page := &models.DealPage{Deals: []models.Deal{}}
+	var lastValue string
+
+	for rows.Next() {
+		var deal models.Deal
+		var sortValue string
+
+		if err := rows.Scan(&deal.Id, &deal.Title, &deal.Expenses, &deal.Profit, &deal.Currency, &deal.Status, &deal.UserId, &sortValue); err != nil {
+			return nil, mapError(err)
+		}
+
+		if len(page.Deals) == limit {
+			last := page.Deals[len(page.Deals)-1]
+			page.NextCursor = encodeDealCursor(dealCursor{Sort: sort, Value: lastValue, Id: last.Id})
+			break
+		}
+
+		page.Deals = append(page.Deals, deal)
+		lastValue = sortValue
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+
+	return page, nil
+}
+
+// parseDealSort splits a sort option such as "-profit" into its column and
+// direction. An empty sort orders by id.
+func parseDealSort(sort string) (string, struct{ column, cast string }, bool, error) {
+	if sort == "" {
+		sort = "id"
+	}
+	desc := strings.HasPrefix(sort, "-")
+	sortColumn, ok := dealSortColumns[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return sort, sortColumn, desc, fmt.Errorf("%w %q", ErrInvalidSort, sort)
+	}
+	return sort, sortColumn, desc, nil
+}
+
+// dealOrderBy orders by column with id as the tiebreaker, qualifying both
+// with prefix.
+func dealOrderBy(column string, desc bool, prefix string) string {
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+
+	orderBy := prefix + column + " " + direction
+	if column != "id" {
+		orderBy += ", " + prefix + "id " + direction
+	}
+	return orderBy
+}
+
+// dealFilterConditions returns the WHERE conditions of filter, except the
+// cursor, adding their values through arg.
+func dealFilterConditions(userId int64, filter models.DealFilter, arg func(any) string) []string {
+	where := []string{"user_id=" + arg(userId)}
+
+	if len(filter.Statuses) > 0 {
+		placeholders := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			placeholders[i] = arg(status)
+		}
+		where = append(where, "status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if filter.Title != "" {
+		where = append(where, `title ILIKE `+arg("%"+escapeLike(filter.Title)+"%"))
+	}
+	if filter.MinExpenses != nil {
+		where = append(where, "expenses >= "+arg(*filter.MinExpenses))
+	}
+	if filter.MaxExpenses != nil {
+		where = append(where, "expenses <= "+arg(*filter.MaxExpenses))
+	}
+	if filter.MinProfit != nil {
+		where = append(where, "profit >= "+arg(*filter.MinProfit))
+	}
+	if filter.MaxProfit != nil {
+		where = append(where, "profit <= "+arg(*filter.MaxProfit))
+	}
+	if filter.CreatedFrom != nil {
+		where = append(where, "created_at >= "+arg(*filter.CreatedFrom))
+	}
+	if filter.CreatedTo != nil {
+		where = append(where, "created_at < "+arg(*filter.CreatedTo))
+	}
+
+	return where
+}
+
+// listAll reads every page of a listing; it backs the legacy endpoints that
+// return all deals at once.
+func (h *DealRepository) listAll(ctx context.Context, userId int64, filter models.DealFilter) ([]models.Deal, error) {
+	filter.Limit = MaxDealPageSize
+
+	deals := []models.Deal{}
+
+	for {
+		page, err := h.ListDeals(ctx, userId, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		deals = append(deals, page.Deals...)
+
+		if page.NextCursor == "" {
+			return deals, nil
+		}
+		filter.Cursor = page.NextCursor
+	}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
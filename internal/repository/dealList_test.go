@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"Brocker-pet-project/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var dealListColumns = []string{"id", "title", "expenses", "profit", "currency", "status", "user_id", "sort_key"}
+
+func TestDealRepository_ListDeals_Pages(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	repo := NewDealRepository(db, redisClient)
+
+	// Первая страница: запрашиваем limit+1 строк, лишняя строка означает, что есть следующая страница
+	mock.ExpectQuery(`SELECT (.+), expenses::text FROM transactions WHERE user_id=\$1 ORDER BY expenses DESC, id DESC LIMIT \$2`).
+		WithArgs(int64(7), 3).
+		WillReturnRows(sqlmock.NewRows(dealListColumns).
+			AddRow(5, "Deal 5", 500, 900, "USD", "pending", 7, "500").
+			AddRow(3, "Deal 3", 300, 400, "USD", "pending", 7, "300").
+			AddRow(4, "Deal 4", 300, 100, "USD", "processed", 7, "300"))
+
+	page, err := repo.ListDeals(context.Background(), 7, models.DealFilter{Sort: "-expenses", Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, page.Deals, 2)
+	assert.Equal(t, int64(3), page.Deals[1].Id)
+	require.NotEmpty(t, page.NextCursor)
+
+	// Вторая страница продолжается после (300, 3)
+	mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE user_id=\$1 AND \(expenses, id\) < \(\$2::numeric, \$3\) ORDER BY expenses DESC, id DESC LIMIT \$4`).
+		WithArgs(int64(7), "300", int64(3), 3).
+		WillReturnRows(sqlmock.NewRows(dealListColumns).
+			AddRow(4, "Deal 4", 300, 100, "USD", "processed", 7, "300"))
+
+	page, err = repo.ListDeals(context.Background(), 7, models.DealFilter{Sort: "-expenses", Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Deal{{Id: 4, Title: "Deal 4", Expenses: decimal.NewFromInt(300), Profit: decimal.NewFromInt(100), Currency: "USD", Status: "processed", UserId: 7}}, page.Deals)
+	assert.Empty(t, page.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDealRepository_ListDeals_Filters(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	repo := NewDealRepository(db, redisClient)
+
+	minExpenses, maxProfit := decimal.NewFromInt(10), decimal.RequireFromString("1000.50")
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE user_id=\$1 AND status IN \(\$2, \$3\) AND title ILIKE \$4 AND expenses >= \$5 AND profit <= \$6 AND created_at >= \$7 AND created_at < \$8 ORDER BY created_at ASC, id ASC LIMIT \$9`).
+		WithArgs(int64(7), "pending", "failed", `%100\%%`, minExpenses, maxProfit, from, to, DefaultDealPageSize+1).
+		WillReturnRows(sqlmock.NewRows(dealListColumns))
+
+	page, err := repo.ListDeals(context.Background(), 7, models.DealFilter{
+		Statuses:    []string{"pending", "failed"},
+		Title:       "100%",
+		MinExpenses: &minExpenses,
+		MaxProfit:   &maxProfit,
+		CreatedFrom: &from,
+		CreatedTo:   &to,
+		Sort:        "created_at",
+	})
+	require.NoError(t, err)
+	assert.Empty(t, page.Deals)
+	assert.NotNil(t, page.Deals, "empty page should encode as [] rather than null")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDealRepository_ListDeals_InvalidInput(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	repo := NewDealRepository(db, redisClient)
+
+	_, err := repo.ListDeals(context.Background(), 7, models.DealFilter{Sort: "status"})
+	assert.ErrorIs(t, err, ErrInvalidSort)
+
+	_, err = repo.ListDeals(context.Background(), 7, models.DealFilter{Cursor: "not a cursor!"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// Курсор, выданный для другой сортировки
+	cursor := encodeDealCursor(dealCursor{Sort: "profit", Value: "10", Id: 1})
+	_, err = repo.ListDeals(context.Background(), 7, models.DealFilter{Sort: "-profit", Cursor: cursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, `50\% off\_sale\\x`, escapeLike(`50% off_sale\x`))
+}
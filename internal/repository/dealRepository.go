@@ -1,14 +1,28 @@
 package repository
 
 import (
+	"Brocker-pet-project/internal/fx"
 	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/pkg/money"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/redis/go-redis/v9"
-	"log"
+	"github.com/shopspring/decimal"
 )
 
+var (
+	ErrDealNotFound  = fmt.Errorf("deal %w", ErrNotFound)
+	ErrDealImmutable = fmt.Errorf("%w: deal can no longer be changed", ErrConflict)
+
+	ErrNoDealsToProcess = errors.New("no deals to process")
+)
+
+// dealColumns is the column list every deal query selects or returns,
+// in the order scanDeal expects.
+const dealColumns = `id, title, expenses, profit, currency, status, COALESCE(user_id, 0)`
+
 type DealRepository struct {
 	db    *sql.DB
 	redis *redis.Client
@@ -18,150 +32,324 @@ func NewDealRepository(db *sql.DB, redis *redis.Client) *DealRepository {
 	return &DealRepository{db: db, redis: redis}
 }
 
-func (h *DealRepository) CreateNewDeal(title string, expenses, profit float64) *models.Deal {
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDeal(row rowScanner, deal *models.Deal) error {
+	return row.Scan(&deal.Id, &deal.Title, &deal.Expenses, &deal.Profit, &deal.Currency, &deal.Status, &deal.UserId)
+}
+
+// CreateNewDeal inserts a deal in the draft or pending status and records
+// its creation in deal_status_history.
+func (h *DealRepository) CreateNewDeal(ctx context.Context, userId int64, title string, expenses, profit decimal.Decimal, currency, status string) (*models.Deal, error) {
 
 	query := `INSERT INTO transactions 
-    (title, expenses, profit, status) 
-	VALUES ($1, $2, $3, $4)
-	RETURNING id, title, expenses, profit, status;`
+    (title, expenses, profit, currency, status, user_id) 
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING ` + dealColumns + `;`
 
-	req := h.db.QueryRow(query, title, expenses, profit, "not processed")
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer tx.Rollback()
 
 	var deal models.Deal
 
-	if err := req.Scan(&deal.Id, &deal.Title, &deal.Expenses, &deal.Profit, &deal.Status); err != nil {
-		log.Printf("Error scaning sql response: %v", err)
-		return nil
+	if err := scanDeal(tx.QueryRowContext(ctx, query, title, expenses, profit, currency, status, userId), &deal); err != nil {
+		return nil, mapError(err)
 	}
 
-	if deal.Id == 0 {
-		log.Printf("Error inserting new deal: %v", deal)
-		return nil
+	if err := recordStatusChange(ctx, tx, deal.Id, "", deal.Status, UserActor(userId), "created"); err != nil {
+		return nil, mapError(err)
 	}
 
-	return &deal
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+
+	return &deal, nil
 }
 
-func (h *DealRepository) GetAllProcessedDeals(ctx context.Context) *[]models.Deal {
+// GetDealById returns a deal owned by userId.
+func (h *DealRepository) GetDealById(ctx context.Context, userId, id int64) (*models.Deal, error) {
+	query := `SELECT ` + dealColumns + ` FROM transactions WHERE id=$1 AND user_id=$2;`
 
-	query := `SELECT * FROM transactions WHERE status=$1;`
+	var deal models.Deal
 
-	rows, err := h.db.QueryContext(ctx, query, "processed")
+	err := scanDeal(h.db.QueryRowContext(ctx, query, id, userId), &deal)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDealNotFound
+	}
 	if err != nil {
-		log.Printf("Error reading sql response: %v", err)
-		return nil
+		return nil, mapError(err)
 	}
-	defer rows.Close()
 
-	var deals []models.Deal
+	return &deal, nil
+}
 
-	for rows.Next() {
-		var deal models.Deal
+// UpdateDeal applies the non-nil fields of patch to a deal that is still a
+// draft or pending. Once the worker has picked a deal up it cannot change.
+func (h *DealRepository) UpdateDeal(ctx context.Context, userId, id int64, patch models.DealPatch) (*models.Deal, error) {
+	query := `UPDATE transactions
+	SET title=COALESCE($1, title), expenses=COALESCE($2, expenses), profit=COALESCE($3, profit),
+	currency=COALESCE($4, currency)
+	WHERE id=$5 AND user_id=$6 AND status IN ($7, $8)
+	RETURNING ` + dealColumns + `;`
+
+	row := h.db.QueryRowContext(ctx, query, patch.Title, patch.Expenses, patch.Profit, patch.Currency, id, userId,
+		models.StatusDraft, models.StatusPending)
+
+	return h.changedDeal(ctx, userId, id, row)
+}
 
-		if err := rows.Scan(&deal.Id, &deal.Title, &deal.Expenses, &deal.Profit, &deal.Status); err != nil {
-			log.Printf("Error reading sql response: %v", err)
-			return nil
+// DeleteDeal removes a deal that has not been booked into clear_profit.
+func (h *DealRepository) DeleteDeal(ctx context.Context, userId, id int64) error {
+	query := `DELETE FROM transactions
+	WHERE id=$1 AND user_id=$2 AND status NOT IN ($3, $4)
+	RETURNING ` + dealColumns + `;`
+
+	row := h.db.QueryRowContext(ctx, query, id, userId, models.StatusProcessing, models.StatusProcessed)
+
+	_, err := h.changedDeal(ctx, userId, id, row)
+	return err
+}
+
+// changedDeal scans the row returned by a guarded UPDATE or DELETE. When no
+// row matched it looks the deal up again to tell a missing deal from one
+// that can no longer change, and invalidates the owner's deal caches on
+// success.
+func (h *DealRepository) changedDeal(ctx context.Context, userId, id int64, row *sql.Row) (*models.Deal, error) {
+	var deal models.Deal
+
+	err := scanDeal(row, &deal)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := h.GetDealById(ctx, userId, id); err != nil {
+			return nil, err
 		}
+		return nil, ErrDealImmutable
+	}
+	if err != nil {
+		return nil, mapError(err)
+	}
 
-		deals = append(deals, deal)
+	h.invalidate(ctx, userId, false)
 
+	return &deal, nil
+}
+
+// ChangeDealStatus moves a deal owned by userId to status `to`, rejecting
+// transitions models.CanTransition does not allow.
+func (h *DealRepository) ChangeDealStatus(ctx context.Context, userId, id int64, to, actor, reason string) (*models.Deal, error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer tx.Rollback()
+
+	deal, err := lockDeal(ctx, tx, userId, id)
+	if err != nil {
+		return nil, mapError(err)
 	}
 
-	if rows.Err() != nil {
-		log.Printf("Error reqqading sql response: %v", rows.Err())
-		return nil
+	if err := transition(ctx, tx, deal, to, actor, reason); err != nil {
+		return nil, mapError(err)
 	}
 
-	return &deals
+	if err := tx.Commit(); err != nil {
+		return nil, mapError(err)
+	}
+
+	h.invalidate(ctx, deal.UserId, false)
+
+	return deal, nil
 }
 
-func (h *DealRepository) GetAllNotProcessedDeals(ctx context.Context) *[]models.Deal {
+// GetDealHistory returns the status changes of a deal owned by userId,
+// oldest first.
+func (h *DealRepository) GetDealHistory(ctx context.Context, userId, id int64) ([]models.DealStatusChange, error) {
+	if _, err := h.GetDealById(ctx, userId, id); err != nil {
+		return nil, err
+	}
 
-	query := `SELECT * FROM transactions WHERE status=$1;`
+	query := `SELECT id, deal_id, COALESCE(from_status, ''), to_status, actor, reason, created_at
+	FROM deal_status_history WHERE deal_id=$1 ORDER BY id;`
 
-	rows, err := h.db.QueryContext(ctx, query, "not processed")
+	rows, err := h.db.QueryContext(ctx, query, id)
 	if err != nil {
-		log.Printf("Error reading sql response: %v", err)
-		return nil
+		return nil, mapError(err)
 	}
 	defer rows.Close()
 
-	var deals []models.Deal
+	history := []models.DealStatusChange{}
 
 	for rows.Next() {
-		var deal models.Deal
-
-		if err := rows.Scan(&deal.Id, &deal.Title, &deal.Expenses, &deal.Profit, &deal.Status); err != nil {
-			log.Printf("Error reading sql response: %v", err)
-			return nil
+		var change models.DealStatusChange
+		if err := rows.Scan(&change.Id, &change.DealId, &change.FromStatus, &change.ToStatus,
+			&change.Actor, &change.Reason, &change.CreatedAt); err != nil {
+			return nil, mapError(err)
 		}
-
-		deals = append(deals, deal)
-
+		history = append(history, change)
 	}
 
-	if rows.Err() != nil {
-		log.Printf("Error reqqading sql response: %v", rows.Err())
-		return nil
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
 	}
 
-	return &deals
+	return history, nil
+}
+
+func (h *DealRepository) GetAllProcessedDeals(ctx context.Context, userId int64) ([]models.Deal, error) {
+	return h.listAll(ctx, userId, models.DealFilter{Statuses: []string{models.StatusProcessed}})
 }
 
-func (h *DealRepository) GetAllDeals(ctx context.Context) *[]models.Deal {
-	query := `SELECT * FROM transactions WHERE id!=0;`
+func (h *DealRepository) GetAllNotProcessedDeals(ctx context.Context, userId int64) ([]models.Deal, error) {
+	return h.listAll(ctx, userId, models.DealFilter{Statuses: models.NotProcessedStatuses})
+}
+
+func (h *DealRepository) GetAllDeals(ctx context.Context, userId int64) ([]models.Deal, error) {
+	return h.listAll(ctx, userId, models.DealFilter{})
+}
+
+// ProcessNextDeal claims the oldest pending deal and books its profit in a
+// single transaction: pending -> processing -> processed, with the
+// clear_profit row written in between. The profit is booked in the deal
+// currency and in reportingCurrency at the rate in effect when the deal was
+// created. Rows locked by another worker are
+// skipped, so several replicas can process deals at once. When booking
+// fails for good, for example because no rate is known or the amount does
+// not fit, the deal is moved to failed instead, so it is not picked up
+// again. When the database is unavailable or ctx is done the transaction is
+// rolled back and the deal stays pending.
+// It returns ErrNoDealsToProcess when nothing is pending.
+func (h *DealRepository) ProcessNextDeal(ctx context.Context, reportingCurrency string, clearProfit func(models.Deal) decimal.Decimal) (*models.Deal, error) {
+	deal, err := h.processNextDeal(ctx, reportingCurrency, clearProfit)
+	return deal, mapError(err)
+}
 
-	rows, err := h.db.QueryContext(ctx, query)
+func (h *DealRepository) processNextDeal(ctx context.Context, reportingCurrency string, clearProfit func(models.Deal) decimal.Decimal) (*models.Deal, error) {
+	tx, err := h.db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("Error reading sql response: %v", err)
-		return nil
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	defer rows.Close()
+	query := `SELECT ` + dealColumns + ` FROM transactions
+	WHERE status=$1
+	ORDER BY id
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED;`
 
-	var deals []models.Deal
+	var deal models.Deal
 
-	for rows.Next() {
-		var deal models.Deal
+	err = scanDeal(tx.QueryRowContext(ctx, query, models.StatusPending), &deal)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoDealsToProcess
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		err := rows.Scan(&deal.Id, &deal.Title, &deal.Expenses, &deal.Profit, &deal.Status)
-		if err != nil {
-			fmt.Printf("Error reading sql response: %v", err)
-			return nil
-		}
+	if err := transition(ctx, tx, &deal, models.StatusProcessing, WorkerActor, ""); err != nil {
+		return nil, err
+	}
 
-		deals = append(deals, deal)
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT book_profit;`); err != nil {
+		return nil, err
+	}
 
+	bookErr := bookProfit(ctx, tx, deal, clearProfit(deal), reportingCurrency)
+	if errors.Is(bookErr, sql.ErrNoRows) {
+		// Booked by an earlier run that did not get to update the status.
+		bookErr = nil
 	}
 
-	return &deals
+	if isTransient(bookErr) {
+		// The deal stays pending for a later tick. Errors that would repeat,
+		// such as a missing rate or an overflow, fail the deal instead, or
+		// it would be claimed again on every tick.
+		return nil, mapError(bookErr)
+	}
 
-}
+	if bookErr != nil {
+		if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT book_profit;`); err != nil {
+			return nil, err
+		}
+		err = transition(ctx, tx, &deal, models.StatusFailed, WorkerActor, bookErr.Error())
+	} else {
+		err = transition(ctx, tx, &deal, models.StatusProcessed, WorkerActor, "")
+	}
+	if err != nil {
+		return nil, err
+	}
 
-func (h *DealRepository) MarkTransactionAsProcessed(id int64) *models.Deal {
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 
-	query := `UPDATE transactions 
-	SET status=$1
-	WHERE id=$2
-	RETURNING id, title, expenses, profit, status;`
+	h.invalidate(ctx, deal.UserId, deal.Status == models.StatusProcessed)
 
-	row := h.db.QueryRow(query, "processed", id)
+	return &deal, nil
+}
 
-	var deal models.Deal
+// CountPendingDeals returns how many deals of all users wait for the worker.
+func (h *DealRepository) CountPendingDeals(ctx context.Context) (int64, error) {
+	var count int64
+	err := h.db.QueryRowContext(ctx, `SELECT count(*) FROM transactions WHERE status=$1;`, models.StatusPending).Scan(&count)
+	if err != nil {
+		return 0, mapError(err)
+	}
 
-	if err := row.Scan(&deal.Id, &deal.Title, &deal.Expenses, &deal.Profit, &deal.Status); err != nil {
-		log.Printf("Error reading sql response: %v", err)
-		return nil
+	return count, nil
+}
+
+// invalidate drops the cached deal listings of userId after a committed
+// change, and the cached profit reports too when profit was booked. It is
+// not cancelled with ctx: the change is stored whether or not the caller is
+// still waiting, and stale caches would outlive the request.
+func (h *DealRepository) invalidate(ctx context.Context, userId int64, profitBooked bool) {
+	ctx = context.WithoutCancel(ctx)
+
+	h.redis.Del(ctx, DealCacheKeys(userId)...)
+	if profitBooked {
+		h.redis.Incr(ctx, ReportVersionKey(userId))
 	}
+}
 
-	if deal.Status != "processed" {
-		log.Printf("Error marking transaction as processed: %v", deal)
-		return &deal
+// ValidateBooking checks that the clear profit of a deal, and its value in
+// the reporting currency, fit the clear_profit columns.
+func ValidateBooking(profit, reportingProfit decimal.Decimal) error {
+	if err := money.Validate(profit); err != nil {
+		return fmt.Errorf("clear profit %s: %w", profit, err)
+	}
+	if err := money.Validate(reportingProfit); err != nil {
+		return fmt.Errorf("reporting profit %s: %w", reportingProfit, err)
 	}
+	return nil
+}
 
-	ctx := context.Background()
-	h.redis.Del(ctx, "notProcessedDeals:all", "processedDeals:all", "allDeals:get")
+// bookProfit converts the clear profit of a deal into reportingCurrency and
+// writes it to clear_profit.
+func bookProfit(ctx context.Context, tx *sql.Tx, deal models.Deal, profit decimal.Decimal, reportingCurrency string) error {
+	rate, err := dealRate(ctx, tx, deal.Currency, reportingCurrency, deal.Id)
+	if err != nil {
+		return err
+	}
 
-	return &deal
+	reportingProfit := fx.Convert(profit, rate)
+	if err := ValidateBooking(profit, reportingProfit); err != nil {
+		return err
+	}
 
+	_, err = insertProfit(ctx, tx, models.ProfitSQLDeal{
+		DealId:            deal.Id,
+		UserId:            deal.UserId,
+		AllProfit:         profit,
+		Currency:          deal.Currency,
+		ReportingProfit:   reportingProfit,
+		ReportingCurrency: reportingCurrency,
+		FxRate:            rate,
+	})
+	return err
 }
@@ -7,9 +7,12 @@ import (
 	"errors"
 	"github.com/redis/go-redis/v9"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-redis/redismock/v9"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,8 +39,8 @@ func TestDealRepository_CreateNewDeal(t *testing.T) {
 	tests := []struct {
 		name        string
 		title       string
-		expenses    float64
-		profit      float64
+		expenses    decimal.Decimal
+		profit      decimal.Decimal
 		mock        func()
 		expected    *models.Deal
 		expectError bool
@@ -45,33 +48,42 @@ func TestDealRepository_CreateNewDeal(t *testing.T) {
 		{
 			name:     "successful creation",
 			title:    "Test Deal",
-			expenses: 100,
-			profit:   200,
+			expenses: decimal.NewFromInt(100),
+			profit:   decimal.RequireFromString("200.25"),
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "status"}).
-					AddRow(1, "Test Deal", 100, 200, "not processed")
+				rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}).
+					AddRow(1, "Test Deal", "100", "200.25", "USD", "pending", 7)
+				mock.ExpectBegin()
 				mock.ExpectQuery(`INSERT INTO transactions`).
-					WithArgs("Test Deal", 100.0, 200.0, "not processed").
+					WithArgs("Test Deal", decimal.NewFromInt(100), decimal.RequireFromString("200.25"), "USD", "pending", int64(7)).
 					WillReturnRows(rows)
+				mock.ExpectExec(`INSERT INTO deal_status_history`).
+					WithArgs(int64(1), "", "pending", "user:7", "created").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
 			},
 			expected: &models.Deal{
 				Id:       1,
 				Title:    "Test Deal",
-				Expenses: 100,
-				Profit:   200,
-				Status:   "not processed",
+				Expenses: decimal.NewFromInt(100),
+				Profit:   decimal.RequireFromString("200.25"),
+				Currency: "USD",
+				Status:   "pending",
+				UserId:   7,
 			},
 			expectError: false,
 		},
 		{
 			name:     "database error",
 			title:    "Test Deal",
-			expenses: 100,
-			profit:   200,
+			expenses: decimal.NewFromInt(100),
+			profit:   decimal.RequireFromString("200.25"),
 			mock: func() {
+				mock.ExpectBegin()
 				mock.ExpectQuery(`INSERT INTO transactions`).
-					WithArgs("Test Deal", 100.0, 200.0, "not processed").
+					WithArgs("Test Deal", decimal.NewFromInt(100), decimal.RequireFromString("200.25"), "USD", "pending", int64(7)).
 					WillReturnError(errors.New("database error"))
+				mock.ExpectRollback()
 			},
 			expected:    nil,
 			expectError: true,
@@ -81,11 +93,13 @@ func TestDealRepository_CreateNewDeal(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mock()
-			result := repo.CreateNewDeal(tt.title, tt.expenses, tt.profit)
+			result, err := repo.CreateNewDeal(context.Background(), 7, tt.title, tt.expenses, tt.profit, "USD", models.StatusPending)
 
 			if tt.expectError {
+				assert.Error(t, err)
 				assert.Nil(t, result)
 			} else {
+				assert.NoError(t, err)
 				assert.Equal(t, tt.expected, result)
 			}
 
@@ -104,30 +118,31 @@ func TestDealRepository_GetAllNotProcessedDeals(t *testing.T) {
 	tests := []struct {
 		name        string
 		mock        func()
-		expected    *[]models.Deal
+		expected    []models.Deal
 		expectError bool
 	}{
 		{
 			name: "successful fetch",
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "status"}).
-					AddRow(1, "Deal 1", 100, 200, "not processed").
-					AddRow(2, "Deal 2", 150, 300, "not processed")
-				mock.ExpectQuery(`SELECT \* FROM transactions WHERE status=\$1`).
-					WithArgs("not processed").
+				rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id", "sort_key"}).
+					AddRow(1, "Deal 1", 100, 200, "USD", "pending", 7, "1").
+					AddRow(2, "Deal 2", 150, 300, "USD", "failed", 7, "2")
+				// Черновики и неудачные сделки тоже ещё не обработаны
+				mock.ExpectQuery(`SELECT id, title, expenses, profit, currency, status, COALESCE\(user_id, 0\), id::text FROM transactions WHERE user_id=\$1 AND status IN \(\$2, \$3, \$4\) ORDER BY id ASC LIMIT \$5`).
+					WithArgs(int64(7), "draft", "pending", "failed", MaxDealPageSize+1).
 					WillReturnRows(rows)
 			},
-			expected: &[]models.Deal{
-				{Id: 1, Title: "Deal 1", Expenses: 100, Profit: 200, Status: "not processed"},
-				{Id: 2, Title: "Deal 2", Expenses: 150, Profit: 300, Status: "not processed"},
+			expected: []models.Deal{
+				{Id: 1, Title: "Deal 1", Expenses: decimal.NewFromInt(100), Profit: decimal.NewFromInt(200), Currency: "USD", Status: "pending", UserId: 7},
+				{Id: 2, Title: "Deal 2", Expenses: decimal.NewFromInt(150), Profit: decimal.NewFromInt(300), Currency: "USD", Status: "failed", UserId: 7},
 			},
 			expectError: false,
 		},
 		{
 			name: "database error",
 			mock: func() {
-				mock.ExpectQuery(`SELECT \* FROM transactions WHERE status=\$1`).
-					WithArgs("not processed").
+				mock.ExpectQuery(`SELECT id, title, expenses, profit, currency, status, COALESCE\(user_id, 0\), id::text FROM transactions WHERE user_id=\$1 AND status IN \(\$2, \$3, \$4\) ORDER BY id ASC LIMIT \$5`).
+					WithArgs(int64(7), "draft", "pending", "failed", MaxDealPageSize+1).
 					WillReturnError(errors.New("database error"))
 			},
 			expected:    nil,
@@ -138,11 +153,13 @@ func TestDealRepository_GetAllNotProcessedDeals(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mock()
-			result := repo.GetAllNotProcessedDeals(context.Background())
+			result, err := repo.GetAllNotProcessedDeals(context.Background(), 7)
 
 			if tt.expectError {
+				assert.Error(t, err)
 				assert.Nil(t, result)
 			} else {
+				assert.NoError(t, err)
 				assert.Equal(t, tt.expected, result)
 			}
 
@@ -151,77 +168,49 @@ func TestDealRepository_GetAllNotProcessedDeals(t *testing.T) {
 	}
 }
 
-func TestDealRepository_MarkTransactionAsProcessed(t *testing.T) {
+func TestDealRepository_GetAllProcessedDeals(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
-	redisClient, redisMock := setupMockRedis()
+	redisClient, _ := setupMockRedis()
 
 	repo := NewDealRepository(db, redisClient)
 
 	tests := []struct {
 		name        string
-		id          int64
 		mock        func()
-		redisMock   func()
-		expected    *models.Deal
+		expected    []models.Deal
 		expectError bool
 	}{
 		{
-			name: "successful mark as processed",
-			id:   1,
+			name: "successful fetch",
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "status"}).
-					AddRow(1, "Deal 1", 100, 200, "processed")
-				mock.ExpectQuery(`UPDATE transactions`).
-					WithArgs("processed", int64(1)).
+				rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id", "sort_key"}).
+					AddRow(1, "Deal 1", 100, 200, "USD", "processed", 7, "1").
+					AddRow(2, "Deal 2", 150, 300, "USD", "processed", 7, "2")
+				mock.ExpectQuery(`SELECT id, title, expenses, profit, currency, status, COALESCE\(user_id, 0\), id::text FROM transactions WHERE user_id=\$1 AND status IN \(\$2\) ORDER BY id ASC LIMIT \$3`).
+					WithArgs(int64(7), "processed", MaxDealPageSize+1).
 					WillReturnRows(rows)
 			},
-			redisMock: func() {
-				redisMock.ExpectDel("notProcessedDeals:all", "processedDeals:all", "allDeals:get").SetVal(1)
-			},
-			expected: &models.Deal{
-				Id:       1,
-				Title:    "Deal 1",
-				Expenses: 100,
-				Profit:   200,
-				Status:   "processed",
+			expected: []models.Deal{
+				{Id: 1, Title: "Deal 1", Expenses: decimal.NewFromInt(100), Profit: decimal.NewFromInt(200), Currency: "USD", Status: "processed", UserId: 7},
+				{Id: 2, Title: "Deal 2", Expenses: decimal.NewFromInt(150), Profit: decimal.NewFromInt(300), Currency: "USD", Status: "processed", UserId: 7},
 			},
 			expectError: false,
 		},
-		{
-			name: "database error",
-			id:   1,
-			mock: func() {
-				mock.ExpectQuery(`UPDATE transactions`).
-					WithArgs("processed", int64(1)).
-					WillReturnError(errors.New("database error"))
-			},
-			redisMock:   func() {},
-			expected:    nil,
-			expectError: true,
-		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mock()
-			tt.redisMock()
-
-			result := repo.MarkTransactionAsProcessed(tt.id)
-
-			if tt.expectError {
-				assert.Nil(t, result)
-			} else {
-				assert.Equal(t, tt.expected, result)
-				assert.NoError(t, redisMock.ExpectationsWereMet())
-			}
-
+			result, err := repo.GetAllProcessedDeals(context.Background(), 7)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
 			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
 
-func TestDealRepository_GetAllProcessedDeals(t *testing.T) {
+func TestDealRepository_GetAllDeals(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 	redisClient, _ := setupMockRedis()
@@ -231,22 +220,22 @@ func TestDealRepository_GetAllProcessedDeals(t *testing.T) {
 	tests := []struct {
 		name        string
 		mock        func()
-		expected    *[]models.Deal
+		expected    []models.Deal
 		expectError bool
 	}{
 		{
 			name: "successful fetch",
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "status"}).
-					AddRow(1, "Deal 1", 100, 200, "processed").
-					AddRow(2, "Deal 2", 150, 300, "processed")
-				mock.ExpectQuery(`SELECT \* FROM transactions WHERE status=\$1`).
-					WithArgs("processed").
+				rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id", "sort_key"}).
+					AddRow(1, "Deal 1", 100, 200, "USD", "processed", 7, "1").
+					AddRow(2, "Deal 2", 150, 300, "USD", "pending", 7, "2")
+				mock.ExpectQuery(`SELECT id, title, expenses, profit, currency, status, COALESCE\(user_id, 0\), id::text FROM transactions WHERE user_id=\$1 ORDER BY id ASC LIMIT \$2`).
+					WithArgs(int64(7), MaxDealPageSize+1).
 					WillReturnRows(rows)
 			},
-			expected: &[]models.Deal{
-				{Id: 1, Title: "Deal 1", Expenses: 100, Profit: 200, Status: "processed"},
-				{Id: 2, Title: "Deal 2", Expenses: 150, Profit: 300, Status: "processed"},
+			expected: []models.Deal{
+				{Id: 1, Title: "Deal 1", Expenses: decimal.NewFromInt(100), Profit: decimal.NewFromInt(200), Currency: "USD", Status: "processed", UserId: 7},
+				{Id: 2, Title: "Deal 2", Expenses: decimal.NewFromInt(150), Profit: decimal.NewFromInt(300), Currency: "USD", Status: "pending", UserId: 7},
 			},
 			expectError: false,
 		},
@@ -255,49 +244,430 @@ func TestDealRepository_GetAllProcessedDeals(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mock()
-			result := repo.GetAllProcessedDeals(context.Background())
+			result, err := repo.GetAllDeals(context.Background(), 7)
+			assert.NoError(t, err)
 			assert.Equal(t, tt.expected, result)
 			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
 
-func TestDealRepository_GetAllDeals(t *testing.T) {
+// expectTransition sets up the UPDATE and history INSERT written by transition.
+func expectTransition(mock sqlmock.Sqlmock, dealId int64, from, to, actor, reason string) {
+	mock.ExpectExec(`UPDATE transactions SET status=\$1, status_changed_at=now\(\) WHERE id=\$2`).
+		WithArgs(to, dealId).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO deal_status_history`).
+		WithArgs(dealId, from, to, actor, reason).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func TestDealRepository_ProcessNextDeal(t *testing.T) {
+	columns := []string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}
+	rateColumns := []string{"base_currency", "rate"}
+
+	expectClaimIn := func(mock sqlmock.Sqlmock, currency string) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE status=\$1 ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED`).
+			WithArgs("pending").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "Deal 1", 100, 250, currency, "pending", 7))
+		expectTransition(mock, 1, "pending", "processing", WorkerActor, "")
+		mock.ExpectExec(`SAVEPOINT book_profit`).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	expectClaim := func(mock sqlmock.Sqlmock) {
+		expectClaimIn(mock, "USD")
+	}
+
+	tests := []struct {
+		name           string
+		mock           func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock)
+		expectedStatus string
+		expectedErr    error
+	}{
+		{
+			name: "successful processing",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				expectClaim(mock)
+				mock.ExpectQuery(`INSERT INTO clear_profit (.+) ON CONFLICT \(deals_id\) DO NOTHING`).
+					WithArgs(int64(1), int64(7), decimal.NewFromInt(150), "USD", decimal.NewFromInt(150), "USD", decimal.NewFromInt(1)).
+					WillReturnRows(sqlmock.NewRows(profitRowColumns).AddRow(1, 1, 7, "150", "USD", "150", "USD", "1"))
+				expectTransition(mock, 1, "processing", "processed", WorkerActor, "")
+				mock.ExpectCommit()
+				redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
+				redisMock.ExpectIncr("profitReports:version:7").SetVal(1)
+			},
+			expectedStatus: "processed",
+		},
+		{
+			name: "converted into the reporting currency",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				expectClaimIn(mock, "EUR")
+				// Курс на момент создания сделки
+				mock.ExpectQuery(`SELECT base_currency, rate FROM fx_rates (.+) effective_at <= \(SELECT created_at FROM transactions WHERE id=\$3\)`).
+					WithArgs("EUR", "USD", int64(1)).
+					WillReturnRows(sqlmock.NewRows(rateColumns).AddRow("EUR", "1.0850"))
+				mock.ExpectQuery(`INSERT INTO clear_profit`).
+					WithArgs(int64(1), int64(7), decimal.NewFromInt(150), "EUR", decimal.RequireFromString("162.75"), "USD", decimal.RequireFromString("1.085")).
+					WillReturnRows(sqlmock.NewRows(profitRowColumns).AddRow(1, 1, 7, "150", "EUR", "162.75", "USD", "1.085"))
+				expectTransition(mock, 1, "processing", "processed", WorkerActor, "")
+				mock.ExpectCommit()
+				redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
+				redisMock.ExpectIncr("profitReports:version:7").SetVal(1)
+			},
+			expectedStatus: "processed",
+		},
+		{
+			name: "reverse pair rate is inverted",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				expectClaimIn(mock, "EUR")
+				mock.ExpectQuery(`SELECT base_currency, rate FROM fx_rates`).
+					WithArgs("EUR", "USD", int64(1)).
+					WillReturnRows(sqlmock.NewRows(rateColumns).AddRow("USD", "0.8"))
+				mock.ExpectQuery(`INSERT INTO clear_profit`).
+					WithArgs(int64(1), int64(7), decimal.NewFromInt(150), "EUR", decimal.RequireFromString("187.5"), "USD", decimal.RequireFromString("1.25")).
+					WillReturnRows(sqlmock.NewRows(profitRowColumns).AddRow(1, 1, 7, "150", "EUR", "187.5", "USD", "1.25"))
+				expectTransition(mock, 1, "processing", "processed", WorkerActor, "")
+				mock.ExpectCommit()
+				redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
+				redisMock.ExpectIncr("profitReports:version:7").SetVal(1)
+			},
+			expectedStatus: "processed",
+		},
+		{
+			name: "missing rate marks deal as failed",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				expectClaimIn(mock, "GBP")
+				mock.ExpectQuery(`SELECT base_currency, rate FROM fx_rates`).
+					WithArgs("GBP", "USD", int64(1)).
+					WillReturnRows(sqlmock.NewRows(rateColumns))
+				mock.ExpectExec(`ROLLBACK TO SAVEPOINT book_profit`).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectTransition(mock, 1, "processing", "failed", WorkerActor, "no fx rate from GBP to USD")
+				mock.ExpectCommit()
+				redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
+			},
+			expectedStatus: "failed",
+		},
+		{
+			name: "profit already booked",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				expectClaim(mock)
+				mock.ExpectQuery(`INSERT INTO clear_profit`).
+					WillReturnRows(sqlmock.NewRows(profitRowColumns))
+				expectTransition(mock, 1, "processing", "processed", WorkerActor, "")
+				mock.ExpectCommit()
+				redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
+				redisMock.ExpectIncr("profitReports:version:7").SetVal(1)
+			},
+			expectedStatus: "processed",
+		},
+		{
+			name: "booking error marks deal as failed",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				expectClaim(mock)
+				mock.ExpectQuery(`INSERT INTO clear_profit`).
+					WillReturnError(errors.New("insert error"))
+				mock.ExpectExec(`ROLLBACK TO SAVEPOINT book_profit`).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectTransition(mock, 1, "processing", "failed", WorkerActor, "insert error")
+				mock.ExpectCommit()
+				redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
+			},
+			expectedStatus: "failed",
+		},
+		{
+			name: "numeric overflow marks deal as failed",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				expectClaim(mock)
+				// Переполнение повторится при каждой попытке, поэтому сделка
+				// не остаётся в pending
+				mock.ExpectQuery(`INSERT INTO clear_profit`).
+					WillReturnError(&pq.Error{Code: "22003", Message: "numeric field overflow"})
+				mock.ExpectExec(`ROLLBACK TO SAVEPOINT book_profit`).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectTransition(mock, 1, "processing", "failed", WorkerActor, "pq: numeric field overflow")
+				mock.ExpectCommit()
+				redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
+			},
+			expectedStatus: "failed",
+		},
+		{
+			name: "converted profit too large marks deal as failed",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				expectClaimIn(mock, "EUR")
+				mock.ExpectQuery(`SELECT base_currency, rate FROM fx_rates`).
+					WithArgs("EUR", "USD", int64(1)).
+					WillReturnRows(sqlmock.NewRows(rateColumns).AddRow("EUR", "10000000000000"))
+				// Сумма проверяется до INSERT
+				mock.ExpectExec(`ROLLBACK TO SAVEPOINT book_profit`).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectTransition(mock, 1, "processing", "failed", WorkerActor,
+					"reporting profit 1500000000000000: amount has more than 15 integer digits")
+				mock.ExpectCommit()
+				redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
+			},
+			expectedStatus: "failed",
+		},
+		{
+			name: "deadline while booking leaves deal pending",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				expectClaim(mock)
+				mock.ExpectQuery(`INSERT INTO clear_profit`).
+					WillReturnError(context.DeadlineExceeded)
+				// Транзакция откатывается, сделка остаётся в pending
+				mock.ExpectRollback()
+			},
+			expectedErr: context.DeadlineExceeded,
+		},
+		{
+			name: "dropped connection while reading the rate leaves deal pending",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				expectClaimIn(mock, "EUR")
+				mock.ExpectQuery(`SELECT base_currency, rate FROM fx_rates`).
+					WithArgs("EUR", "USD", int64(1)).
+					WillReturnError(&pq.Error{Code: "08006", Message: "connection failure"})
+				mock.ExpectRollback()
+			},
+			expectedErr: errors.New("database unavailable: pq: connection failure"),
+		},
+		{
+			name: "nothing to process",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE status=\$1`).
+					WithArgs("pending").
+					WillReturnRows(sqlmock.NewRows(columns))
+				mock.ExpectRollback()
+			},
+			expectedErr: ErrNoDealsToProcess,
+		},
+		{
+			name: "commit error",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				expectClaim(mock)
+				mock.ExpectQuery(`INSERT INTO clear_profit`).
+					WillReturnRows(sqlmock.NewRows(profitRowColumns).AddRow(1, 1, 7, "150", "USD", "150", "USD", "1"))
+				expectTransition(mock, 1, "processing", "processed", WorkerActor, "")
+				mock.ExpectCommit().WillReturnError(errors.New("commit error"))
+			},
+			expectedErr: errors.New("commit error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			defer db.Close()
+			redisClient, redisMock := setupMockRedis()
+
+			repo := NewDealRepository(db, redisClient)
+			tt.mock(mock, redisMock)
+
+			deal, err := repo.ProcessNextDeal(context.Background(), "USD", func(deal models.Deal) decimal.Decimal {
+				return deal.Profit.Sub(deal.Expenses)
+			})
+
+			if tt.expectedErr != nil {
+				assert.Nil(t, deal)
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedStatus, deal.Status)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+			assert.NoError(t, redisMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDealRepository_CountPendingDeals(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	repo := NewDealRepository(db, redisClient)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM transactions WHERE status=\$1`).
+		WithArgs(models.StatusPending).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(12))
+
+	count, err := repo.CountPendingDeals(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), count)
+
+	// База недоступна
+	mock.ExpectQuery(`SELECT count\(\*\) FROM transactions WHERE status=\$1`).
+		WithArgs(models.StatusPending).
+		WillReturnError(&pq.Error{Code: "08006"})
+
+	_, err = repo.CountPendingDeals(context.Background())
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDealRepository_GetDealById(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 	redisClient, _ := setupMockRedis()
 
 	repo := NewDealRepository(db, redisClient)
 
+	rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}).
+		AddRow(1, "Deal 1", 100, 200, "USD", "pending", 7)
+	mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(1), int64(7)).
+		WillReturnRows(rows)
+
+	deal, err := repo.GetDealById(context.Background(), 7, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.Deal{Id: 1, Title: "Deal 1", Expenses: decimal.NewFromInt(100), Profit: decimal.NewFromInt(200), Currency: "USD", Status: "pending", UserId: 7}, deal)
+
+	// Чужая или несуществующая сделка
+	mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(2), int64(7)).
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = repo.GetDealById(context.Background(), 7, 2)
+	assert.ErrorIs(t, err, ErrDealNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDealRepository_UpdateDeal(t *testing.T) {
+	title := "Fixed title"
+	columns := []string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}
+
 	tests := []struct {
 		name        string
-		mock        func()
-		expected    *[]models.Deal
-		expectError bool
+		mock        func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock)
+		expected    *models.Deal
+		expectedErr error
 	}{
 		{
-			name: "successful fetch",
-			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "status"}).
-					AddRow(1, "Deal 1", 100, 200, "processed").
-					AddRow(2, "Deal 2", 150, 300, "not processed")
-				mock.ExpectQuery(`SELECT \* FROM transactions WHERE id!=0`).
-					WillReturnRows(rows)
+			name: "successful update",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				mock.ExpectQuery(`UPDATE transactions SET title=COALESCE\(\$1, title\)`).
+					WithArgs(&title, nil, nil, nil, int64(1), int64(7), "draft", "pending").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(1, title, 100, 200, "USD", "pending", 7))
+				redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
 			},
-			expected: &[]models.Deal{
-				{Id: 1, Title: "Deal 1", Expenses: 100, Profit: 200, Status: "processed"},
-				{Id: 2, Title: "Deal 2", Expenses: 150, Profit: 300, Status: "not processed"},
+			expected: &models.Deal{Id: 1, Title: title, Expenses: decimal.NewFromInt(100), Profit: decimal.NewFromInt(200), Currency: "USD", Status: "pending", UserId: 7},
+		},
+		{
+			name: "processed deal",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				mock.ExpectQuery(`UPDATE transactions`).WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE id=\$1 AND user_id=\$2`).
+					WithArgs(int64(1), int64(7)).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "Deal 1", 100, 200, "USD", "processed", 7))
 			},
-			expectError: false,
+			expectedErr: ErrDealImmutable,
+		},
+		{
+			name: "missing deal",
+			mock: func(mock sqlmock.Sqlmock, redisMock redismock.ClientMock) {
+				mock.ExpectQuery(`UPDATE transactions`).WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE id=\$1 AND user_id=\$2`).
+					WillReturnError(sql.ErrNoRows)
+			},
+			expectedErr: ErrDealNotFound,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.mock()
-			result := repo.GetAllDeals(context.Background())
-			assert.Equal(t, tt.expected, result)
+			db, mock := setupMockDB(t)
+			defer db.Close()
+			redisClient, redisMock := setupMockRedis()
+
+			repo := NewDealRepository(db, redisClient)
+			tt.mock(mock, redisMock)
+
+			deal, err := repo.UpdateDeal(context.Background(), 7, 1, models.DealPatch{Title: &title})
+
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, deal)
 			assert.NoError(t, mock.ExpectationsWereMet())
+			assert.NoError(t, redisMock.ExpectationsWereMet())
 		})
 	}
 }
+
+func TestDealRepository_ChangeDealStatus(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	redisClient, redisMock := setupMockRedis()
+
+	repo := NewDealRepository(db, redisClient)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE id=\$1 AND user_id=\$2 FOR UPDATE`).
+		WithArgs(int64(1), int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}).
+			AddRow(1, "Deal 1", 100, 200, "USD", "pending", 7))
+	expectTransition(mock, 1, "pending", "cancelled", "user:7", "duplicate")
+	mock.ExpectCommit()
+	redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
+
+	deal, err := repo.ChangeDealStatus(context.Background(), 7, 1, models.StatusCancelled, UserActor(7), "duplicate")
+	assert.NoError(t, err)
+	assert.Equal(t, "cancelled", deal.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+
+	// Обработанную сделку отменить нельзя
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE id=\$1 AND user_id=\$2 FOR UPDATE`).
+		WithArgs(int64(2), int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}).
+			AddRow(2, "Deal 2", 100, 200, "USD", "processed", 7))
+	mock.ExpectRollback()
+
+	_, err = repo.ChangeDealStatus(context.Background(), 7, 2, models.StatusCancelled, UserActor(7), "")
+	assert.ErrorIs(t, err, models.ErrInvalidTransition)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDealRepository_GetDealHistory(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	redisClient, _ := setupMockRedis()
+
+	repo := NewDealRepository(db, redisClient)
+
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE id=\$1 AND user_id=\$2`).
+		WithArgs(int64(1), int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}).
+			AddRow(1, "Deal 1", 100, 200, "USD", "processed", 7))
+	mock.ExpectQuery(`SELECT (.+) FROM deal_status_history WHERE deal_id=\$1 ORDER BY id`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "deal_id", "from_status", "to_status", "actor", "reason", "created_at"}).
+			AddRow(1, 1, "", "pending", "user:7", "created", createdAt).
+			AddRow(2, 1, "pending", "processing", "worker", "", createdAt).
+			AddRow(3, 1, "processing", "processed", "worker", "", createdAt))
+
+	history, err := repo.GetDealHistory(context.Background(), 7, 1)
+	assert.NoError(t, err)
+	assert.Len(t, history, 3)
+	assert.Equal(t, models.DealStatusChange{
+		Id: 1, DealId: 1, ToStatus: "pending", Actor: "user:7", Reason: "created", CreatedAt: createdAt,
+	}, history[0])
+	assert.Equal(t, "processed", history[2].ToStatus)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDealRepository_DeleteDeal(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	redisClient, redisMock := setupMockRedis()
+
+	repo := NewDealRepository(db, redisClient)
+
+	mock.ExpectQuery(`DELETE FROM transactions WHERE id=\$1 AND user_id=\$2 AND status NOT IN \(\$3, \$4\)`).
+		WithArgs(int64(1), int64(7), "processing", "processed").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}).
+			AddRow(1, "Deal 1", 100, 200, "USD", "pending", 7))
+	redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
+
+	assert.NoError(t, repo.DeleteDeal(context.Background(), 7, 1))
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"Brocker-pet-project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// WorkerActor is recorded in deal_status_history for changes made by
+// DealWorker.
+const WorkerActor = "worker"
+
+// UserActor is recorded in deal_status_history for changes made by a user.
+func UserActor(userId int64) string {
+	return "user:" + strconv.FormatInt(userId, 10)
+}
+
+// lockDeal selects a deal FOR UPDATE. userId 0 skips the owner check and is
+// meant for the worker.
+func lockDeal(ctx context.Context, tx *sql.Tx, userId, id int64) (*models.Deal, error) {
+	query := `SELECT ` + dealColumns + ` FROM transactions WHERE id=$1 FOR UPDATE;`
+	args := []any{id}
+	if userId != 0 {
+		query = `SELECT ` + dealColumns + ` FROM transactions WHERE id=$1 AND user_id=$2 FOR UPDATE;`
+		args = append(args, userId)
+	}
+
+	var deal models.Deal
+
+	err := scanDeal(tx.QueryRowContext(ctx, query, args...), &deal)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDealNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &deal, nil
+}
+
+// transition is the only place a deal status is changed after creation. The
+// deal must have been locked by lockDeal in the same transaction.
+func transition(ctx context.Context, tx *sql.Tx, deal *models.Deal, to, actor, reason string) error {
+	if !models.CanTransition(deal.Status, to) {
+		return fmt.Errorf("%w: %s -> %s", models.ErrInvalidTransition, deal.Status, to)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE transactions SET status=$1, status_changed_at=now() WHERE id=$2;`, to, deal.Id); err != nil {
+		return err
+	}
+
+	if err := recordStatusChange(ctx, tx, deal.Id, deal.Status, to, actor, reason); err != nil {
+		return err
+	}
+
+	deal.Status = to
+	return nil
+}
+
+func recordStatusChange(ctx context.Context, tx *sql.Tx, dealId int64, from, to, actor, reason string) error {
+	query := `INSERT INTO deal_status_history (deal_id, from_status, to_status, actor, reason)
+	VALUES ($1, NULLIF($2, ''), $3, $4, $5);`
+
+	_, err := tx.ExecContext(ctx, query, dealId, from, to, actor, reason)
+	return err
+}
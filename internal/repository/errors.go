@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"net"
+	"syscall"
+)
+
+// Every repository method that fails returns an error matching one of these
+// with errors.Is, or an unexpected error that is a bug or a bad query.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("conflict")
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// unavailableClasses are the Postgres error classes raised when the server
+// cannot serve the request right now, rather than because of the request.
+var unavailableClasses = map[pq.ErrorClass]bool{
+	"08": true, // connection_exception
+	"53": true, // insufficient_resources
+	"57": true, // operator_intervention, e.g. admin_shutdown
+	"58": true, // system_error
+}
+
+// conflictCodes are the Postgres errors caused by the request clashing with
+// existing rows or with a concurrent transaction.
+var conflictCodes = map[pq.ErrorCode]bool{
+	"23505": true, // unique_violation
+	"23503": true, // foreign_key_violation
+	"23P01": true, // exclusion_violation
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+}
+
+// isTransient reports whether err may not happen again: the database could
+// not be reached or the caller gave up. Other errors repeat on every retry.
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(mapError(err), ErrUnavailable) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// mapError wraps a database error in the sentinel it stands for, keeping the
+// original error in the chain. Errors that are already mapped, and nil, are
+// returned as is.
+func mapError(err error) error {
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict) || errors.Is(err, ErrUnavailable) {
+		return err
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case conflictCodes[pqErr.Code]:
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		case unavailableClasses[pqErr.Code.Class()]:
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return err
+	}
+
+	// A caller giving up is not the database failing. This is checked first
+	// as context.DeadlineExceeded is also a net.Error.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.As(err, &netErr) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	return err
+}
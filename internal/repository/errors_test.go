@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{name: "no rows", err: sql.ErrNoRows, expected: ErrNotFound},
+		{name: "unique violation", err: &pq.Error{Code: "23505"}, expected: ErrConflict},
+		{name: "serialization failure", err: &pq.Error{Code: "40001"}, expected: ErrConflict},
+		{name: "connection failure", err: &pq.Error{Code: "08006"}, expected: ErrUnavailable},
+		{name: "admin shutdown", err: &pq.Error{Code: "57P01"}, expected: ErrUnavailable},
+		{name: "bad connection", err: driver.ErrBadConn, expected: ErrUnavailable},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, expected: ErrUnavailable},
+		{name: "wrapped", err: fmt.Errorf("query: %w", sql.ErrConnDone), expected: ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mapError(tt.err)
+
+			assert.ErrorIs(t, err, tt.expected)
+			// Исходная ошибка остаётся в цепочке
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestMapError_PassesThrough(t *testing.T) {
+	assert.NoError(t, mapError(nil))
+
+	for _, err := range []error{
+		errors.New("syntax error"),
+		&pq.Error{Code: "42601"},
+		context.Canceled,
+		context.DeadlineExceeded,
+	} {
+		mapped := mapError(err)
+
+		assert.Equal(t, err, mapped)
+		assert.False(t, errors.Is(mapped, ErrUnavailable), err.Error())
+	}
+
+	// Уже сопоставленная ошибка не оборачивается повторно
+	assert.Equal(t, ErrDealNotFound, mapError(ErrDealNotFound))
+}
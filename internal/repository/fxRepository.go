@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"Brocker-pet-project/internal/fx"
+	"Brocker-pet-project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+)
+
+var ErrNoFxRate = errors.New("no fx rate")
+
+type FxRepository struct {
+	db *sql.DB
+}
+
+func NewFxRepository(db *sql.DB) *FxRepository {
+	return &FxRepository{db: db}
+}
+
+// SaveRates stores rates in one transaction. A rate for a pair and
+// effective time that is already stored is replaced.
+func (h *FxRepository) SaveRates(ctx context.Context, rates []models.FxRate) error {
+	query := `INSERT INTO fx_rates (base_currency, quote_currency, rate, effective_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (base_currency, quote_currency, effective_at) DO UPDATE SET rate = EXCLUDED.rate;`
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback()
+
+	for _, rate := range rates {
+		if _, err := tx.ExecContext(ctx, query, rate.Base, rate.Quote, rate.Rate, rate.EffectiveAt); err != nil {
+			return mapError(err)
+		}
+	}
+
+	return mapError(tx.Commit())
+}
+
+// GetRates returns every stored rate ordered by pair and effective time.
+func (h *FxRepository) GetRates(ctx context.Context) ([]models.FxRate, error) {
+	query := `SELECT base_currency, quote_currency, rate, effective_at FROM fx_rates
+	ORDER BY base_currency, quote_currency, effective_at;`
+
+	rows, err := h.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	rates := []models.FxRate{}
+
+	for rows.Next() {
+		var rate models.FxRate
+		if err := rows.Scan(&rate.Base, &rate.Quote, &rate.Rate, &rate.EffectiveAt); err != nil {
+			return nil, mapError(err)
+		}
+		rates = append(rates, rate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+
+	return rates, nil
+}
+
+// dealRate returns the rate from one currency to another that was in effect
+// when the deal was created. A stored rate of the reverse pair is inverted.
+func dealRate(ctx context.Context, q queryRower, from, to string, dealId int64) (decimal.Decimal, error) {
+	if from == to {
+		return decimal.NewFromInt(1), nil
+	}
+
+	query := `SELECT base_currency, rate FROM fx_rates
+	WHERE ((base_currency=$1 AND quote_currency=$2) OR (base_currency=$2 AND quote_currency=$1))
+	AND effective_at <= (SELECT created_at FROM transactions WHERE id=$3)
+	ORDER BY effective_at DESC
+	LIMIT 1;`
+
+	var (
+		base string
+		rate decimal.Decimal
+	)
+
+	err := q.QueryRowContext(ctx, query, from, to, dealId).Scan(&base, &rate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return decimal.Decimal{}, fmt.Errorf("%w from %s to %s", ErrNoFxRate, from, to)
+	}
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+
+	if base != from {
+		rate = fx.Invert(rate)
+	}
+
+	return rate, nil
+}
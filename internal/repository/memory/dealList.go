@@ -0,0 +1,263 @@
+package memory
+
+import (
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/internal/repository"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sortColumns are the sort options of ListDeals, as in the Postgres
+// repository.
+var sortColumns = map[string]bool{"id": true, "created_at": true, "title": true, "expenses": true, "profit": true}
+
+// dealCursor points just after the last deal of a page, like the cursor of
+// the Postgres repository. The two are not interchangeable.
+type dealCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	Id    int64  `json:"id"`
+}
+
+// sortValue is the value of column for d, in the form a cursor stores it.
+func sortValue(d *deal, column string) string {
+	switch column {
+	case "created_at":
+		return d.createdAt.Format(time.RFC3339Nano)
+	case "title":
+		return d.Title
+	case "expenses":
+		return d.Expenses.String()
+	case "profit":
+		return d.Profit.String()
+	}
+	return ""
+}
+
+// compareValues compares two values returned by sortValue for column.
+func compareValues(column, a, b string) int {
+	switch column {
+	case "created_at":
+		ta, _ := time.Parse(time.RFC3339Nano, a)
+		tb, _ := time.Parse(time.RFC3339Nano, b)
+		return ta.Compare(tb)
+	case "expenses", "profit":
+		da, _ := decimal.NewFromString(a)
+		db, _ := decimal.NewFromString(b)
+		return da.Cmp(db)
+	}
+	return strings.Compare(a, b)
+}
+
+// parseSort splits a sort option such as "-profit" into its column and
+// direction. An empty sort orders by id.
+func parseSort(sort string) (string, string, bool, error) {
+	if sort == "" {
+		sort = "id"
+	}
+	desc := strings.HasPrefix(sort, "-")
+	column := strings.TrimPrefix(sort, "-")
+	if !sortColumns[column] {
+		return sort, column, desc, fmt.Errorf("%w %q", repository.ErrInvalidSort, sort)
+	}
+	return sort, column, desc, nil
+}
+
+// matches reports whether d passes every condition of filter but the cursor.
+func matches(d *deal, userId int64, filter models.DealFilter) bool {
+	switch {
+	case d.UserId != userId:
+		return false
+	case len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, d.Status):
+		return false
+	case filter.Title != "" && !strings.Contains(strings.ToLower(d.Title), strings.ToLower(filter.Title)):
+		return false
+	case filter.MinExpenses != nil && d.Expenses.LessThan(*filter.MinExpenses):
+		return false
+	case filter.MaxExpenses != nil && d.Expenses.GreaterThan(*filter.MaxExpenses):
+		return false
+	case filter.MinProfit != nil && d.Profit.LessThan(*filter.MinProfit):
+		return false
+	case filter.MaxProfit != nil && d.Profit.GreaterThan(*filter.MaxProfit):
+		return false
+	case filter.CreatedFrom != nil && d.createdAt.Before(*filter.CreatedFrom):
+		return false
+	case filter.CreatedTo != nil && !d.createdAt.Before(*filter.CreatedTo):
+		return false
+	}
+	return true
+}
+
+// compareDeals orders deals by column with id as the tiebreaker.
+func compareDeals(a, b *deal, column string, desc bool) int {
+	c := 0
+	if column != "id" {
+		c = compareValues(column, sortValue(a, column), sortValue(b, column))
+	}
+	if c == 0 {
+		c = cmp.Compare(a.Id, b.Id)
+	}
+	if desc {
+		c = -c
+	}
+	return c
+}
+
+// filtered returns the deals of userId matching filter in the order of
+// column. The caller must hold s.mu.
+func (s *Store) filtered(userId int64, filter models.DealFilter, column string, desc bool) []*deal {
+	var deals []*deal
+	for _, d := range s.deals {
+		if matches(d, userId, filter) {
+			deals = append(deals, d)
+		}
+	}
+
+	slices.SortFunc(deals, func(a, b *deal) int { return compareDeals(a, b, column, desc) })
+
+	return deals
+}
+
+// ListDeals returns one page of the deals owned by userId.
+func (s *Store) ListDeals(ctx context.Context, userId int64, filter models.DealFilter) (*models.DealPage, error) {
+	sort, column, desc, err := parseSort(filter.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = repository.DefaultDealPageSize
+	}
+	limit = min(limit, repository.MaxDealPageSize)
+
+	var after *deal
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != sort {
+			return nil, fmt.Errorf("%w: issued for sort %q", repository.ErrInvalidCursor, cursor.Sort)
+		}
+		after = &deal{Deal: models.Deal{Id: cursor.Id}}
+		if err := setSortValue(after, column, cursor.Value); err != nil {
+			return nil, repository.ErrInvalidCursor
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	page := &models.DealPage{Deals: []models.Deal{}}
+
+	for _, d := range s.filtered(userId, filter, column, desc) {
+		if after != nil && compareDeals(d, after, column, desc) <= 0 {
+			continue
+		}
+
+		if len(page.Deals) == limit {
+			last := s.deals[page.Deals[len(page.Deals)-1].Id]
+			page.NextCursor = encodeCursor(dealCursor{Sort: sort, Value: sortValue(last, column), Id: last.Id})
+			break
+		}
+
+		page.Deals = append(page.Deals, d.Deal)
+	}
+
+	return page, nil
+}
+
+// setSortValue sets the column of d a cursor value was taken from.
+func setSortValue(d *deal, column, value string) error {
+	var err error
+	switch column {
+	case "created_at":
+		d.createdAt, err = time.Parse(time.RFC3339Nano, value)
+	case "title":
+		d.Title = value
+	case "expenses":
+		d.Expenses, err = decimal.NewFromString(value)
+	case "profit":
+		d.Profit, err = decimal.NewFromString(value)
+	}
+	return err
+}
+
+func encodeCursor(cursor dealCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (dealCursor, error) {
+	var cursor dealCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, repository.ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, repository.ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// listAll returns every deal of a listing at once.
+func (s *Store) listAll(userId int64, filter models.DealFilter) ([]models.Deal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deals := []models.Deal{}
+	for _, d := range s.filtered(userId, filter, "id", false) {
+		deals = append(deals, d.Deal)
+	}
+
+	return deals, nil
+}
+
+// ExportDeals hands every deal of userId matching filter to fn, joined with
+// its clear profit. The deals are copied first, so fn runs without holding
+// the store. Limit and Cursor of filter are ignored.
+func (s *Store) ExportDeals(ctx context.Context, userId int64, filter models.DealFilter, fn func(models.DealExport) error) error {
+	_, column, desc, err := parseSort(filter.Sort)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+
+	var deals []models.DealExport
+	for _, d := range s.filtered(userId, filter, column, desc) {
+		export := models.DealExport{Deal: d.Deal, CreatedAt: d.createdAt}
+
+		i := slices.IndexFunc(s.profits, func(p profit) bool { return p.DealId == d.Id })
+		if i >= 0 {
+			p := s.profits[i]
+			export.ClearProfit = &p.AllProfit
+			export.ReportingProfit = &p.ReportingProfit
+			export.ReportingCurrency = &p.ReportingCurrency
+			export.FxRate = &p.FxRate
+			export.BookedAt = &p.bookedAt
+		}
+
+		deals = append(deals, export)
+	}
+
+	s.mu.Unlock()
+
+	for _, deal := range deals {
+		if err := fn(deal); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
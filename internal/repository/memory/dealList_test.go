@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/internal/repository"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dealIds(deals []models.Deal) []int64 {
+	ids := make([]int64, len(deals))
+	for i, deal := range deals {
+		ids[i] = deal.Id
+	}
+	return ids
+}
+
+func TestStore_ListDeals(t *testing.T) {
+	s := newTestStore(time.Now())
+	ctx := context.Background()
+
+	createDeal(t, s, 7, "Alpha", "10", "50", "USD", models.StatusPending)
+	createDeal(t, s, 7, "beta", "30", "20", "USD", models.StatusDraft)
+	createDeal(t, s, 7, "Gamma", "20", "50", "USD", models.StatusPending)
+	createDeal(t, s, 8, "Alpha", "10", "50", "USD", models.StatusPending)
+	createDeal(t, s, 7, "Delta", "5", "40", "USD", models.StatusPending)
+
+	// Страницы по две сделки, сортировка по прибыли по убыванию
+	filter := models.DealFilter{Sort: "-profit", Limit: 2}
+	var ids []int64
+	for {
+		page, err := s.ListDeals(ctx, 7, filter)
+		require.NoError(t, err)
+		ids = append(ids, dealIds(page.Deals)...)
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []int64{3, 1, 5, 2}, ids)
+
+	minExpenses := decimal.NewFromInt(10)
+	page, err := s.ListDeals(ctx, 7, models.DealFilter{
+		Statuses:    []string{models.StatusPending},
+		Title:       "A",
+		MinExpenses: &minExpenses,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 3}, dealIds(page.Deals))
+
+	page, err = s.ListDeals(ctx, 9, models.DealFilter{})
+	require.NoError(t, err)
+	assert.NotNil(t, page.Deals, "empty page should encode as [] rather than null")
+}
+
+func TestStore_ListDeals_Errors(t *testing.T) {
+	s := newTestStore(time.Now())
+	ctx := context.Background()
+
+	createDeal(t, s, 7, "A", "1", "2", "USD", models.StatusPending)
+	createDeal(t, s, 7, "B", "1", "2", "USD", models.StatusPending)
+
+	_, err := s.ListDeals(ctx, 7, models.DealFilter{Sort: "status"})
+	assert.ErrorIs(t, err, repository.ErrInvalidSort)
+
+	_, err = s.ListDeals(ctx, 7, models.DealFilter{Cursor: "not a cursor"})
+	assert.ErrorIs(t, err, repository.ErrInvalidCursor)
+
+	page, err := s.ListDeals(ctx, 7, models.DealFilter{Limit: 1})
+	require.NoError(t, err)
+	require.NotEmpty(t, page.NextCursor)
+
+	// Курсор нельзя применить к другой сортировке
+	_, err = s.ListDeals(ctx, 7, models.DealFilter{Sort: "title", Cursor: page.NextCursor})
+	assert.ErrorIs(t, err, repository.ErrInvalidCursor)
+}
+
+func TestStore_ExportDeals(t *testing.T) {
+	s := newTestStore(time.Now())
+	ctx := context.Background()
+
+	createDeal(t, s, 7, "Processed", "100", "250", "USD", models.StatusPending)
+	createDeal(t, s, 7, "Draft", "10", "20", "USD", models.StatusDraft)
+	_, err := s.ProcessNextDeal(ctx, "USD", clearProfit)
+	require.NoError(t, err)
+
+	var deals []models.DealExport
+	err = s.ExportDeals(ctx, 7, models.DealFilter{Sort: "-id"}, func(deal models.DealExport) error {
+		deals = append(deals, deal)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, deals, 2)
+
+	assert.Equal(t, "Draft", deals[0].Title)
+	assert.Nil(t, deals[0].ClearProfit)
+	require.NotNil(t, deals[1].ClearProfit)
+	assert.True(t, decimal.NewFromInt(150).Equal(*deals[1].ClearProfit))
+	assert.Equal(t, "USD", *deals[1].ReportingCurrency)
+
+	// Ошибка fn останавливает выгрузку
+	stop := errors.New("stop")
+	calls := 0
+	err = s.ExportDeals(ctx, 7, models.DealFilter{}, func(models.DealExport) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,361 @@
+package memory
+
+import (
+	"Brocker-pet-project/internal/fx"
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"slices"
+	"time"
+)
+
+// CreateNewDeal stores a deal in the draft or pending status and records its
+// creation in the status history.
+func (s *Store) CreateNewDeal(ctx context.Context, userId int64, title string, expenses, profit decimal.Decimal, currency, status string) (*models.Deal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.insertDeal(userId, models.Deal{Title: title, Expenses: expenses, Profit: profit, Currency: currency, Status: status})
+	s.recordStatusChange(d.Id, "", d.Status, repository.UserActor(userId), "created")
+
+	created := d.Deal
+	return &created, nil
+}
+
+func (s *Store) insertDeal(userId int64, fields models.Deal) *deal {
+	s.lastDealId++
+
+	d := &deal{Deal: fields, createdAt: s.now()}
+	d.Id = s.lastDealId
+	d.UserId = userId
+	s.deals[d.Id] = d
+
+	return d
+}
+
+// ownedDeal returns the deal id of userId, or repository.ErrDealNotFound.
+// userId 0 skips the owner check and is meant for the worker.
+func (s *Store) ownedDeal(userId, id int64) (*deal, error) {
+	d, ok := s.deals[id]
+	if !ok || (userId != 0 && d.UserId != userId) {
+		return nil, repository.ErrDealNotFound
+	}
+	return d, nil
+}
+
+// GetDealById returns a deal owned by userId.
+func (s *Store) GetDealById(ctx context.Context, userId, id int64) (*models.Deal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, err := s.ownedDeal(userId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	found := d.Deal
+	return &found, nil
+}
+
+// UpdateDeal applies the non-nil fields of patch to a deal that is still a
+// draft or pending.
+func (s *Store) UpdateDeal(ctx context.Context, userId, id int64, patch models.DealPatch) (*models.Deal, error) {
+	updated, err := s.updateDeal(userId, id, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidate(ctx, userId, false)
+
+	return updated, nil
+}
+
+func (s *Store) updateDeal(userId, id int64, patch models.DealPatch) (*models.Deal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, err := s.ownedDeal(userId, id)
+	if err != nil {
+		return nil, err
+	}
+	if !models.IsEditable(d.Status) {
+		return nil, repository.ErrDealImmutable
+	}
+
+	if patch.Title != nil {
+		d.Title = *patch.Title
+	}
+	if patch.Expenses != nil {
+		d.Expenses = *patch.Expenses
+	}
+	if patch.Profit != nil {
+		d.Profit = *patch.Profit
+	}
+	if patch.Currency != nil {
+		d.Currency = *patch.Currency
+	}
+
+	updated := d.Deal
+	return &updated, nil
+}
+
+// DeleteDeal removes a deal that has not been booked, along with its status
+// history.
+func (s *Store) DeleteDeal(ctx context.Context, userId, id int64) error {
+	if err := s.deleteDeal(userId, id); err != nil {
+		return err
+	}
+
+	s.invalidate(ctx, userId, false)
+
+	return nil
+}
+
+func (s *Store) deleteDeal(userId, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, err := s.ownedDeal(userId, id)
+	if err != nil {
+		return err
+	}
+	if d.Status == models.StatusProcessing || d.Status == models.StatusProcessed {
+		return repository.ErrDealImmutable
+	}
+
+	delete(s.deals, id)
+	s.history = slices.DeleteFunc(s.history, func(change models.DealStatusChange) bool { return change.DealId == id })
+
+	return nil
+}
+
+// ChangeDealStatus moves a deal owned by userId to status `to`, rejecting
+// transitions models.CanTransition does not allow.
+func (s *Store) ChangeDealStatus(ctx context.Context, userId, id int64, to, actor, reason string) (*models.Deal, error) {
+	changed, err := s.changeDealStatus(userId, id, to, actor, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidate(ctx, changed.UserId, false)
+
+	return changed, nil
+}
+
+func (s *Store) changeDealStatus(userId, id int64, to, actor, reason string) (*models.Deal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, err := s.ownedDeal(userId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.transition(d, to, actor, reason); err != nil {
+		return nil, err
+	}
+
+	changed := d.Deal
+	return &changed, nil
+}
+
+// transition is the only place a deal status is changed after creation.
+func (s *Store) transition(d *deal, to, actor, reason string) error {
+	if !models.CanTransition(d.Status, to) {
+		return fmt.Errorf("%w: %s -> %s", models.ErrInvalidTransition, d.Status, to)
+	}
+
+	s.recordStatusChange(d.Id, d.Status, to, actor, reason)
+	d.Status = to
+
+	return nil
+}
+
+func (s *Store) recordStatusChange(dealId int64, from, to, actor, reason string) {
+	s.lastHistoryId++
+	s.history = append(s.history, models.DealStatusChange{
+		Id:         s.lastHistoryId,
+		DealId:     dealId,
+		FromStatus: from,
+		ToStatus:   to,
+		Actor:      actor,
+		Reason:     reason,
+		CreatedAt:  s.now(),
+	})
+}
+
+// GetDealHistory returns the status changes of a deal owned by userId,
+// oldest first.
+func (s *Store) GetDealHistory(ctx context.Context, userId, id int64) ([]models.DealStatusChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.ownedDeal(userId, id); err != nil {
+		return nil, err
+	}
+
+	history := []models.DealStatusChange{}
+	for _, change := range s.history {
+		if change.DealId == id {
+			history = append(history, change)
+		}
+	}
+
+	return history, nil
+}
+
+func (s *Store) GetAllProcessedDeals(ctx context.Context, userId int64) ([]models.Deal, error) {
+	return s.listAll(userId, models.DealFilter{Statuses: []string{models.StatusProcessed}})
+}
+
+func (s *Store) GetAllNotProcessedDeals(ctx context.Context, userId int64) ([]models.Deal, error) {
+	return s.listAll(userId, models.DealFilter{Statuses: models.NotProcessedStatuses})
+}
+
+func (s *Store) GetAllDeals(ctx context.Context, userId int64) ([]models.Deal, error) {
+	return s.listAll(userId, models.DealFilter{})
+}
+
+// ImportDeals stores already validated deals for userId, all or none, and
+// returns their ids in order.
+func (s *Store) ImportDeals(ctx context.Context, userId int64, deals []models.Deal) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int64, 0, len(deals))
+
+	for _, fields := range deals {
+		d := s.insertDeal(userId, fields)
+		s.recordStatusChange(d.Id, "", d.Status, repository.UserActor(userId), "imported")
+		ids = append(ids, d.Id)
+	}
+
+	return ids, nil
+}
+
+// ProcessNextDeal takes the oldest pending deal through processing to
+// processed, booking its clear profit in the deal currency and in
+// reportingCurrency at the rate in effect when the deal was created. As in
+// the Postgres repository, a deal whose booking fails for good, because no
+// rate is known or the amount does not fit, is moved to failed, while a
+// deal claimed after ctx is done stays pending. It returns
+// repository.ErrNoDealsToProcess when nothing is pending.
+func (s *Store) ProcessNextDeal(ctx context.Context, reportingCurrency string, clearProfit func(models.Deal) decimal.Decimal) (*models.Deal, error) {
+	// The store does no I/O, so a caller giving up is the only error that
+	// may pass; the other booking errors repeat on every retry.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	processed, err := s.processNextDeal(reportingCurrency, clearProfit)
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidate(ctx, processed.UserId, processed.Status == models.StatusProcessed)
+
+	return processed, nil
+}
+
+func (s *Store) processNextDeal(reportingCurrency string, clearProfit func(models.Deal) decimal.Decimal) (*models.Deal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next *deal
+	for _, d := range s.deals {
+		if d.Status == models.StatusPending && (next == nil || d.Id < next.Id) {
+			next = d
+		}
+	}
+	if next == nil {
+		return nil, repository.ErrNoDealsToProcess
+	}
+
+	if err := s.transition(next, models.StatusProcessing, repository.WorkerActor, ""); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if bookErr := s.bookProfit(next, clearProfit(next.Deal), reportingCurrency); bookErr != nil {
+		err = s.transition(next, models.StatusFailed, repository.WorkerActor, bookErr.Error())
+	} else {
+		err = s.transition(next, models.StatusProcessed, repository.WorkerActor, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	processed := next.Deal
+	return &processed, nil
+}
+
+func (s *Store) CountPendingDeals(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	for _, d := range s.deals {
+		if d.Status == models.StatusPending {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// bookProfit converts the clear profit of a deal into reportingCurrency and
+// books it, unless it was booked already.
+func (s *Store) bookProfit(d *deal, amount decimal.Decimal, reportingCurrency string) error {
+	rate, err := s.dealRate(d.Currency, reportingCurrency, d.createdAt)
+	if err != nil {
+		return err
+	}
+
+	reportingProfit := fx.Convert(amount, rate)
+	if err := repository.ValidateBooking(amount, reportingProfit); err != nil {
+		return err
+	}
+
+	_, err = s.insertProfit(models.ProfitSQLDeal{
+		DealId:            d.Id,
+		UserId:            d.UserId,
+		AllProfit:         amount,
+		Currency:          d.Currency,
+		ReportingProfit:   reportingProfit,
+		ReportingCurrency: reportingCurrency,
+		FxRate:            rate,
+	})
+	if errors.Is(err, errAlreadyBooked) {
+		return nil
+	}
+	return err
+}
+
+// dealRate returns the rate from one currency to another in effect at
+// createdAt. A stored rate of the reverse pair is inverted.
+func (s *Store) dealRate(from, to string, createdAt time.Time) (decimal.Decimal, error) {
+	if from == to {
+		return decimal.NewFromInt(1), nil
+	}
+
+	var found *models.FxRate
+	for i, rate := range s.rates {
+		direct := rate.Base == from && rate.Quote == to
+		reverse := rate.Base == to && rate.Quote == from
+		if (direct || reverse) && !rate.EffectiveAt.After(createdAt) &&
+			(found == nil || rate.EffectiveAt.After(found.EffectiveAt)) {
+			found = &s.rates[i]
+		}
+	}
+	if found == nil {
+		return decimal.Decimal{}, fmt.Errorf("%w from %s to %s", repository.ErrNoFxRate, from, to)
+	}
+
+	if found.Base != from {
+		return fx.Invert(found.Rate), nil
+	}
+	return found.Rate, nil
+}
@@ -0,0 +1,272 @@
+package memory
+
+import (
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/internal/repository"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/redis/go-redis/v9"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func clearProfit(deal models.Deal) decimal.Decimal {
+	return deal.Profit.Sub(deal.Expenses)
+}
+
+func createDeal(t *testing.T, s *Store, userId int64, title, expenses, profit, currency, status string) *models.Deal {
+	t.Helper()
+
+	deal, err := s.CreateNewDeal(context.Background(), userId, title, decimal.RequireFromString(expenses), decimal.RequireFromString(profit), currency, status)
+	require.NoError(t, err)
+	return deal
+}
+
+func TestStore_DealLifecycle(t *testing.T) {
+	s := newTestStore(time.Now())
+	ctx := context.Background()
+
+	deal := createDeal(t, s, 7, "Deal", "100", "250", "USD", models.StatusDraft)
+	assert.Equal(t, int64(1), deal.Id)
+	assert.Equal(t, int64(7), deal.UserId)
+
+	// Чужая сделка не видна
+	_, err := s.GetDealById(ctx, 8, deal.Id)
+	assert.ErrorIs(t, err, repository.ErrDealNotFound)
+
+	title := "Renamed"
+	updated, err := s.UpdateDeal(ctx, 7, deal.Id, models.DealPatch{Title: &title})
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", updated.Title)
+	assert.True(t, decimal.NewFromInt(100).Equal(updated.Expenses))
+
+	_, err = s.ChangeDealStatus(ctx, 7, deal.Id, models.StatusProcessed, repository.UserActor(7), "")
+	assert.ErrorIs(t, err, models.ErrInvalidTransition)
+
+	submitted, err := s.ChangeDealStatus(ctx, 7, deal.Id, models.StatusPending, repository.UserActor(7), "")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPending, submitted.Status)
+
+	history, err := s.GetDealHistory(ctx, 7, deal.Id)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "", history[0].FromStatus)
+	assert.Equal(t, "created", history[0].Reason)
+	assert.Equal(t, models.StatusDraft, history[1].FromStatus)
+	assert.Equal(t, models.StatusPending, history[1].ToStatus)
+
+	require.NoError(t, s.DeleteDeal(ctx, 7, deal.Id))
+	_, err = s.GetDealById(ctx, 7, deal.Id)
+	assert.ErrorIs(t, err, repository.ErrDealNotFound)
+	assert.ErrorIs(t, s.DeleteDeal(ctx, 7, deal.Id), repository.ErrNotFound)
+}
+
+func TestStore_ProcessNextDeal(t *testing.T) {
+	created := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	s := newTestStore(created)
+	ctx := context.Background()
+
+	require.NoError(t, s.SaveRates(ctx, []models.FxRate{
+		{Base: "EUR", Quote: "USD", Rate: decimal.RequireFromString("1.085"), EffectiveAt: created.AddDate(0, 0, -1)},
+		// Курс, вступивший в силу после создания сделки, не используется
+		{Base: "EUR", Quote: "USD", Rate: decimal.RequireFromString("2"), EffectiveAt: created.AddDate(0, 0, 1)},
+	}))
+
+	eur := createDeal(t, s, 7, "EUR deal", "100", "250", "EUR", models.StatusPending)
+	gbp := createDeal(t, s, 7, "GBP deal", "10", "20", "GBP", models.StatusPending)
+	createDeal(t, s, 7, "Draft", "1", "2", "USD", models.StatusDraft)
+
+	processed, err := s.ProcessNextDeal(ctx, "USD", clearProfit)
+	require.NoError(t, err)
+	assert.Equal(t, eur.Id, processed.Id)
+	assert.Equal(t, models.StatusProcessed, processed.Status)
+
+	profits, err := s.GetAllProfitInfo(ctx, 7)
+	require.NoError(t, err)
+	require.Len(t, profits, 1)
+	assert.True(t, decimal.NewFromInt(150).Equal(profits[0].AllProfit))
+	assert.True(t, decimal.RequireFromString("162.75").Equal(profits[0].ReportingProfit))
+	assert.True(t, decimal.RequireFromString("1.085").Equal(profits[0].FxRate))
+
+	// Без курса GBP/USD сделка переходит в failed
+	failed, err := s.ProcessNextDeal(ctx, "USD", clearProfit)
+	require.NoError(t, err)
+	assert.Equal(t, gbp.Id, failed.Id)
+	assert.Equal(t, models.StatusFailed, failed.Status)
+
+	history, err := s.GetDealHistory(ctx, 7, gbp.Id)
+	require.NoError(t, err)
+	assert.Contains(t, history[len(history)-1].Reason, repository.ErrNoFxRate.Error())
+
+	_, err = s.ProcessNextDeal(ctx, "USD", clearProfit)
+	assert.ErrorIs(t, err, repository.ErrNoDealsToProcess)
+
+	// Обработанную сделку нельзя изменить или удалить
+	title := "Renamed"
+	_, err = s.UpdateDeal(ctx, 7, eur.Id, models.DealPatch{Title: &title})
+	assert.ErrorIs(t, err, repository.ErrDealImmutable)
+	assert.ErrorIs(t, s.DeleteDeal(ctx, 7, eur.Id), repository.ErrConflict)
+}
+
+func TestStore_ProcessNextDeal_Overflow(t *testing.T) {
+	created := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	s := newTestStore(created)
+	ctx := context.Background()
+
+	require.NoError(t, s.SaveRates(ctx, []models.FxRate{
+		{Base: "EUR", Quote: "USD", Rate: decimal.RequireFromString("10000000000000"), EffectiveAt: created.AddDate(0, 0, -1)},
+	}))
+	deal := createDeal(t, s, 7, "Huge", "100", "250", "EUR", models.StatusPending)
+
+	// Сумма в валюте отчётности не помещается в столбец - сделка в failed,
+	// как и в Postgres
+	failed, err := s.ProcessNextDeal(ctx, "USD", clearProfit)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFailed, failed.Status)
+
+	history, err := s.GetDealHistory(ctx, 7, deal.Id)
+	require.NoError(t, err)
+	assert.Contains(t, history[len(history)-1].Reason, "reporting profit")
+
+	profits, err := s.GetAllProfitInfo(ctx, 7)
+	require.NoError(t, err)
+	assert.Empty(t, profits)
+}
+
+func TestStore_ProcessNextDeal_Cancelled(t *testing.T) {
+	s := newTestStore(time.Now())
+	deal := createDeal(t, s, 7, "Deal", "1", "2", "USD", models.StatusPending)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Отменённый вызов оставляет сделку в pending
+	_, err := s.ProcessNextDeal(ctx, "USD", clearProfit)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	stored, err := s.GetDealById(context.Background(), 7, deal.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPending, stored.Status)
+}
+
+func TestStore_ProcessNextDeal_InvalidatesCache(t *testing.T) {
+	redisClient, redisMock := redismock.NewClientMock()
+	s := New(redisClient, nil, zap.NewNop())
+
+	_, err := s.CreateNewDeal(context.Background(), 7, "Deal", decimal.NewFromInt(1), decimal.NewFromInt(2), "USD", models.StatusPending)
+	require.NoError(t, err)
+
+	redisMock.ExpectDel(repository.DealCacheKeys(7)...).SetVal(1)
+	redisMock.ExpectIncr(repository.ReportVersionKey(7)).SetVal(1)
+
+	_, err = s.ProcessNextDeal(context.Background(), "USD", clearProfit)
+	require.NoError(t, err)
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestStore_InvalidateWithoutLock(t *testing.T) {
+	dialing := make(chan struct{}, 1)
+	release := make(chan struct{})
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:       "redis.invalid:6379",
+		MaxRetries: -1,
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			select {
+			case dialing <- struct{}{}:
+			default:
+			}
+			<-release
+			return nil, errors.New("redis down")
+		},
+	})
+	defer redisClient.Close()
+
+	s := New(redisClient, nil, zap.NewNop())
+	deal, err := s.CreateNewDeal(context.Background(), 7, "Deal", decimal.NewFromInt(1), decimal.NewFromInt(2), "USD", models.StatusPending)
+	require.NoError(t, err)
+
+	updated := make(chan error, 1)
+	go func() {
+		title := "Renamed"
+		_, err := s.UpdateDeal(context.Background(), 7, deal.Id, models.DealPatch{Title: &title})
+		updated <- err
+	}()
+	<-dialing
+
+	// Пока Redis не отвечает, остальные вызовы хранилища не ждут
+	read := make(chan *models.Deal, 1)
+	go func() {
+		found, _ := s.GetDealById(context.Background(), 7, deal.Id)
+		read <- found
+	}()
+	select {
+	case found := <-read:
+		assert.Equal(t, "Renamed", found.Title)
+	case <-time.After(time.Second):
+		t.Fatal("store is locked while the cache is invalidated")
+	}
+
+	close(release)
+	assert.NoError(t, <-updated)
+}
+
+func TestStore_GetAllNotProcessedDeals(t *testing.T) {
+	s := newTestStore(time.Now())
+	ctx := context.Background()
+
+	createDeal(t, s, 7, "Processed", "1", "2", "USD", models.StatusPending)
+	createDeal(t, s, 7, "Failed", "1", "2", "GBP", models.StatusPending)
+	_, err := s.ProcessNextDeal(ctx, "USD", clearProfit)
+	require.NoError(t, err)
+	// Курса GBP нет - сделка переходит в failed
+	_, err = s.ProcessNextDeal(ctx, "USD", clearProfit)
+	require.NoError(t, err)
+
+	createDeal(t, s, 7, "Draft", "1", "2", "USD", models.StatusDraft)
+	createDeal(t, s, 7, "Pending", "1", "2", "USD", models.StatusPending)
+	cancelled := createDeal(t, s, 7, "Cancelled", "1", "2", "USD", models.StatusPending)
+	_, err = s.ChangeDealStatus(ctx, 7, cancelled.Id, models.StatusCancelled, "user:7", "")
+	require.NoError(t, err)
+
+	deals, err := s.GetAllNotProcessedDeals(ctx, 7)
+	require.NoError(t, err)
+
+	titles := make([]string, len(deals))
+	for i, deal := range deals {
+		titles[i] = deal.Title
+	}
+	assert.Equal(t, []string{"Failed", "Draft", "Pending"}, titles)
+}
+
+func TestStore_ImportDeals(t *testing.T) {
+	s := newTestStore(time.Now())
+	ctx := context.Background()
+
+	createDeal(t, s, 7, "Existing", "1", "2", "USD", models.StatusDraft)
+
+	ids, err := s.ImportDeals(ctx, 7, []models.Deal{
+		{Title: "A", Expenses: decimal.NewFromInt(1), Profit: decimal.NewFromInt(2), Currency: "USD", Status: models.StatusPending},
+		{Title: "B", Expenses: decimal.NewFromInt(3), Profit: decimal.NewFromInt(4), Currency: "EUR", Status: models.StatusDraft},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3}, ids)
+
+	history, err := s.GetDealHistory(ctx, 7, 3)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "imported", history[0].Reason)
+	assert.Equal(t, "user:7", history[0].Actor)
+
+	deals, err := s.GetAllDeals(ctx, 7)
+	require.NoError(t, err)
+	require.Len(t, deals, 3)
+	assert.Equal(t, "A", deals[1].Title)
+	assert.Equal(t, models.StatusPending, deals[1].Status)
+}
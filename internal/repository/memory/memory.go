@@ -0,0 +1,213 @@
+// Package memory is an in-memory storage backend implementing the storage
+// interfaces of package repository. It keeps the semantics and errors of the
+// Postgres repositories, so the server can run without a database for demos
+// and integration tests. Nothing survives a restart.
+package memory
+
+import (
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/pkg/hasher"
+	"Brocker-pet-project/pkg/requestlog"
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	_ repository.DealStore   = (*Store)(nil)
+	_ repository.UserStore   = (*Store)(nil)
+	_ repository.ProfitStore = (*Store)(nil)
+	_ repository.FxStore     = (*Store)(nil)
+)
+
+// deal is a row of transactions.
+type deal struct {
+	models.Deal
+	createdAt time.Time
+}
+
+// profit is a row of clear_profit.
+type profit struct {
+	models.ProfitSQLDeal
+	bookedAt time.Time
+}
+
+// Store holds every table behind a single mutex, so each method behaves like
+// one transaction.
+type Store struct {
+	mu sync.Mutex
+
+	redis  *redis.Client
+	hasher *hasher.Hasher
+	log    *zap.Logger
+	now    func() time.Time
+
+	users   []models.User
+	deals   map[int64]*deal
+	history []models.DealStatusChange
+	profits []profit
+	rates   []models.FxRate
+
+	lastUserId    int64
+	lastDealId    int64
+	lastHistoryId int64
+	lastProfitId  int64
+}
+
+// New creates an empty store. Deal caches are invalidated through redis
+// like the Postgres repository does; a nil client skips that. Errors are
+// logged to the request logger, or to log outside of requests.
+func New(redis *redis.Client, hasher *hasher.Hasher, log *zap.Logger) *Store {
+	return &Store{
+		redis:  redis,
+		hasher: hasher,
+		log:    log,
+		now:    func() time.Time { return time.Now().UTC() },
+		deals:  map[int64]*deal{},
+	}
+}
+
+// invalidate drops the cached deal listings of userId, and the cached profit
+// reports too when profit was booked. Like the Postgres repository it is
+// not cancelled with ctx. It must be called without s.mu held, so a slow
+// Redis does not block the other store calls.
+func (s *Store) invalidate(ctx context.Context, userId int64, profitBooked bool) {
+	if s.redis == nil {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+
+	s.redis.Del(ctx, repository.DealCacheKeys(userId)...)
+	if profitBooked {
+		s.redis.Incr(ctx, repository.ReportVersionKey(userId))
+	}
+}
+
+// NewUser stores a user with a hash of password. It fails with
+// repository.ErrUsernameTaken when the username is in use.
+func (s *Store) NewUser(ctx context.Context, username, password string) (*models.NewUserResponse, error) {
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if slices.ContainsFunc(s.users, func(user models.User) bool { return user.Username == username }) {
+		return nil, repository.ErrUsernameTaken
+	}
+
+	s.lastUserId++
+	s.users = append(s.users, models.User{Id: s.lastUserId, Username: username, Password: passwordHash})
+
+	return &models.NewUserResponse{Id: s.lastUserId, Username: username}, nil
+}
+
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+
+	return nil, repository.ErrUserNotFound
+}
+
+// Authenticate returns the user when password matches the stored hash, and
+// repository.ErrInvalidCredentials for an unknown user or a wrong password
+// alike. Hashes made with outdated parameters are replaced.
+func (s *Store) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	user, err := s.GetUserByUsername(ctx, username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		// Spend the time of a real check so the response does not reveal
+		// whether the username exists.
+		s.hasher.Verify(s.hasher.DummyHash(), password)
+		return nil, repository.ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ok, needsRehash := s.hasher.Verify(user.Password, password)
+	if !ok {
+		return nil, repository.ErrInvalidCredentials
+	}
+
+	if needsRehash {
+		s.rehash(ctx, user, password)
+	}
+
+	return user, nil
+}
+
+func (s *Store) rehash(ctx context.Context, user *models.User, password string) {
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		requestlog.Logger(ctx, s.log).Error("Error rehashing password", zap.Error(err), zap.Int64("user_id", user.Id))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.users {
+		if s.users[i].Id == user.Id && s.users[i].Password == user.Password {
+			s.users[i].Password = passwordHash
+			user.Password = passwordHash
+		}
+	}
+}
+
+// SaveRates stores rates. A rate for a pair and effective time that is
+// already stored is replaced.
+func (s *Store) SaveRates(ctx context.Context, rates []models.FxRate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rate := range rates {
+		i := slices.IndexFunc(s.rates, func(stored models.FxRate) bool {
+			return stored.Base == rate.Base && stored.Quote == rate.Quote && stored.EffectiveAt.Equal(rate.EffectiveAt)
+		})
+		if i >= 0 {
+			s.rates[i].Rate = rate.Rate
+		} else {
+			s.rates = append(s.rates, rate)
+		}
+	}
+
+	return nil
+}
+
+// GetRates returns every stored rate ordered by pair and effective time.
+func (s *Store) GetRates(ctx context.Context) ([]models.FxRate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rates := slices.Clone(s.rates)
+	if rates == nil {
+		rates = []models.FxRate{}
+	}
+
+	slices.SortFunc(rates, func(a, b models.FxRate) int {
+		if c := strings.Compare(a.Base, b.Base); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Quote, b.Quote); c != 0 {
+			return c
+		}
+		return a.EffectiveAt.Compare(b.EffectiveAt)
+	})
+
+	return rates, nil
+}
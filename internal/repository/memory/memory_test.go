@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/pkg/hasher"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestStore returns a store whose clock starts at start and advances by a
+// minute on every read.
+func newTestStore(start time.Time) *Store {
+	s := New(nil, hasher.NewHasher(bcrypt.MinCost), zap.NewNop())
+
+	now := start
+	s.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+
+	return s
+}
+
+func TestStore_Users(t *testing.T) {
+	s := newTestStore(time.Now())
+
+	created, err := s.NewUser(context.Background(), "alice", "password1")
+	require.NoError(t, err)
+	assert.Equal(t, &models.NewUserResponse{Id: 1, Username: "alice"}, created)
+
+	_, err = s.NewUser(context.Background(), "alice", "password2")
+	assert.ErrorIs(t, err, repository.ErrUsernameTaken)
+	assert.ErrorIs(t, err, repository.ErrConflict)
+
+	user, err := s.GetUserByUsername(context.Background(), "alice")
+	require.NoError(t, err)
+	// Пароль хранится только в виде хеша
+	assert.NotEqual(t, "password1", user.Password)
+
+	_, err = s.GetUserByUsername(context.Background(), "bob")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	user, err = s.Authenticate(context.Background(), "alice", "password1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), user.Id)
+
+	_, err = s.Authenticate(context.Background(), "alice", "wrong")
+	assert.ErrorIs(t, err, repository.ErrInvalidCredentials)
+	_, err = s.Authenticate(context.Background(), "bob", "password1")
+	assert.ErrorIs(t, err, repository.ErrInvalidCredentials)
+}
+
+func TestStore_Authenticate_Rehash(t *testing.T) {
+	s := newTestStore(time.Now())
+	s.hasher = hasher.NewHasher(bcrypt.MinCost + 1)
+
+	_, err := s.NewUser(context.Background(), "alice", "password1")
+	require.NoError(t, err)
+	old, _ := s.GetUserByUsername(context.Background(), "alice")
+
+	s.hasher = hasher.NewHasher(bcrypt.MinCost)
+
+	user, err := s.Authenticate(context.Background(), "alice", "password1")
+	require.NoError(t, err)
+	assert.NotEqual(t, old.Password, user.Password)
+
+	stored, _ := s.GetUserByUsername(context.Background(), "alice")
+	assert.Equal(t, user.Password, stored.Password)
+}
+
+func TestStore_Rates(t *testing.T) {
+	s := newTestStore(time.Now())
+	ctx := context.Background()
+
+	jan := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, s.SaveRates(ctx, []models.FxRate{
+		{Base: "USD", Quote: "EUR", Rate: decimal.RequireFromString("0.9"), EffectiveAt: feb},
+		{Base: "EUR", Quote: "USD", Rate: decimal.RequireFromString("1.1"), EffectiveAt: jan},
+	}))
+	// Курс на ту же дату заменяется
+	require.NoError(t, s.SaveRates(ctx, []models.FxRate{
+		{Base: "EUR", Quote: "USD", Rate: decimal.RequireFromString("1.085"), EffectiveAt: jan},
+	}))
+
+	rates, err := s.GetRates(ctx)
+	require.NoError(t, err)
+	require.Len(t, rates, 2)
+	assert.Equal(t, "EUR", rates[0].Base)
+	assert.True(t, decimal.RequireFromString("1.085").Equal(rates[0].Rate))
+	assert.Equal(t, "USD", rates[1].Base)
+
+	empty, err := newTestStore(time.Now()).GetRates(ctx)
+	require.NoError(t, err)
+	assert.NotNil(t, empty)
+}
+
+func TestStore_Authenticate_UnknownUserRunsHasher(t *testing.T) {
+	s := newTestStore(time.Now())
+	s.hasher = hasher.NewHasher(bcrypt.MinCost + 6)
+
+	dummy := s.hasher.DummyHash()
+	start := time.Now()
+	s.hasher.Verify(dummy, "password1")
+	verifyTime := time.Since(start)
+
+	start = time.Now()
+	_, err := s.Authenticate(context.Background(), "nobody", "password1")
+	elapsed := time.Since(start)
+
+	assert.ErrorIs(t, err, repository.ErrInvalidCredentials)
+	// Неизвестный пользователь проверяется так же долго, как настоящий пароль
+	assert.GreaterOrEqual(t, elapsed, verifyTime/2)
+}
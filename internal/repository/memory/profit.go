@@ -0,0 +1,217 @@
+package memory
+
+import (
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/internal/repository"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"slices"
+	"strings"
+	"time"
+)
+
+// errAlreadyBooked is returned by insertProfit for a deal that has a
+// clear_profit row already.
+var errAlreadyBooked = errors.New("profit already booked")
+
+func (s *Store) insertProfit(fields models.ProfitSQLDeal) (*models.ProfitSQLDeal, error) {
+	if slices.ContainsFunc(s.profits, func(p profit) bool { return p.DealId == fields.DealId }) {
+		return nil, errAlreadyBooked
+	}
+
+	s.lastProfitId++
+	fields.Id = s.lastProfitId
+	s.profits = append(s.profits, profit{ProfitSQLDeal: fields, bookedAt: s.now()})
+
+	return &fields, nil
+}
+
+// AddProfit books the profit of a deal. Booking a deal twice fails with
+// repository.ErrConflict.
+func (s *Store) AddProfit(ctx context.Context, fields models.ProfitSQLDeal) (*models.ProfitSQLDeal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	booked, err := s.insertProfit(fields)
+	if errors.Is(err, errAlreadyBooked) {
+		return nil, fmt.Errorf("%w: profit for deal %d is already booked", repository.ErrConflict, fields.DealId)
+	}
+
+	return booked, err
+}
+
+func (s *Store) GetAllProfitInfo(ctx context.Context, userId int64) ([]models.ProfitSQLDeal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profits := []models.ProfitSQLDeal{}
+	for _, p := range s.profits {
+		if p.UserId == userId {
+			profits = append(profits, p.ProfitSQLDeal)
+		}
+	}
+
+	return profits, nil
+}
+
+// bookedIn returns the profit of userId booked in rng, in booking order.
+func (s *Store) bookedIn(userId int64, rng models.ProfitRange) []profit {
+	var booked []profit
+	for _, p := range s.profits {
+		if p.UserId != userId {
+			continue
+		}
+		if rng.From != nil && p.bookedAt.Before(*rng.From) {
+			continue
+		}
+		if rng.To != nil && !p.bookedAt.Before(*rng.To) {
+			continue
+		}
+		booked = append(booked, p)
+	}
+	return booked
+}
+
+// ProfitTotals returns the clear profit booked in rng per reporting currency.
+func (s *Store) ProfitTotals(ctx context.Context, userId int64, rng models.ProfitRange) ([]models.ProfitTotal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totals := []models.ProfitTotal{}
+
+	for _, p := range s.bookedIn(userId, rng) {
+		i := slices.IndexFunc(totals, func(total models.ProfitTotal) bool { return total.Currency == p.ReportingCurrency })
+		if i < 0 {
+			totals = append(totals, models.ProfitTotal{Currency: p.ReportingCurrency})
+			i = len(totals) - 1
+		}
+		totals[i].Total = totals[i].Total.Add(p.ReportingProfit)
+		totals[i].Deals++
+	}
+
+	slices.SortFunc(totals, func(a, b models.ProfitTotal) int { return strings.Compare(a.Currency, b.Currency) })
+
+	return totals, nil
+}
+
+// ProfitByPeriod returns the clear profit booked in rng grouped by UTC day,
+// week or month, with running totals from the start of the range.
+func (s *Store) ProfitByPeriod(ctx context.Context, userId int64, period string, rng models.ProfitRange) ([]models.ProfitPeriod, error) {
+	if period != "day" && period != "week" && period != "month" {
+		return nil, repository.ErrInvalidPeriod
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	periods := []models.ProfitPeriod{}
+
+	for _, p := range s.bookedIn(userId, rng) {
+		start := truncate(p.bookedAt, period)
+		i := slices.IndexFunc(periods, func(pp models.ProfitPeriod) bool {
+			return pp.Period.Equal(start) && pp.Currency == p.ReportingCurrency
+		})
+		if i < 0 {
+			periods = append(periods, models.ProfitPeriod{Period: start, Currency: p.ReportingCurrency})
+			i = len(periods) - 1
+		}
+		periods[i].Total = periods[i].Total.Add(p.ReportingProfit)
+		periods[i].Deals++
+	}
+
+	slices.SortFunc(periods, func(a, b models.ProfitPeriod) int {
+		if c := a.Period.Compare(b.Period); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Currency, b.Currency)
+	})
+
+	running := map[string]decimal.Decimal{}
+	for i := range periods {
+		running[periods[i].Currency] = running[periods[i].Currency].Add(periods[i].Total)
+		periods[i].RunningTotal = running[periods[i].Currency]
+	}
+
+	return periods, nil
+}
+
+// truncate returns the start of the UTC day, ISO week or month of t, as
+// date_trunc does.
+func truncate(t time.Time, period string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch period {
+	case "week":
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// TopProfitDeals returns up to limit deals booked in rng with the highest
+// clear profit.
+func (s *Store) TopProfitDeals(ctx context.Context, userId int64, rng models.ProfitRange, limit int) ([]models.ProfitDeal, error) {
+	return s.profitDeals(userId, rng, limit, false)
+}
+
+// LossDeals returns up to limit deals booked in rng that lost money, the
+// largest loss first.
+func (s *Store) LossDeals(ctx context.Context, userId int64, rng models.ProfitRange, limit int) ([]models.ProfitDeal, error) {
+	return s.profitDeals(userId, rng, limit, true)
+}
+
+func (s *Store) profitDeals(userId int64, rng models.ProfitRange, limit int, losses bool) ([]models.ProfitDeal, error) {
+	if limit <= 0 {
+		limit = repository.DefaultReportLimit
+	}
+	limit = min(limit, repository.MaxReportLimit)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deals := []models.ProfitDeal{}
+
+	for _, p := range s.bookedIn(userId, rng) {
+		if losses && !p.ReportingProfit.IsNegative() {
+			continue
+		}
+
+		// clear_profit rows are joined with the deals they belong to.
+		d, ok := s.deals[p.DealId]
+		if !ok {
+			continue
+		}
+
+		deals = append(deals, models.ProfitDeal{
+			DealId:            p.DealId,
+			Title:             d.Title,
+			Profit:            p.AllProfit,
+			Currency:          p.Currency,
+			ReportingProfit:   p.ReportingProfit,
+			ReportingCurrency: p.ReportingCurrency,
+			BookedAt:          p.bookedAt,
+		})
+	}
+
+	slices.SortFunc(deals, func(a, b models.ProfitDeal) int {
+		c := a.ReportingProfit.Cmp(b.ReportingProfit)
+		if !losses {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+		return cmp.Compare(a.DealId, b.DealId)
+	})
+
+	if len(deals) > limit {
+		deals = deals[:limit]
+	}
+
+	return deals, nil
+}
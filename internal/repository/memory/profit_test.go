@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/internal/repository"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_AddProfit(t *testing.T) {
+	s := newTestStore(time.Now())
+
+	profit := models.ProfitSQLDeal{DealId: 1, UserId: 7, AllProfit: decimal.NewFromInt(10), Currency: "USD",
+		ReportingProfit: decimal.NewFromInt(10), ReportingCurrency: "USD", FxRate: decimal.NewFromInt(1)}
+
+	booked, err := s.AddProfit(context.Background(), profit)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), booked.Id)
+
+	_, err = s.AddProfit(context.Background(), profit)
+	assert.ErrorIs(t, err, repository.ErrConflict)
+}
+
+func TestStore_ProfitReports(t *testing.T) {
+	s := newTestStore(time.Now())
+	ctx := context.Background()
+
+	// Прибыль первой сделки проводится в понедельник, второй — во вторник
+	bookedAt := time.Date(2025, 3, 3, 23, 59, 0, 0, time.UTC)
+	s.now = func() time.Time { return bookedAt }
+
+	createDeal(t, s, 7, "Win", "100", "250", "USD", models.StatusPending)
+	_, err := s.ProcessNextDeal(ctx, "USD", clearProfit)
+	require.NoError(t, err)
+
+	bookedAt = bookedAt.Add(5 * time.Minute)
+
+	createDeal(t, s, 7, "Loss", "100", "60", "USD", models.StatusPending)
+	_, err = s.ProcessNextDeal(ctx, "USD", clearProfit)
+	require.NoError(t, err)
+
+	totals, err := s.ProfitTotals(ctx, 7, models.ProfitRange{})
+	require.NoError(t, err)
+	require.Len(t, totals, 1)
+	assert.True(t, decimal.NewFromInt(110).Equal(totals[0].Total))
+	assert.Equal(t, int64(2), totals[0].Deals)
+
+	days, err := s.ProfitByPeriod(ctx, 7, "day", models.ProfitRange{})
+	require.NoError(t, err)
+	require.Len(t, days, 2)
+	assert.Equal(t, time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC), days[0].Period)
+	assert.True(t, decimal.NewFromInt(110).Equal(days[1].RunningTotal))
+
+	weeks, err := s.ProfitByPeriod(ctx, 7, "week", models.ProfitRange{})
+	require.NoError(t, err)
+	require.Len(t, weeks, 1)
+	assert.Equal(t, time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC), weeks[0].Period)
+
+	_, err = s.ProfitByPeriod(ctx, 7, "year", models.ProfitRange{})
+	assert.ErrorIs(t, err, repository.ErrInvalidPeriod)
+
+	from := time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)
+	totals, err = s.ProfitTotals(ctx, 7, models.ProfitRange{From: &from})
+	require.NoError(t, err)
+	require.Len(t, totals, 1)
+	assert.Equal(t, int64(1), totals[0].Deals)
+
+	top, err := s.TopProfitDeals(ctx, 7, models.ProfitRange{}, 0)
+	require.NoError(t, err)
+	require.Len(t, top, 2)
+	assert.Equal(t, "Win", top[0].Title)
+
+	losses, err := s.LossDeals(ctx, 7, models.ProfitRange{}, 0)
+	require.NoError(t, err)
+	require.Len(t, losses, 1)
+	assert.Equal(t, "Loss", losses[0].Title)
+	assert.True(t, decimal.NewFromInt(-40).Equal(losses[0].ReportingProfit))
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"Brocker-pet-project/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	DefaultReportLimit = 10
+	MaxReportLimit     = 100
+)
+
+var ErrInvalidPeriod = errors.New("period must be day, week or month")
+
+// reportPeriods are the date_trunc units a report can group by.
+var reportPeriods = map[string]bool{"day": true, "week": true, "month": true}
+
+// Reports sum reporting_profit, so profit booked in different deal
+// currencies adds up. Rows booked while another reporting currency was
+// configured are kept apart by grouping on reporting_currency.
+
+// profitWhere returns the conditions selecting the user's clear_profit rows
+// booked in rng, with the arguments for $1..$n.
+func profitWhere(userId int64, rng models.ProfitRange) (string, []any) {
+	conditions := []string{"c.user_id=$1"}
+	args := []any{userId}
+
+	if rng.From != nil {
+		args = append(args, *rng.From)
+		conditions = append(conditions, fmt.Sprintf("c.booked_at >= $%d", len(args)))
+	}
+	if rng.To != nil {
+		args = append(args, *rng.To)
+		conditions = append(conditions, fmt.Sprintf("c.booked_at < $%d", len(args)))
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// ProfitTotals returns the clear profit booked in rng per reporting currency.
+func (h *ProfitRepository) ProfitTotals(ctx context.Context, userId int64, rng models.ProfitRange) ([]models.ProfitTotal, error) {
+	where, args := profitWhere(userId, rng)
+
+	query := `SELECT c.reporting_currency, SUM(c.reporting_profit), COUNT(*)
+	FROM clear_profit c
+	WHERE ` + where + `
+	GROUP BY c.reporting_currency
+	ORDER BY c.reporting_currency;`
+
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	totals := []models.ProfitTotal{}
+
+	for rows.Next() {
+		var total models.ProfitTotal
+		if err := rows.Scan(&total.Currency, &total.Total, &total.Deals); err != nil {
+			return nil, mapError(err)
+		}
+		totals = append(totals, total)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+
+	return totals, nil
+}
+
+// ProfitByPeriod returns the clear profit booked in rng grouped by UTC day,
+// week or month, with running totals from the start of the range.
+func (h *ProfitRepository) ProfitByPeriod(ctx context.Context, userId int64, period string, rng models.ProfitRange) ([]models.ProfitPeriod, error) {
+	if !reportPeriods[period] {
+		return nil, ErrInvalidPeriod
+	}
+
+	where, args := profitWhere(userId, rng)
+	args = append(args, period)
+
+	query := fmt.Sprintf(`SELECT period, reporting_currency, total, deals,
+	SUM(total) OVER (PARTITION BY reporting_currency ORDER BY period)
+	FROM (
+		SELECT date_trunc($%d, c.booked_at AT TIME ZONE 'UTC') AS period, c.reporting_currency,
+		SUM(c.reporting_profit) AS total, COUNT(*) AS deals
+		FROM clear_profit c
+		WHERE %s
+		GROUP BY period, c.reporting_currency
+	) AS periods
+	ORDER BY period, reporting_currency;`, len(args), where)
+
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	periods := []models.ProfitPeriod{}
+
+	for rows.Next() {
+		var p models.ProfitPeriod
+		if err := rows.Scan(&p.Period, &p.Currency, &p.Total, &p.Deals, &p.RunningTotal); err != nil {
+			return nil, mapError(err)
+		}
+		p.Period = p.Period.UTC()
+		periods = append(periods, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+
+	return periods, nil
+}
+
+// TopProfitDeals returns up to limit deals booked in rng with the highest
+// clear profit.
+func (h *ProfitRepository) TopProfitDeals(ctx context.Context, userId int64, rng models.ProfitRange, limit int) ([]models.ProfitDeal, error) {
+	return h.profitDeals(ctx, userId, rng, limit, false)
+}
+
+// LossDeals returns up to limit deals booked in rng that lost money, the
+// largest loss first.
+func (h *ProfitRepository) LossDeals(ctx context.Context, userId int64, rng models.ProfitRange, limit int) ([]models.ProfitDeal, error) {
+	return h.profitDeals(ctx, userId, rng, limit, true)
+}
+
+func (h *ProfitRepository) profitDeals(ctx context.Context, userId int64, rng models.ProfitRange, limit int, losses bool) ([]models.ProfitDeal, error) {
+	if limit <= 0 {
+		limit = DefaultReportLimit
+	}
+	limit = min(limit, MaxReportLimit)
+
+	where, args := profitWhere(userId, rng)
+	order := "DESC"
+	if losses {
+		where += " AND c.reporting_profit < 0"
+		order = "ASC"
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`SELECT c.deals_id, t.title, c.all_profit, c.currency, c.reporting_profit, c.reporting_currency, c.booked_at
+	FROM clear_profit c
+	JOIN transactions t ON t.id = c.deals_id
+	WHERE %s
+	ORDER BY c.reporting_profit %s, c.deals_id
+	LIMIT $%d;`, where, order, len(args))
+
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	deals := []models.ProfitDeal{}
+
+	for rows.Next() {
+		var deal models.ProfitDeal
+		if err := rows.Scan(&deal.DealId, &deal.Title, &deal.Profit, &deal.Currency,
+			&deal.ReportingProfit, &deal.ReportingCurrency, &deal.BookedAt); err != nil {
+			return nil, mapError(err)
+		}
+		deals = append(deals, deal)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+
+	return deals, nil
+}
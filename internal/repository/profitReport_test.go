@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"Brocker-pet-project/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfitRepository_ProfitTotals(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT c.reporting_currency, SUM\(c.reporting_profit\), COUNT\(\*\) FROM clear_profit c WHERE c.user_id=\$1 AND c.booked_at >= \$2 AND c.booked_at < \$3 GROUP BY c.reporting_currency`).
+		WithArgs(int64(7), from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"reporting_currency", "sum", "count"}).
+			AddRow("USD", "1250.5", 3))
+
+	totals, err := NewProfitRepository(db).ProfitTotals(context.Background(), 7, models.ProfitRange{From: &from, To: &to})
+	require.NoError(t, err)
+	assert.Equal(t, []models.ProfitTotal{{Currency: "USD", Total: decimal.RequireFromString("1250.5"), Deals: 3}}, totals)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProfitRepository_ProfitByPeriod(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	jan := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	// Нарастающий итог считается оконной функцией в той же выборке
+	mock.ExpectQuery(`SUM\(total\) OVER \(PARTITION BY reporting_currency ORDER BY period\) FROM \( SELECT date_trunc\(\$2, c.booked_at AT TIME ZONE 'UTC'\) AS period`).
+		WithArgs(int64(7), "month").
+		WillReturnRows(sqlmock.NewRows([]string{"period", "reporting_currency", "total", "deals", "sum"}).
+			AddRow(jan, "USD", "100", 2, "100").
+			AddRow(feb, "USD", "-40", 1, "60"))
+
+	repo := NewProfitRepository(db)
+
+	periods, err := repo.ProfitByPeriod(context.Background(), 7, "month", models.ProfitRange{})
+	require.NoError(t, err)
+	assert.Equal(t, []models.ProfitPeriod{
+		{Period: jan, Currency: "USD", Total: decimal.NewFromInt(100), Deals: 2, RunningTotal: decimal.NewFromInt(100)},
+		{Period: feb, Currency: "USD", Total: decimal.NewFromInt(-40), Deals: 1, RunningTotal: decimal.NewFromInt(60)},
+	}, periods)
+
+	_, err = repo.ProfitByPeriod(context.Background(), 7, "year", models.ProfitRange{})
+	assert.ErrorIs(t, err, ErrInvalidPeriod)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProfitRepository_TopAndLossDeals(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	columns := []string{"deals_id", "title", "all_profit", "currency", "reporting_profit", "reporting_currency", "booked_at"}
+	bookedAt := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`FROM clear_profit c JOIN transactions t ON t.id = c.deals_id WHERE c.user_id=\$1 ORDER BY c.reporting_profit DESC, c.deals_id LIMIT \$2`).
+		WithArgs(int64(7), MaxReportLimit).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(3, "Deal 3", "500", "EUR", "542.5", "USD", bookedAt))
+
+	mock.ExpectQuery(`WHERE c.user_id=\$1 AND c.reporting_profit < 0 ORDER BY c.reporting_profit ASC, c.deals_id LIMIT \$2`).
+		WithArgs(int64(7), DefaultReportLimit).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(4, "Deal 4", "-20", "USD", "-20", "USD", bookedAt))
+
+	repo := NewProfitRepository(db)
+
+	// Лимит больше максимального обрезается
+	top, err := repo.TopProfitDeals(context.Background(), 7, models.ProfitRange{}, 1000)
+	require.NoError(t, err)
+	require.Len(t, top, 1)
+	assert.Equal(t, int64(3), top[0].DealId)
+	assert.Equal(t, "542.5", top[0].ReportingProfit.String())
+
+	losses, err := repo.LossDeals(context.Background(), 7, models.ProfitRange{}, 0)
+	require.NoError(t, err)
+	require.Len(t, losses, 1)
+	assert.True(t, losses[0].ReportingProfit.IsNegative())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -4,7 +4,8 @@ import (
 	"Brocker-pet-project/internal/models"
 	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
 )
 
 type ProfitRepository struct {
@@ -15,54 +16,76 @@ func NewProfitRepository(db *sql.DB) *ProfitRepository {
 	return &ProfitRepository{db}
 }
 
-func (h *ProfitRepository) AddProfitById(dealId int64, allProfit float64) *models.ProfitSQLDeal {
-	query := `INSERT INTO clear_profit (deals_id,all_profit)
-	VALUES ($1,$2)
-	RETURNING id, deals_id,all_profit;`
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
 
-	row := h.db.QueryRow(query, dealId, allProfit)
+// profitColumns is the column list every clear_profit query selects or
+// returns, in the order scanProfit expects.
+const profitColumns = `id, deals_id, COALESCE(user_id, 0), all_profit, currency, reporting_profit, reporting_currency, fx_rate`
 
-	var profit models.ProfitSQLDeal
+func scanProfit(row rowScanner, profit *models.ProfitSQLDeal) error {
+	return row.Scan(&profit.Id, &profit.DealId, &profit.UserId, &profit.AllProfit,
+		&profit.Currency, &profit.ReportingProfit, &profit.ReportingCurrency, &profit.FxRate)
+}
 
-	if err := row.Scan(&profit.Id, &profit.DealId, &profit.AllProfit); err != nil {
-		log.Printf("Error parsing sql response: %v", err)
-		return nil
-	}
+// insertProfit books the profit of a deal. clear_profit holds at most one row
+// per deal, so booking a deal twice returns sql.ErrNoRows instead of adding
+// a duplicate.
+func insertProfit(ctx context.Context, q queryRower, profit models.ProfitSQLDeal) (*models.ProfitSQLDeal, error) {
+	query := `INSERT INTO clear_profit (deals_id,user_id,all_profit,currency,reporting_profit,reporting_currency,fx_rate)
+	VALUES ($1,NULLIF($2,0),$3,$4,$5,$6,$7)
+	ON CONFLICT (deals_id) DO NOTHING
+	RETURNING ` + profitColumns + `;`
+
+	row := q.QueryRowContext(ctx, query, profit.DealId, profit.UserId, profit.AllProfit, profit.Currency,
+		profit.ReportingProfit, profit.ReportingCurrency, profit.FxRate)
+
+	var booked models.ProfitSQLDeal
 
-	if profit.Id == 0 {
-		log.Print("Error parsing sql response")
-		return nil
+	if err := scanProfit(row, &booked); err != nil {
+		return nil, err
 	}
 
-	return &profit
+	return &booked, nil
+}
+
+// AddProfit books the profit of a deal. Booking a deal twice fails with
+// ErrConflict.
+func (h *ProfitRepository) AddProfit(ctx context.Context, profit models.ProfitSQLDeal) (*models.ProfitSQLDeal, error) {
+	booked, err := insertProfit(ctx, h.db, profit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: profit for deal %d is already booked", ErrConflict, profit.DealId)
+	}
+	if err != nil {
+		return nil, mapError(err)
+	}
 
+	return booked, nil
 }
 
-func (h *ProfitRepository) GetAllProfitInfo(ctx context.Context) *[]models.ProfitSQLDeal {
-	query := `SELECT id, deals_id, all_profit FROM clear_profit;`
+func (h *ProfitRepository) GetAllProfitInfo(ctx context.Context, userId int64) ([]models.ProfitSQLDeal, error) {
+	query := `SELECT ` + profitColumns + ` FROM clear_profit WHERE user_id=$1;`
 
-	rows, err := h.db.QueryContext(ctx, query)
+	rows, err := h.db.QueryContext(ctx, query, userId)
 	if err != nil {
-		log.Printf("Error executing sql query: %v", err)
-		return nil
+		return nil, mapError(err)
 	}
 	defer rows.Close()
 
-	var profits []models.ProfitSQLDeal
+	profits := []models.ProfitSQLDeal{}
 
 	for rows.Next() {
 		var profit models.ProfitSQLDeal
-		if err := rows.Scan(&profit.Id, &profit.DealId, &profit.AllProfit); err != nil {
-			log.Printf("Error scanning sql response: %v", err)
-			return nil
+		if err := scanProfit(rows, &profit); err != nil {
+			return nil, mapError(err)
 		}
 		profits = append(profits, profit)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("Error after scanning rows: %v", err)
-		return nil
+		return nil, mapError(err)
 	}
 
-	return &profits
+	return profits, nil
 }
@@ -3,52 +3,78 @@ package repository
 import (
 	"Brocker-pet-project/internal/models"
 	"context"
+	"database/sql/driver"
 	"errors"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestProfitRepository_AddProfitById(t *testing.T) {
+var profitRowColumns = []string{"id", "deals_id", "user_id", "all_profit", "currency", "reporting_profit", "reporting_currency", "fx_rate"}
+
+func TestProfitRepository_AddProfit(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 
 	repo := NewProfitRepository(db)
 
+	profit := models.ProfitSQLDeal{
+		DealId:            1,
+		UserId:            7,
+		AllProfit:         decimal.RequireFromString("100.50"),
+		Currency:          "EUR",
+		ReportingProfit:   decimal.RequireFromString("109.0425"),
+		ReportingCurrency: "USD",
+		FxRate:            decimal.RequireFromString("1.085"),
+	}
+	args := []driver.Value{int64(1), int64(7), "100.5", "EUR", "109.0425", "USD", "1.085"}
+
 	tests := []struct {
 		name        string
-		dealId      int64
-		allProfit   float64
 		mock        func()
 		expected    *models.ProfitSQLDeal
 		expectError bool
+		conflict    bool
 	}{
 		{
-			name:      "successful add profit",
-			dealId:    1,
-			allProfit: 100.50,
+			name: "successful add profit",
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "deals_id", "all_profit"}).
-					AddRow(1, 1, 100.50)
-				mock.ExpectQuery(`INSERT INTO clear_profit \(deals_id,all_profit\) VALUES \(\$1,\$2\) RETURNING id, deals_id,all_profit`).
-					WithArgs(int64(1), 100.50).
+				rows := sqlmock.NewRows(profitRowColumns).
+					AddRow(1, 1, 7, "100.50", "EUR", "109.0425", "USD", "1.085")
+				mock.ExpectQuery(`INSERT INTO clear_profit \(deals_id,user_id,all_profit,currency,reporting_profit,reporting_currency,fx_rate\) VALUES \(\$1,NULLIF\(\$2,0\),\$3,\$4,\$5,\$6,\$7\) ON CONFLICT \(deals_id\) DO NOTHING RETURNING id, deals_id, COALESCE\(user_id, 0\), all_profit`).
+					WithArgs(args...).
 					WillReturnRows(rows)
 			},
 			expected: &models.ProfitSQLDeal{
-				Id:        1,
-				DealId:    1,
-				AllProfit: 100.50,
+				Id:                1,
+				DealId:            1,
+				UserId:            7,
+				AllProfit:         decimal.RequireFromString("100.50"),
+				Currency:          "EUR",
+				ReportingProfit:   decimal.RequireFromString("109.0425"),
+				ReportingCurrency: "USD",
+				FxRate:            decimal.RequireFromString("1.085"),
 			},
 			expectError: false,
 		},
 		{
-			name:      "database error",
-			dealId:    1,
-			allProfit: 100.50,
+			name: "already booked",
 			mock: func() {
-				mock.ExpectQuery(`INSERT INTO clear_profit \(deals_id,all_profit\) VALUES \(\$1,\$2\) RETURNING id, deals_id,all_profit`).
-					WithArgs(int64(1), 100.50).
+				mock.ExpectQuery(`INSERT INTO clear_profit`).
+					WithArgs(args...).
+					WillReturnRows(sqlmock.NewRows(profitRowColumns))
+			},
+			expected:    nil,
+			expectError: true,
+			conflict:    true,
+		},
+		{
+			name: "database error",
+			mock: func() {
+				mock.ExpectQuery(`INSERT INTO clear_profit`).
+					WithArgs(args...).
 					WillReturnError(errors.New("database error"))
 			},
 			expected:    nil,
@@ -59,11 +85,14 @@ func TestProfitRepository_AddProfitById(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mock()
-			result := repo.AddProfitById(tt.dealId, tt.allProfit)
+			result, err := repo.AddProfit(context.Background(), profit)
 
 			if tt.expectError {
+				assert.Error(t, err)
+				assert.Equal(t, tt.conflict, errors.Is(err, ErrConflict))
 				assert.Nil(t, result)
 			} else {
+				assert.NoError(t, err)
 				assert.Equal(t, tt.expected, result)
 			}
 
@@ -81,28 +110,32 @@ func TestProfitRepository_GetAllProfitInfo(t *testing.T) {
 	tests := []struct {
 		name        string
 		mock        func()
-		expected    *[]models.ProfitSQLDeal
+		expected    []models.ProfitSQLDeal
 		expectError bool
 	}{
 		{
 			name: "successful get all profits",
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "deals_id", "all_profit"}).
-					AddRow(1, 1, 100.50).
-					AddRow(2, 2, 200.75)
-				mock.ExpectQuery(`SELECT id, deals_id, all_profit FROM clear_profit;`).
+				rows := sqlmock.NewRows(profitRowColumns).
+					AddRow(1, 1, 7, "100.50", "USD", "100.50", "USD", "1").
+					AddRow(2, 2, 7, 200.75, "EUR", "217.8138", "USD", "1.085")
+				mock.ExpectQuery(`SELECT (.+) FROM clear_profit WHERE user_id=\$1;`).
+					WithArgs(int64(7)).
 					WillReturnRows(rows)
 			},
-			expected: &[]models.ProfitSQLDeal{
-				{Id: 1, DealId: 1, AllProfit: 100.50},
-				{Id: 2, DealId: 2, AllProfit: 200.75},
+			expected: []models.ProfitSQLDeal{
+				{Id: 1, DealId: 1, UserId: 7, AllProfit: decimal.RequireFromString("100.50"), Currency: "USD",
+					ReportingProfit: decimal.RequireFromString("100.50"), ReportingCurrency: "USD", FxRate: decimal.NewFromInt(1)},
+				{Id: 2, DealId: 2, UserId: 7, AllProfit: decimal.RequireFromString("200.75"), Currency: "EUR",
+					ReportingProfit: decimal.RequireFromString("217.8138"), ReportingCurrency: "USD", FxRate: decimal.RequireFromString("1.085")},
 			},
 			expectError: false,
 		},
 		{
 			name: "database error",
 			mock: func() {
-				mock.ExpectQuery(`SELECT id, deals_id, all_profit FROM clear_profit;`).
+				mock.ExpectQuery(`SELECT (.+) FROM clear_profit WHERE user_id=\$1;`).
+					WithArgs(int64(7)).
 					WillReturnError(errors.New("database error"))
 			},
 			expected:    nil,
@@ -111,11 +144,12 @@ func TestProfitRepository_GetAllProfitInfo(t *testing.T) {
 		{
 			name: "empty result",
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "deals_id", "all_profit"})
-				mock.ExpectQuery(`SELECT id, deals_id, all_profit FROM clear_profit;`).
+				rows := sqlmock.NewRows(profitRowColumns)
+				mock.ExpectQuery(`SELECT (.+) FROM clear_profit WHERE user_id=\$1;`).
+					WithArgs(int64(7)).
 					WillReturnRows(rows)
 			},
-			expected:    &[]models.ProfitSQLDeal{},
+			expected:    []models.ProfitSQLDeal{},
 			expectError: false,
 		},
 	}
@@ -123,21 +157,16 @@ func TestProfitRepository_GetAllProfitInfo(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mock()
-			result := repo.GetAllProfitInfo(context.Background())
+			result, err := repo.GetAllProfitInfo(context.Background(), 7)
 
 			if tt.expectError {
+				assert.Error(t, err)
 				assert.Nil(t, result)
 			} else {
-				if tt.expected == nil {
-					assert.Nil(t, result)
-				} else {
-					assert.NotNil(t, result)
-					if len(*tt.expected) == 0 {
-						assert.Empty(t, *result)
-					} else {
-						assert.Equal(t, tt.expected, result)
-					}
-				}
+				assert.NoError(t, err)
+				// Пустой результат — пустой срез, а не nil
+				assert.NotNil(t, result)
+				assert.Equal(t, tt.expected, result)
 			}
 
 			assert.NoError(t, mock.ExpectationsWereMet())
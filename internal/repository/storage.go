@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"Brocker-pet-project/internal/models"
+	"context"
+	"github.com/shopspring/decimal"
+)
+
+// The storage interfaces are what handlers and DealWorker depend on. The
+// Postgres repositories of this package implement them, and so does the
+// in-memory backend of package memory; both return the errors documented
+// here and on the Postgres methods.
+
+// DealStore stores deals and their status history.
+type DealStore interface {
+	CreateNewDeal(ctx context.Context, userId int64, title string, expenses, profit decimal.Decimal, currency, status string) (*models.Deal, error)
+	GetDealById(ctx context.Context, userId, id int64) (*models.Deal, error)
+	UpdateDeal(ctx context.Context, userId, id int64, patch models.DealPatch) (*models.Deal, error)
+	DeleteDeal(ctx context.Context, userId, id int64) error
+	ChangeDealStatus(ctx context.Context, userId, id int64, to, actor, reason string) (*models.Deal, error)
+	GetDealHistory(ctx context.Context, userId, id int64) ([]models.DealStatusChange, error)
+	GetAllProcessedDeals(ctx context.Context, userId int64) ([]models.Deal, error)
+	GetAllNotProcessedDeals(ctx context.Context, userId int64) ([]models.Deal, error)
+	GetAllDeals(ctx context.Context, userId int64) ([]models.Deal, error)
+	ListDeals(ctx context.Context, userId int64, filter models.DealFilter) (*models.DealPage, error)
+	ExportDeals(ctx context.Context, userId int64, filter models.DealFilter, fn func(models.DealExport) error) error
+	ImportDeals(ctx context.Context, userId int64, deals []models.Deal) ([]int64, error)
+	ProcessNextDeal(ctx context.Context, reportingCurrency string, clearProfit func(models.Deal) decimal.Decimal) (*models.Deal, error)
+	CountPendingDeals(ctx context.Context) (int64, error)
+}
+
+// UserStore stores users and checks their credentials.
+type UserStore interface {
+	NewUser(ctx context.Context, username, password string) (*models.NewUserResponse, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	Authenticate(ctx context.Context, username, password string) (*models.User, error)
+}
+
+// ProfitStore stores booked clear profit and reports on it.
+type ProfitStore interface {
+	AddProfit(ctx context.Context, profit models.ProfitSQLDeal) (*models.ProfitSQLDeal, error)
+	GetAllProfitInfo(ctx context.Context, userId int64) ([]models.ProfitSQLDeal, error)
+	ProfitTotals(ctx context.Context, userId int64, rng models.ProfitRange) ([]models.ProfitTotal, error)
+	ProfitByPeriod(ctx context.Context, userId int64, period string, rng models.ProfitRange) ([]models.ProfitPeriod, error)
+	TopProfitDeals(ctx context.Context, userId int64, rng models.ProfitRange, limit int) ([]models.ProfitDeal, error)
+	LossDeals(ctx context.Context, userId int64, rng models.ProfitRange, limit int) ([]models.ProfitDeal, error)
+}
+
+// FxStore stores the FX rates profit is converted with.
+type FxStore interface {
+	SaveRates(ctx context.Context, rates []models.FxRate) error
+	GetRates(ctx context.Context) ([]models.FxRate, error)
+}
+
+var (
+	_ DealStore   = (*DealRepository)(nil)
+	_ UserStore   = (*UserRepository)(nil)
+	_ ProfitStore = (*ProfitRepository)(nil)
+	_ FxStore     = (*FxRepository)(nil)
+)
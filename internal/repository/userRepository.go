@@ -2,59 +2,126 @@ package repository
 
 import (
 	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/pkg/hasher"
+	"Brocker-pet-project/pkg/requestlog"
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUserNotFound       = fmt.Errorf("user %w", ErrNotFound)
+	ErrUsernameTaken      = fmt.Errorf("%w: username already taken", ErrConflict)
+	ErrInvalidCredentials = errors.New("invalid username or password")
 )
 
 type UserRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	hasher *hasher.Hasher
+	log    *zap.Logger
 }
 
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+// NewUserRepository creates a repository logging to the request logger of
+// the context it is called with, or to log outside of requests.
+func NewUserRepository(db *sql.DB, hasher *hasher.Hasher, log *zap.Logger) *UserRepository {
+	return &UserRepository{db: db, hasher: hasher, log: log}
 }
 
-func (h *UserRepository) NewUser(username, password string) *models.NewUserResponse {
+// NewUser stores a user with a hash of password. It fails with
+// ErrUsernameTaken when the username is in use.
+func (h *UserRepository) NewUser(ctx context.Context, username, password string) (*models.NewUserResponse, error) {
 	query := `INSERT INTO users 
     (username,password) 
 	VALUES ($1,$2)
 	RETURNING id,username;`
 
-	row := h.db.QueryRow(query, username, password)
+	passwordHash, err := h.hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	row := h.db.QueryRowContext(ctx, query, username, passwordHash)
 
 	var user models.NewUserResponse
 
 	if err := row.Scan(&user.Id, &user.Username); err != nil {
-		log.Printf("Error scaning sql response: %v", err)
-		return nil
-	}
-
-	if user.Id == 0 {
-		log.Print("Error creating new user")
-		return nil
+		err = mapError(err)
+		if errors.Is(err, ErrConflict) {
+			return nil, ErrUsernameTaken
+		}
+		return nil, err
 	}
 
-	return &user
+	return &user, nil
 
 }
 
-func (h *UserRepository) GetUserByUsername(username, password string) *models.User {
-	query := `SELECT * FROM users WHERE username=$1 AND password=$2;`
+func (h *UserRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := `SELECT id, username, password FROM users WHERE username=$1;`
 
-	row := h.db.QueryRow(query, username, password)
+	row := h.db.QueryRowContext(ctx, query, username)
 
 	var user models.User
 
-	if err := row.Scan(&user.Id, &user.Username, &user.Password); err != nil {
-		log.Printf("Error scanning sql response: %v", err)
-		return nil
+	err := row.Scan(&user.Id, &user.Username, &user.Password)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	return &user, nil
+
+}
+
+// Authenticate returns the user when password matches the stored hash, and
+// ErrInvalidCredentials for an unknown user or a wrong password alike.
+// Hashes made with outdated parameters, and legacy plaintext passwords,
+// are replaced with a fresh hash on successful login.
+func (h *UserRepository) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	user, err := h.GetUserByUsername(ctx, username)
+	if errors.Is(err, ErrUserNotFound) {
+		// Spend the time of a real check so the response does not reveal
+		// whether the username exists.
+		h.hasher.Verify(h.hasher.DummyHash(), password)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ok, needsRehash := h.hasher.Verify(user.Password, password)
+	if !ok {
+		return nil, ErrInvalidCredentials
 	}
 
-	if user.Id == 0 {
-		log.Printf("Error returning user by username")
-		return nil
+	if needsRehash {
+		h.rehash(ctx, user, password)
 	}
 
-	return &user
+	return user, nil
+}
+
+// rehash replaces the stored hash of user. It is best effort: a failure is
+// logged and the login goes on with the old hash.
+func (h *UserRepository) rehash(ctx context.Context, user *models.User, password string) {
+	log := requestlog.Logger(ctx, h.log).With(zap.Int64("user_id", user.Id))
+
+	passwordHash, err := h.hasher.Hash(password)
+	if err != nil {
+		log.Error("Error rehashing password", zap.Error(err))
+		return
+	}
+
+	query := `UPDATE users SET password=$1 WHERE id=$2 AND password=$3;`
+
+	if _, err := h.db.ExecContext(ctx, query, passwordHash, user.Id, user.Password); err != nil {
+		log.Error("Error updating password hash", zap.Error(err))
+		return
+	}
 
+	user.Password = passwordHash
 }
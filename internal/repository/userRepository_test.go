@@ -2,19 +2,39 @@ package repository
 
 import (
 	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/pkg/hasher"
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// hashOf matches a bcrypt hash of the given password.
+type hashOf string
+
+func (p hashOf) Match(v driver.Value) bool {
+	hash, ok := v.(string)
+	return ok && bcrypt.CompareHashAndPassword([]byte(hash), []byte(p)) == nil
+}
+
+func testHasher() *hasher.Hasher {
+	return hasher.NewHasher(bcrypt.MinCost)
+}
+
 func TestUserRepository_NewUser(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 
-	repo := NewUserRepository(db)
+	repo := NewUserRepository(db, testHasher(), zap.NewNop())
 
 	tests := []struct {
 		name        string
@@ -23,6 +43,7 @@ func TestUserRepository_NewUser(t *testing.T) {
 		mock        func()
 		expected    *models.NewUserResponse
 		expectError bool
+		expectedErr error
 	}{
 		{
 			name:     "successful user creation",
@@ -32,7 +53,7 @@ func TestUserRepository_NewUser(t *testing.T) {
 				rows := sqlmock.NewRows([]string{"id", "username"}).
 					AddRow(1, "testuser")
 				mock.ExpectQuery(`INSERT INTO users \(username,password\) VALUES \(\$1,\$2\) RETURNING id,username`).
-					WithArgs("testuser", "testpass").
+					WithArgs("testuser", hashOf("testpass")).
 					WillReturnRows(rows)
 			},
 			expected: &models.NewUserResponse{
@@ -47,12 +68,25 @@ func TestUserRepository_NewUser(t *testing.T) {
 			password: "testpass",
 			mock: func() {
 				mock.ExpectQuery(`INSERT INTO users \(username,password\) VALUES \(\$1,\$2\) RETURNING id,username`).
-					WithArgs("testuser", "testpass").
+					WithArgs("testuser", hashOf("testpass")).
 					WillReturnError(errors.New("database error"))
 			},
 			expected:    nil,
 			expectError: true,
 		},
+		{
+			name:     "username taken",
+			username: "testuser",
+			password: "testpass",
+			mock: func() {
+				mock.ExpectQuery(`INSERT INTO users \(username,password\) VALUES \(\$1,\$2\) RETURNING id,username`).
+					WithArgs("testuser", hashOf("testpass")).
+					WillReturnError(&pq.Error{Code: "23505"})
+			},
+			expected:    nil,
+			expectError: true,
+			expectedErr: ErrUsernameTaken,
+		},
 		{
 			name:     "scan error - missing columns",
 			username: "testuser",
@@ -60,7 +94,7 @@ func TestUserRepository_NewUser(t *testing.T) {
 			mock: func() {
 				rows := sqlmock.NewRows([]string{"id"}).AddRow(1) // missing username
 				mock.ExpectQuery(`INSERT INTO users \(username,password\) VALUES \(\$1,\$2\) RETURNING id,username`).
-					WithArgs("testuser", "testpass").
+					WithArgs("testuser", hashOf("testpass")).
 					WillReturnRows(rows)
 			},
 			expected:    nil,
@@ -71,11 +105,16 @@ func TestUserRepository_NewUser(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mock()
-			result := repo.NewUser(tt.username, tt.password)
+			result, err := repo.NewUser(context.Background(), tt.username, tt.password)
 
 			if tt.expectError {
+				assert.Error(t, err)
+				if tt.expectedErr != nil {
+					assert.ErrorIs(t, err, tt.expectedErr)
+				}
 				assert.Nil(t, result)
 			} else {
+				assert.NoError(t, err)
 				assert.Equal(t, tt.expected, result)
 			}
 
@@ -88,12 +127,11 @@ func TestUserRepository_GetUserByUsername(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 
-	repo := NewUserRepository(db)
+	repo := NewUserRepository(db, testHasher(), zap.NewNop())
 
 	tests := []struct {
 		name        string
 		username    string
-		password    string
 		mock        func()
 		expected    *models.User
 		expectError bool
@@ -101,28 +139,26 @@ func TestUserRepository_GetUserByUsername(t *testing.T) {
 		{
 			name:     "successful get user",
 			username: "testuser",
-			password: "testpass",
 			mock: func() {
 				rows := sqlmock.NewRows([]string{"id", "username", "password"}).
-					AddRow(1, "testuser", "testpass")
-				mock.ExpectQuery(`SELECT \* FROM users WHERE username=\$1 AND password=\$2`).
-					WithArgs("testuser", "testpass").
+					AddRow(1, "testuser", "hash")
+				mock.ExpectQuery(`SELECT id, username, password FROM users WHERE username=\$1`).
+					WithArgs("testuser").
 					WillReturnRows(rows)
 			},
 			expected: &models.User{
 				Id:       1,
 				Username: "testuser",
-				Password: "testpass",
+				Password: "hash",
 			},
 			expectError: false,
 		},
 		{
 			name:     "user not found",
 			username: "testuser",
-			password: "testpass",
 			mock: func() {
-				mock.ExpectQuery(`SELECT \* FROM users WHERE username=\$1 AND password=\$2`).
-					WithArgs("testuser", "testpass").
+				mock.ExpectQuery(`SELECT id, username, password FROM users WHERE username=\$1`).
+					WithArgs("testuser").
 					WillReturnError(sql.ErrNoRows)
 			},
 			expected:    nil,
@@ -131,10 +167,9 @@ func TestUserRepository_GetUserByUsername(t *testing.T) {
 		{
 			name:     "database error",
 			username: "testuser",
-			password: "testpass",
 			mock: func() {
-				mock.ExpectQuery(`SELECT \* FROM users WHERE username=\$1 AND password=\$2`).
-					WithArgs("testuser", "testpass").
+				mock.ExpectQuery(`SELECT id, username, password FROM users WHERE username=\$1`).
+					WithArgs("testuser").
 					WillReturnError(errors.New("database error"))
 			},
 			expected:    nil,
@@ -143,12 +178,11 @@ func TestUserRepository_GetUserByUsername(t *testing.T) {
 		{
 			name:     "scan error - missing columns",
 			username: "testuser",
-			password: "testpass",
 			mock: func() {
 				rows := sqlmock.NewRows([]string{"id", "username"}). // missing password
 											AddRow(1, "testuser")
-				mock.ExpectQuery(`SELECT \* FROM users WHERE username=\$1 AND password=\$2`).
-					WithArgs("testuser", "testpass").
+				mock.ExpectQuery(`SELECT id, username, password FROM users WHERE username=\$1`).
+					WithArgs("testuser").
 					WillReturnRows(rows)
 			},
 			expected:    nil,
@@ -159,11 +193,13 @@ func TestUserRepository_GetUserByUsername(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mock()
-			result := repo.GetUserByUsername(tt.username, tt.password)
+			result, err := repo.GetUserByUsername(context.Background(), tt.username)
 
 			if tt.expectError {
+				assert.Error(t, err)
 				assert.Nil(t, result)
 			} else {
+				assert.NoError(t, err)
 				assert.Equal(t, tt.expected, result)
 			}
 
@@ -171,3 +207,129 @@ func TestUserRepository_GetUserByUsername(t *testing.T) {
 		})
 	}
 }
+
+func TestUserRepository_Authenticate(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	repo := NewUserRepository(db, testHasher(), zap.NewNop())
+
+	currentHash, err := testHasher().Hash("testpass")
+	require.NoError(t, err)
+	outdatedHash, err := hasher.NewHasher(bcrypt.MinCost + 1).Hash("testpass")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		password string
+		mock     func()
+		expected bool
+	}{
+		{
+			name:     "valid password",
+			password: "testpass",
+			mock: func() {
+				mock.ExpectQuery(`SELECT id, username, password FROM users WHERE username=\$1`).
+					WithArgs("testuser").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).
+						AddRow(1, "testuser", currentHash))
+			},
+			expected: true,
+		},
+		{
+			name:     "wrong password",
+			password: "wrong",
+			mock: func() {
+				mock.ExpectQuery(`SELECT id, username, password FROM users WHERE username=\$1`).
+					WithArgs("testuser").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).
+						AddRow(1, "testuser", currentHash))
+			},
+			expected: false,
+		},
+		{
+			name:     "outdated cost is rehashed",
+			password: "testpass",
+			mock: func() {
+				mock.ExpectQuery(`SELECT id, username, password FROM users WHERE username=\$1`).
+					WithArgs("testuser").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).
+						AddRow(1, "testuser", outdatedHash))
+				mock.ExpectExec(`UPDATE users SET password=\$1 WHERE id=\$2 AND password=\$3`).
+					WithArgs(hashOf("testpass"), int64(1), outdatedHash).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expected: true,
+		},
+		{
+			name:     "legacy plaintext password is rehashed",
+			password: "testpass",
+			mock: func() {
+				mock.ExpectQuery(`SELECT id, username, password FROM users WHERE username=\$1`).
+					WithArgs("testuser").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).
+						AddRow(1, "testuser", "testpass"))
+				mock.ExpectExec(`UPDATE users SET password=\$1 WHERE id=\$2 AND password=\$3`).
+					WithArgs(hashOf("testpass"), int64(1), "testpass").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expected: true,
+		},
+		{
+			name:     "user not found",
+			password: "testpass",
+			mock: func() {
+				mock.ExpectQuery(`SELECT id, username, password FROM users WHERE username=\$1`).
+					WithArgs("testuser").
+					WillReturnError(sql.ErrNoRows)
+			},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+			result, err := repo.Authenticate(context.Background(), "testuser", tt.password)
+
+			if tt.expected {
+				require.NoError(t, err)
+				assert.Equal(t, int64(1), result.Id)
+				assert.NotEqual(t, tt.password, result.Password)
+			} else {
+				// Неизвестный пользователь и неверный пароль неразличимы
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				assert.Nil(t, result)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUserRepository_Authenticate_UnknownUserRunsHasher(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	// Стоимость, при которой сравнение bcrypt заметно по времени
+	passwordHasher := hasher.NewHasher(bcrypt.MinCost + 6)
+	repo := NewUserRepository(db, passwordHasher, zap.NewNop())
+
+	dummy := passwordHasher.DummyHash()
+	start := time.Now()
+	passwordHasher.Verify(dummy, "testpass")
+	verifyTime := time.Since(start)
+
+	mock.ExpectQuery(`SELECT id, username, password FROM users WHERE username=\$1`).
+		WithArgs("nobody").
+		WillReturnError(sql.ErrNoRows)
+
+	start = time.Now()
+	_, err := repo.Authenticate(context.Background(), "nobody", "testpass")
+	elapsed := time.Since(start)
+
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	// Неизвестный пользователь проверяется так же долго, как настоящий пароль
+	assert.GreaterOrEqual(t, elapsed, verifyTime/2)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
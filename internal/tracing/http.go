@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// Handler starts a server span for every request handled by h, continuing
+// the trace of an incoming traceparent header.
+func Handler(h http.Handler) http.Handler {
+	return otelhttp.NewHandler(h, "http.server")
+}
+
+// Route names the request span after the chi route pattern, e.g.
+// "GET /api/deals/{id}", once the request has been routed. It must be used
+// on the root router inside Handler.
+func Route(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		rctx := chi.RouteContext(r.Context())
+		if rctx == nil || rctx.RoutePattern() == "" {
+			return
+		}
+
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + rctx.RoutePattern())
+		span.SetAttributes(attribute.String("http.route", rctx.RoutePattern()))
+	})
+}
@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"Brocker-pet-project/internal/config"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap/zapcore"
+)
+
+// useRecorder installs a tracer provider recording spans in memory for the
+// duration of the test.
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+func TestInit(t *testing.T) {
+	shutdown, err := Init(context.Background(), config.Tracing{})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = Init(context.Background(), config.Tracing{Exporter: "jaeger"})
+	assert.ErrorContains(t, err, `unknown tracing exporter "jaeger"`)
+}
+
+func TestHandler_Route(t *testing.T) {
+	recorder := useRecorder(t)
+	_, err := Init(context.Background(), config.Tracing{})
+	require.NoError(t, err)
+
+	var logFields []zapcore.Field
+	r := chi.NewRouter()
+	r.Use(Route)
+	r.Get("/api/deals/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logFields = LogFields(r.Context())
+	})
+
+	// Трассировка продолжается из заголовка traceparent
+	req := httptest.NewRequest(http.MethodGet, "/api/deals/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	Handler(r).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /api/deals/{id}", spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+
+	require.Len(t, logFields, 2)
+	assert.Equal(t, "trace_id", logFields[0].Key)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", logFields[0].String)
+}
+
+func TestLogFields_NoSpan(t *testing.T) {
+	assert.Empty(t, LogFields(context.Background()))
+}
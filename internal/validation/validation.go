@@ -0,0 +1,224 @@
+// Package validation checks request payloads before they reach a
+// repository. Every check reports all the fields it rejects at once.
+package validation
+
+import (
+	"Brocker-pet-project/internal/fx"
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/pkg/apierror"
+	"Brocker-pet-project/pkg/money"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	MaxTitleLength = 255
+
+	MinUsernameLength = 3
+	MaxUsernameLength = 64
+	MinPasswordLength = 8
+	// MaxPasswordLength is the most bytes bcrypt takes into account.
+	MaxPasswordLength = 72
+)
+
+// Errors lists the rejected fields of a payload.
+type Errors []apierror.FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, field := range e {
+		parts[i] = field.Field + ": " + field.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (e *Errors) add(field, format string, args ...any) {
+	*e = append(*e, apierror.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Fields returns the field errors carried by err, if it is a validation error.
+func Fields(err error) ([]apierror.FieldError, bool) {
+	var errs Errors
+	if errors.As(err, &errs) {
+		return errs, true
+	}
+	return nil, false
+}
+
+// NewDeal checks a deal about to be created and fills in the default
+// currency and status.
+func NewDeal(deal *models.Deal) error {
+	var errs Errors
+
+	deal.Title = strings.TrimSpace(deal.Title)
+	title(&errs, deal.Title)
+
+	if deal.Currency == "" {
+		deal.Currency = money.DefaultCurrency
+	}
+	amounts(&errs, &deal.Expenses, &deal.Profit, &deal.Currency)
+
+	if deal.Status == "" {
+		deal.Status = models.StatusPending
+	}
+	if deal.Status != models.StatusDraft && deal.Status != models.StatusPending {
+		errs.add("status", "must be draft or pending, got %q", deal.Status)
+	}
+
+	return errs.err()
+}
+
+// DealPatch checks the fields a patch sets; nil fields are skipped.
+func DealPatch(patch *models.DealPatch) error {
+	var errs Errors
+
+	if patch.Title != nil {
+		*patch.Title = strings.TrimSpace(*patch.Title)
+		title(&errs, *patch.Title)
+	}
+	amounts(&errs, patch.Expenses, patch.Profit, patch.Currency)
+
+	return errs.err()
+}
+
+// Registration checks the credentials of a new user.
+func Registration(user *models.User) error {
+	var errs Errors
+
+	user.Username = normalizeUsername(user.Username)
+	switch n := utf8.RuneCountInString(user.Username); {
+	case n == 0:
+		errs.add("username", "must not be empty")
+	case n < MinUsernameLength || n > MaxUsernameLength:
+		errs.add("username", "must be %d to %d characters long", MinUsernameLength, MaxUsernameLength)
+	case strings.ContainsFunc(user.Username, isSpaceOrControl):
+		errs.add("username", "must not contain spaces or control characters")
+	}
+
+	switch n := len(user.Password); {
+	case n == 0:
+		errs.add("password", "must not be empty")
+	case n < MinPasswordLength:
+		errs.add("password", "must be at least %d characters long", MinPasswordLength)
+	case n > MaxPasswordLength:
+		errs.add("password", "must be at most %d bytes long", MaxPasswordLength)
+	}
+
+	return errs.err()
+}
+
+// Credentials checks that a login request names a user and a password, and
+// normalises the username as Registration does. Password rules are not
+// applied, so users created before they existed can still log in.
+func Credentials(user *models.User) error {
+	var errs Errors
+
+	user.Username = normalizeUsername(user.Username)
+	if user.Username == "" {
+		errs.add("username", "must not be empty")
+	}
+	if user.Password == "" {
+		errs.add("password", "must not be empty")
+	}
+
+	return errs.err()
+}
+
+// FxRates checks the rates of an admin upload and normalises their
+// currency codes and scale. Fields are named after the position of the
+// rate, such as rates[0].rate.
+func FxRates(rates []models.FxRate) error {
+	var errs Errors
+
+	if len(rates) == 0 {
+		errs.add("rates", "must not be empty")
+	}
+
+	for i := range rates {
+		rate := &rates[i]
+		field := fmt.Sprintf("rates[%d].", i)
+
+		base, baseErr := money.ParseCurrency(rate.Base)
+		if baseErr != nil {
+			errs.add(field+"base", "%v", baseErr)
+		}
+		quote, quoteErr := money.ParseCurrency(rate.Quote)
+		if quoteErr != nil {
+			errs.add(field+"quote", "%v", quoteErr)
+		}
+		if baseErr == nil && quoteErr == nil {
+			if base == quote {
+				errs.add(field+"quote", "must differ from base")
+			}
+			rate.Base, rate.Quote = base, quote
+		}
+
+		if value, err := fx.NormalizeRate(rate.Rate); err != nil {
+			errs.add(field+"rate", "%v", err)
+		} else {
+			rate.Rate = value
+		}
+
+		if rate.EffectiveAt.IsZero() {
+			errs.add(field+"effective_at", "must not be empty")
+		}
+	}
+
+	return errs.err()
+}
+
+// normalizeUsername returns username as it is stored, so the name typed at
+// login matches the one typed at registration.
+func normalizeUsername(username string) string {
+	return strings.TrimSpace(username)
+}
+
+func title(errs *Errors, title string) {
+	if title == "" {
+		errs.add("title", "must not be empty")
+	} else if utf8.RuneCountInString(title) > MaxTitleLength {
+		errs.add("title", "must be at most %d characters long", MaxTitleLength)
+	}
+}
+
+// amounts checks that deal amounts fit the money columns without rounding
+// and that expenses are not negative, and normalises the currency code. Nil
+// fields are skipped.
+func amounts(errs *Errors, expenses, profit *decimal.Decimal, currency *string) {
+	if expenses != nil {
+		if expenses.IsNegative() {
+			errs.add("expenses", "must not be negative")
+		} else if err := money.Validate(*expenses); err != nil {
+			errs.add("expenses", "%v", err)
+		}
+	}
+	if profit != nil {
+		if err := money.Validate(*profit); err != nil {
+			errs.add("profit", "%v", err)
+		}
+	}
+	if currency != nil {
+		code, err := money.ParseCurrency(*currency)
+		if err != nil {
+			errs.add("currency", "%v", err)
+		} else {
+			*currency = code
+		}
+	}
+}
+
+func isSpaceOrControl(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsControl(r)
+}
@@ -0,0 +1,140 @@
+package validation
+
+import (
+	"Brocker-pet-project/internal/models"
+	"Brocker-pet-project/pkg/apierror"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDeal(t *testing.T) {
+	deal := models.Deal{Title: "  Deal  ", Expenses: decimal.NewFromInt(10), Profit: decimal.NewFromInt(-5), Currency: "eur"}
+
+	require.NoError(t, NewDeal(&deal))
+	assert.Equal(t, "Deal", deal.Title)
+	assert.Equal(t, "EUR", deal.Currency)
+	assert.Equal(t, models.StatusPending, deal.Status)
+
+	deal = models.Deal{Title: "Deal"}
+	require.NoError(t, NewDeal(&deal))
+	assert.Equal(t, "USD", deal.Currency)
+}
+
+func TestNewDeal_Invalid(t *testing.T) {
+	// Все ошибки сообщаются сразу, а не только первая
+	deal := models.Deal{
+		Title:    " ",
+		Expenses: decimal.NewFromInt(-1),
+		Profit:   decimal.RequireFromString("0.00001"),
+		Currency: "ABC",
+		Status:   models.StatusProcessed,
+	}
+
+	err := NewDeal(&deal)
+	require.Error(t, err)
+
+	fields, ok := Fields(fmt.Errorf("wrapped: %w", err))
+	require.True(t, ok)
+
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.Field
+	}
+	assert.Equal(t, []string{"title", "expenses", "profit", "currency", "status"}, names)
+	assert.Equal(t, apierror.FieldError{Field: "expenses", Message: "must not be negative"}, fields[1])
+	assert.True(t, strings.HasPrefix(err.Error(), "title: must not be empty; expenses: must not be negative"))
+
+	deal = models.Deal{Title: strings.Repeat("я", MaxTitleLength+1)}
+	assert.EqualError(t, NewDeal(&deal), "title: must be at most 255 characters long")
+}
+
+func TestDealPatch(t *testing.T) {
+	title, currency := " New title ", "gbp"
+
+	patch := models.DealPatch{Title: &title, Currency: &currency}
+	require.NoError(t, DealPatch(&patch))
+	assert.Equal(t, "New title", *patch.Title)
+	assert.Equal(t, "GBP", *patch.Currency)
+
+	empty, negative := "", decimal.NewFromInt(-1)
+
+	err := DealPatch(&models.DealPatch{Title: &empty, Expenses: &negative})
+	assert.EqualError(t, err, "title: must not be empty; expenses: must not be negative")
+
+	_, ok := Fields(assert.AnError)
+	assert.False(t, ok)
+}
+
+func TestRegistration(t *testing.T) {
+	tests := []struct {
+		name string
+		user models.User
+		err  string
+	}{
+		{"valid", models.User{Username: " alice ", Password: "password"}, ""},
+		{"empty", models.User{}, "username: must not be empty; password: must not be empty"},
+		{"short", models.User{Username: "al", Password: "pass"},
+			"username: must be 3 to 64 characters long; password: must be at least 8 characters long"},
+		{"space in username", models.User{Username: "al ice", Password: "password"},
+			"username: must not contain spaces or control characters"},
+		{"long password", models.User{Username: "alice", Password: strings.Repeat("p", MaxPasswordLength+1)},
+			"password: must be at most 72 bytes long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Registration(&tt.user)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	// Старые короткие пароли не блокируют вход
+	assert.NoError(t, Credentials(&models.User{Username: "bob", Password: "123"}))
+	assert.EqualError(t, Credentials(&models.User{Username: "bob"}), "password: must not be empty")
+
+	// Имя нормализуется так же, как при регистрации
+	registered := models.User{Username: " bob ", Password: "password"}
+	require.NoError(t, Registration(&registered))
+	login := models.User{Username: " bob ", Password: "password"}
+	require.NoError(t, Credentials(&login))
+	assert.Equal(t, registered.Username, login.Username)
+}
+
+func TestFxRates(t *testing.T) {
+	effectiveAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rates := []models.FxRate{{Base: "eur", Quote: "usd", Rate: decimal.RequireFromString("1.08500000004"), EffectiveAt: effectiveAt}}
+	require.NoError(t, FxRates(rates))
+	assert.Equal(t, "EUR", rates[0].Base)
+	assert.Equal(t, "USD", rates[0].Quote)
+	assert.Equal(t, "1.085", rates[0].Rate.String())
+
+	// Ошибки каждой ставки названы по её позиции
+	err := FxRates([]models.FxRate{
+		{Base: "EUR", Quote: "USD", Rate: decimal.NewFromInt(1), EffectiveAt: effectiveAt},
+		{Base: "EUR", Quote: "eur", Rate: decimal.RequireFromString("0.00000000001")},
+		{Base: "ABC", Quote: "USD", Rate: decimal.NewFromInt(1), EffectiveAt: effectiveAt},
+	})
+	fields, ok := Fields(err)
+	require.True(t, ok)
+
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.Field
+	}
+	assert.Equal(t, []string{"rates[1].quote", "rates[1].rate", "rates[1].effective_at", "rates[2].base"}, names)
+
+	assert.EqualError(t, FxRates(nil), "rates: must not be empty")
+}
@@ -1,45 +1,251 @@
 package worker
 
 import (
+	"Brocker-pet-project/internal/config"
+	"Brocker-pet-project/internal/metrics"
+	"Brocker-pet-project/internal/models"
 	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/internal/tracing"
+	"Brocker-pet-project/pkg/money"
 	"context"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultInterval    = 3 * time.Second
+	DefaultBatchSize   = 100
+	DefaultConcurrency = 1
+	DefaultMaxBackoff  = time.Minute
+	DefaultTickTimeout = 30 * time.Second
 )
 
 type DealWorker struct {
-	log              *zap.Logger
-	dealRepository   *repository.DealRepository
-	profitRepository *repository.ProfitRepository
+	log               *zap.Logger
+	dealRepository    repository.DealStore
+	cfg               config.Worker
+	reportingCurrency string
+	heartbeat         atomic.Int64 // unix nanoseconds of the last tick, 0 before Run
 }
 
-func NewDealWorker(log *zap.Logger, dealRepository *repository.DealRepository, profitRepository *repository.ProfitRepository) *DealWorker {
-	return &DealWorker{log: log, dealRepository: dealRepository, profitRepository: profitRepository}
+// NewDealWorker creates a worker that books clear profit in the deal
+// currency and in reportingCurrency.
+func NewDealWorker(log *zap.Logger, dealRepository repository.DealStore, cfg config.Worker, reportingCurrency string) *DealWorker {
+	if cfg.ProcessedTimeOut <= 0 {
+		cfg.ProcessedTimeOut = DefaultInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConcurrency
+	}
+	if cfg.Jitter < 0 {
+		cfg.Jitter = 0
+	}
+	if cfg.TickTimeout <= 0 {
+		cfg.TickTimeout = DefaultTickTimeout
+	}
+	if cfg.MaxBackoff < cfg.ProcessedTimeOut {
+		cfg.MaxBackoff = max(DefaultMaxBackoff, cfg.ProcessedTimeOut)
+	}
+
+	if reportingCurrency == "" {
+		reportingCurrency = money.DefaultCurrency
+	}
+
+	return &DealWorker{log: log, dealRepository: dealRepository, cfg: cfg, reportingCurrency: reportingCurrency}
 }
 
-func (h *DealWorker) MarkAsProcessed() {
-	ctx := context.Background()
+// Run calls MarkAsProcessed every poll interval until ctx is cancelled. A
+// batch that is running when ctx is cancelled is allowed to finish.
+func (h *DealWorker) Run(ctx context.Context) {
+	h.log.Info("Deal worker started",
+		zap.Duration("interval", h.cfg.ProcessedTimeOut),
+		zap.Int("batch_size", h.cfg.BatchSize),
+		zap.Int("concurrency", h.cfg.Concurrency),
+		zap.Duration("jitter", h.cfg.Jitter),
+		zap.Duration("max_backoff", h.cfg.MaxBackoff),
+		zap.Duration("tick_timeout", h.cfg.TickTimeout),
+		zap.String("reporting_currency", h.reportingCurrency))
 
-	deals := h.dealRepository.GetAllNotProcessedDeals(ctx)
-	if deals == nil {
-		h.log.Error("Failed to get not processed deals")
-		return
-	}
+	h.beat()
 
-	for _, deal := range *deals {
-		profit := h.profitRepository.AddProfitById(deal.Id, deal.Profit-deal.Expenses)
-		if profit == nil {
-			h.log.Error("Error while adding profit for deal", zap.Int64("deal id", deal.Id))
-			continue // Продолжаем обработку других сделок, а не прерываем полностью
+	failures := 0
+
+	timer := time.NewTimer(h.nextDelay(failures))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.log.Info("Deal worker stopped")
+			return
+		case <-timer.C:
 		}
 
-		processedDeal := h.dealRepository.MarkTransactionAsProcessed(deal.Id)
-		if processedDeal == nil {
-			h.log.Error("Error while marking deal as processed", zap.Int64("deal id", deal.Id))
-			continue
+		if err := h.tick(ctx); err != nil {
+			failures++
+		} else {
+			failures = 0
 		}
+		h.beat()
+
+		timer.Reset(h.nextDelay(failures))
+	}
+}
+
+func (h *DealWorker) beat() {
+	h.heartbeat.Store(time.Now().UnixNano())
+}
 
-		h.log.Debug("Successfully processed deal", zap.Int64("deal id", deal.Id))
+// CheckHeartbeat fails when Run has not started, or has not finished a
+// tick for longer than the longest poll interval plus TickTimeout, which
+// means the loop is stuck.
+func (h *DealWorker) CheckHeartbeat(ctx context.Context) error {
+	last := h.heartbeat.Load()
+	if last == 0 {
+		return errors.New("worker not started")
 	}
 
-	h.log.Info("Finished processing deals batch")
+	age := time.Since(time.Unix(0, last))
+	if limit := h.cfg.MaxBackoff + h.cfg.Jitter + h.cfg.TickTimeout; age > limit {
+		return fmt.Errorf("no tick for %s", age.Round(time.Second))
+	}
+
+	return nil
+}
+
+// tick runs one batch with its own deadline in a new trace, then records
+// the backlog left. The batch is not cancelled with ctx, so a shutdown lets
+// it finish, but it cannot outlive TickTimeout.
+func (h *DealWorker) tick(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.cfg.TickTimeout)
+	defer cancel()
+
+	ctx, span := tracing.Tracer().Start(ctx, "worker.tick", trace.WithNewRoot())
+	defer span.End()
+
+	err := h.MarkAsProcessed(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "batch failed")
+	}
+
+	backlog, countErr := h.dealRepository.CountPendingDeals(ctx)
+	if countErr != nil {
+		tracing.Logger(ctx, h.log).Error("Error counting pending deals", zap.Error(countErr))
+	} else {
+		metrics.WorkerBacklog.Set(float64(backlog))
+	}
+
+	return err
+}
+
+// nextDelay returns the poll interval doubled for every consecutive failed
+// batch, capped at MaxBackoff, plus a random jitter so replicas do not poll
+// in lockstep.
+func (h *DealWorker) nextDelay(failures int) time.Duration {
+	delay := h.cfg.ProcessedTimeOut
+	for i := 0; i < failures && delay < h.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, h.cfg.MaxBackoff)
+
+	if h.cfg.Jitter > 0 {
+		delay += rand.N(h.cfg.Jitter)
+	}
+
+	return delay
+}
+
+// MarkAsProcessed processes up to BatchSize pending deals with Concurrency
+// goroutines, each deal in its own transaction, until ctx is done. It
+// returns the first database error, which makes Run back off.
+func (h *DealWorker) MarkAsProcessed(ctx context.Context) error {
+	var (
+		wg        sync.WaitGroup
+		remaining atomic.Int64
+		processed atomic.Int64
+		errOnce   sync.Once
+		batchErr  error
+	)
+
+	start := time.Now()
+	remaining.Store(int64(h.cfg.BatchSize))
+
+	for range h.cfg.Concurrency {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for remaining.Add(-1) >= 0 {
+				if !h.processNextDeal(ctx, &processed, func(err error) {
+					errOnce.Do(func() { batchErr = err })
+				}) {
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	h.log.Info("Finished processing deals batch", zap.Int64("deals", processed.Load()))
+
+	metrics.WorkerBatchDeals.Observe(float64(processed.Load()))
+	metrics.WorkerBatchDuration.Observe(time.Since(start).Seconds())
+	if batchErr != nil {
+		metrics.WorkerBatchFailures.Inc()
+	}
+
+	return batchErr
+}
+
+// processNextDeal processes one deal in its own span. It returns false when
+// the batch should stop: nothing is pending or the database failed, in
+// which case the error is passed to fail.
+func (h *DealWorker) processNextDeal(ctx context.Context, processed *atomic.Int64, fail func(error)) bool {
+	ctx, span := tracing.Tracer().Start(ctx, "worker.process_deal")
+	defer span.End()
+
+	log := tracing.Logger(ctx, h.log)
+
+	deal, err := h.dealRepository.ProcessNextDeal(ctx, h.reportingCurrency, clearProfit)
+	if errors.Is(err, repository.ErrNoDealsToProcess) {
+		return false
+	}
+	if err != nil {
+		log.Error("Error while processing deal", zap.Error(err))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "processing failed")
+		fail(err)
+		return false
+	}
+
+	processed.Add(1)
+	span.SetAttributes(attribute.Int64("deal.id", deal.Id), attribute.String("deal.status", deal.Status))
+
+	if deal.Status == models.StatusFailed {
+		log.Error("Failed to book profit for deal", zap.Int64("deal_id", deal.Id))
+		span.SetStatus(codes.Error, "profit not booked")
+		return true // Продолжаем обработку других сделок, а не прерываем полностью
+	}
+
+	log.Debug("Successfully processed deal", zap.Int64("deal_id", deal.Id))
+	return true
+}
+
+func clearProfit(deal models.Deal) decimal.Decimal {
+	return deal.Profit.Sub(deal.Expenses)
 }
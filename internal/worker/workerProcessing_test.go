@@ -1,16 +1,28 @@
 package worker
 
 import (
+	"Brocker-pet-project/internal/config"
+	"Brocker-pet-project/internal/metrics"
 	"Brocker-pet-project/internal/models"
 	"Brocker-pet-project/internal/repository"
+	"Brocker-pet-project/internal/repository/memory"
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"github.com/go-redis/redismock/v9"
 	"github.com/redis/go-redis/v9"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/zap"
 )
 
@@ -27,6 +39,48 @@ func setupMockRedis() (*redis.Client, redismock.ClientMock) {
 	return client, mock
 }
 
+// expectClaim sets up ProcessNextDeal claiming a pending deal and moving it
+// to processing.
+func expectClaim(dbMock sqlmock.Sqlmock, deal models.Deal) {
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery(`SELECT (.+) FROM transactions WHERE status=\$1 ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED`).
+		WithArgs("pending").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}).
+			AddRow(deal.Id, deal.Title, deal.Expenses.String(), deal.Profit.String(), deal.Currency, deal.Status, deal.UserId))
+	expectTransition(dbMock, deal.Id, "pending", "processing", "")
+	dbMock.ExpectExec(`SAVEPOINT book_profit`).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectTransition(dbMock sqlmock.Sqlmock, dealId int64, from, to, reason string) {
+	dbMock.ExpectExec(`UPDATE transactions SET status=\$1, status_changed_at=now\(\) WHERE id=\$2`).
+		WithArgs(to, dealId).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec(`INSERT INTO deal_status_history`).
+		WithArgs(dealId, from, to, "worker", reason).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+// profitArgs are the clear_profit insert arguments for a deal booked in its
+// own currency, which is also the reporting currency.
+func profitArgs(deal models.Deal) []driver.Value {
+	profit := deal.Profit.Sub(deal.Expenses).String()
+	return []driver.Value{deal.Id, deal.UserId, profit, deal.Currency, profit, deal.Currency, "1"}
+}
+
+func profitRows(id int64, deal models.Deal) *sqlmock.Rows {
+	profit := deal.Profit.Sub(deal.Expenses).String()
+	return sqlmock.NewRows([]string{"id", "deals_id", "user_id", "all_profit", "currency", "reporting_profit", "reporting_currency", "fx_rate"}).
+		AddRow(id, deal.Id, deal.UserId, profit, deal.Currency, profit, deal.Currency, "1")
+}
+
+func expectNoPendingDeals(dbMock sqlmock.Sqlmock) {
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery(`SELECT (.+) FROM transactions WHERE status=\$1`).
+		WithArgs("pending").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "currency", "status", "user_id"}))
+	dbMock.ExpectRollback()
+}
+
 func TestDealWorker_MarkAsProcessed_Success(t *testing.T) {
 	// Настройка моков
 	db, dbMock := setupMockDB(t)
@@ -39,52 +93,36 @@ func TestDealWorker_MarkAsProcessed_Success(t *testing.T) {
 
 	// Тестовые данные
 	testDeals := []models.Deal{
-		{Id: 1, Title: "Deal 1", Expenses: 100, Profit: 200, Status: "not processed"},
-		{Id: 2, Title: "Deal 2", Expenses: 150, Profit: 300, Status: "not processed"},
+		{Id: 1, Title: "Deal 1", Expenses: decimal.NewFromInt(100), Profit: decimal.NewFromInt(200), Currency: "USD", Status: "pending", UserId: 7},
+		{Id: 2, Title: "Deal 2", Expenses: decimal.NewFromInt(150), Profit: decimal.NewFromInt(300), Currency: "USD", Status: "pending", UserId: 8},
 	}
 
-	// 1. Ожидание для GetAllNotProcessedDeals
-	rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "status"}).
-		AddRow(testDeals[0].Id, testDeals[0].Title, testDeals[0].Expenses, testDeals[0].Profit, testDeals[0].Status).
-		AddRow(testDeals[1].Id, testDeals[1].Title, testDeals[1].Expenses, testDeals[1].Profit, testDeals[1].Status)
-
-	dbMock.ExpectQuery(`SELECT \* FROM transactions WHERE status=\$1`).
-		WithArgs("not processed").
-		WillReturnRows(rows)
-
-	// 2. Для каждой сделки ожидаем:
-	//    - сначала AddProfitById
-	//    - затем MarkTransactionAsProcessed
+	// Каждая сделка обрабатывается в своей транзакции:
+	//    - захват строки и перевод в processing
+	//    - запись прибыли
+	//    - перевод в processed
 	for i, deal := range testDeals {
-		// Ожидание для AddProfitById
-		profitRow := sqlmock.NewRows([]string{"id", "deals_id", "all_profit"}).
-			AddRow(int64(i+1), deal.Id, deal.Profit-deal.Expenses)
-
-		dbMock.ExpectQuery(`INSERT INTO clear_profit \(deals_id,all_profit\) VALUES \(\$1,\$2\) RETURNING id, deals_id,all_profit`).
-			WithArgs(deal.Id, deal.Profit-deal.Expenses).
-			WillReturnRows(profitRow)
+		expectClaim(dbMock, deal)
 
-		// Ожидание для MarkTransactionAsProcessed
-		dealRow := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "status"}).
-			AddRow(deal.Id, deal.Title, deal.Expenses, deal.Profit, "processed")
+		dbMock.ExpectQuery(`INSERT INTO clear_profit \(deals_id,user_id,all_profit,currency,reporting_profit,reporting_currency,fx_rate\) VALUES \(\$1,NULLIF\(\$2,0\),\$3,\$4,\$5,\$6,\$7\) ON CONFLICT \(deals_id\) DO NOTHING`).
+			WithArgs(profitArgs(deal)...).
+			WillReturnRows(profitRows(int64(i+1), deal))
 
-		dbMock.ExpectQuery(`UPDATE transactions SET status=\$1 WHERE id=\$2 RETURNING id, title, expenses, profit, status`).
-			WithArgs("processed", deal.Id).
-			WillReturnRows(dealRow)
+		expectTransition(dbMock, deal.Id, "processing", "processed", "")
+		dbMock.ExpectCommit()
 	}
 
-	// 3. Ожидание для Redis DEL (вызывается после всех обновлений)
-	redisMock.ExpectDel("notProcessedDeals:all", "processedDeals:all", "allDeals:get").SetVal(1)
+	// Больше сделок нет
+	expectNoPendingDeals(dbMock)
 
-	// Создаем репозитории с моками
-	dealRepo := repository.NewDealRepository(db, redisClient)
-	profitRepo := repository.NewProfitRepository(db)
+	redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
+	redisMock.ExpectDel("notProcessedDeals:all:8", "processedDeals:all:8", "allDeals:get:8").SetVal(1)
 
 	// Создаем worker
-	worker := NewDealWorker(logger, dealRepo, profitRepo)
+	worker := NewDealWorker(logger, repository.NewDealRepository(db, redisClient), config.Worker{}, "")
 
 	// Вызываем тестируемый метод
-	worker.MarkAsProcessed()
+	worker.MarkAsProcessed(context.Background())
 
 	// Проверяем, что все ожидания выполнены
 	assert.NoError(t, dbMock.ExpectationsWereMet())
@@ -101,21 +139,14 @@ func TestDealWorker_MarkAsProcessed_NoDeals(t *testing.T) {
 	// Создаем логгер
 	logger := zap.NewNop()
 
-	// Ожидания для GetAllNotProcessedDeals - пустой результат
-	rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "status"})
-	dbMock.ExpectQuery(`SELECT \* FROM transactions WHERE status=\$1`).
-		WithArgs("not processed").
-		WillReturnRows(rows)
-
-	// Создаем репозитории с моками
-	dealRepo := repository.NewDealRepository(db, redisClient)
-	profitRepo := repository.NewProfitRepository(db)
+	// Пустой результат
+	expectNoPendingDeals(dbMock)
 
 	// Создаем worker
-	worker := NewDealWorker(logger, dealRepo, profitRepo)
+	worker := NewDealWorker(logger, repository.NewDealRepository(db, redisClient), config.Worker{}, "")
 
 	// Вызываем тестируемый метод
-	worker.MarkAsProcessed()
+	worker.MarkAsProcessed(context.Background())
 
 	// Проверяем, что все ожидания выполнены
 	assert.NoError(t, dbMock.ExpectationsWereMet())
@@ -132,39 +163,59 @@ func TestDealWorker_MarkAsProcessed_ErrorInProfit(t *testing.T) {
 	logger := zap.NewNop()
 
 	// Тестовые данные
-	testDeal := models.Deal{Id: 1, Title: "Deal 1", Expenses: 100, Profit: 200, Status: "not processed"}
-
-	// Ожидания для GetAllNotProcessedDeals
-	rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "status"}).
-		AddRow(testDeal.Id, testDeal.Title, testDeal.Expenses, testDeal.Profit, testDeal.Status)
+	testDeal := models.Deal{Id: 1, Title: "Deal 1", Expenses: decimal.NewFromInt(100), Profit: decimal.NewFromInt(200), Currency: "USD", Status: "pending", UserId: 7}
 
-	dbMock.ExpectQuery(`SELECT \* FROM transactions WHERE status=\$1`).
-		WithArgs("not processed").
-		WillReturnRows(rows)
+	expectClaim(dbMock, testDeal)
 
-	// Ожидания для AddProfitById - возвращаем ошибку
-	dbMock.ExpectQuery(`INSERT INTO clear_profit \(deals_id,all_profit\) VALUES \(\$1,\$2\) RETURNING id, deals_id,all_profit`).
-		WithArgs(testDeal.Id, testDeal.Profit-testDeal.Expenses).
+	// Запись прибыли падает - сделка переводится в failed в той же транзакции
+	dbMock.ExpectQuery(`INSERT INTO clear_profit`).
+		WithArgs(profitArgs(testDeal)...).
 		WillReturnError(errors.New("database error"))
+	dbMock.ExpectExec(`ROLLBACK TO SAVEPOINT book_profit`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectTransition(dbMock, testDeal.Id, "processing", "failed", "database error")
+	dbMock.ExpectCommit()
 
-	// Не ожидаем вызов Redis DEL, так как при ошибке он не должен вызываться
-	// (убрали ExpectDel полностью)
+	// Обработка продолжается со следующей сделкой
+	expectNoPendingDeals(dbMock)
 
-	// Создаем репозитории с моками
-	dealRepo := repository.NewDealRepository(db, redisClient)
-	profitRepo := repository.NewProfitRepository(db)
+	redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
 
 	// Создаем worker
-	worker := NewDealWorker(logger, dealRepo, profitRepo)
+	worker := NewDealWorker(logger, repository.NewDealRepository(db, redisClient), config.Worker{}, "")
 
 	// Вызываем тестируемый метод
-	worker.MarkAsProcessed()
+	worker.MarkAsProcessed(context.Background())
 
 	// Проверяем, что все ожидания выполнены
 	assert.NoError(t, dbMock.ExpectationsWereMet())
 	assert.NoError(t, redisMock.ExpectationsWereMet())
 }
 
+func TestDealWorker_MarkAsProcessed_DatabaseUnavailable(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, redisMock := setupMockRedis()
+
+	testDeal := models.Deal{Id: 1, Title: "Deal 1", Expenses: decimal.NewFromInt(100), Profit: decimal.NewFromInt(200), Currency: "USD", Status: "pending", UserId: 7}
+
+	expectClaim(dbMock, testDeal)
+
+	// Соединение потеряно - транзакция откатывается, сделка остаётся
+	// в pending, и worker прекращает обработку до следующего тика
+	dbMock.ExpectQuery(`INSERT INTO clear_profit`).
+		WithArgs(profitArgs(testDeal)...).
+		WillReturnError(&pq.Error{Code: "08006", Message: "connection failure"})
+	dbMock.ExpectRollback()
+
+	worker := NewDealWorker(zap.NewNop(), repository.NewDealRepository(db, redisClient), config.Worker{}, "")
+
+	worker.MarkAsProcessed(context.Background())
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
 func TestDealWorker_MarkAsProcessed_ErrorInMarking(t *testing.T) {
 	// Настройка моков
 	db, dbMock := setupMockDB(t)
@@ -176,43 +227,228 @@ func TestDealWorker_MarkAsProcessed_ErrorInMarking(t *testing.T) {
 	logger := zap.NewNop()
 
 	// Тестовые данные
-	testDeal := models.Deal{Id: 1, Title: "Deal 1", Expenses: 100, Profit: 200, Status: "not processed"}
+	testDeal := models.Deal{Id: 1, Title: "Deal 1", Expenses: decimal.NewFromInt(100), Profit: decimal.NewFromInt(200), Currency: "USD", Status: "pending", UserId: 7}
 
-	// Ожидания для GetAllNotProcessedDeals
-	rows := sqlmock.NewRows([]string{"id", "title", "expenses", "profit", "status"}).
-		AddRow(testDeal.Id, testDeal.Title, testDeal.Expenses, testDeal.Profit, testDeal.Status)
+	expectClaim(dbMock, testDeal)
 
-	dbMock.ExpectQuery(`SELECT \* FROM transactions WHERE status=\$1`).
-		WithArgs("not processed").
-		WillReturnRows(rows)
+	dbMock.ExpectQuery(`INSERT INTO clear_profit`).
+		WithArgs(profitArgs(testDeal)...).
+		WillReturnRows(profitRows(1, testDeal))
 
-	// Ожидания для AddProfitById - успех
-	profitRow := sqlmock.NewRows([]string{"id", "deals_id", "all_profit"}).
-		AddRow(1, testDeal.Id, testDeal.Profit-testDeal.Expenses)
-
-	dbMock.ExpectQuery(`INSERT INTO clear_profit \(deals_id,all_profit\) VALUES \(\$1,\$2\) RETURNING id, deals_id,all_profit`).
-		WithArgs(testDeal.Id, testDeal.Profit-testDeal.Expenses).
-		WillReturnRows(profitRow)
-
-	// Ожидания для MarkTransactionAsProcessed - ошибка
-	dbMock.ExpectQuery(`UPDATE transactions SET status=\$1 WHERE id=\$2 RETURNING id, title, expenses, profit, status`).
+	// Перевод в processed падает - транзакция откатывается вместе с прибылью,
+	// и worker прекращает обработку до следующего тика
+	dbMock.ExpectExec(`UPDATE transactions SET status=\$1, status_changed_at=now\(\) WHERE id=\$2`).
 		WithArgs("processed", testDeal.Id).
 		WillReturnError(errors.New("update error"))
+	dbMock.ExpectRollback()
 
 	// Не ожидаем вызов Redis DEL, так как при ошибке он не должен вызываться
-	// (убрали ExpectDel полностью)
-
-	// Создаем репозитории с моками
-	dealRepo := repository.NewDealRepository(db, redisClient)
-	profitRepo := repository.NewProfitRepository(db)
 
 	// Создаем worker
-	worker := NewDealWorker(logger, dealRepo, profitRepo)
+	worker := NewDealWorker(logger, repository.NewDealRepository(db, redisClient), config.Worker{}, "")
 
 	// Вызываем тестируемый метод
-	worker.MarkAsProcessed()
+	worker.MarkAsProcessed(context.Background())
 
 	// Проверяем, что все ожидания выполнены
 	assert.NoError(t, dbMock.ExpectationsWereMet())
 	assert.NoError(t, redisMock.ExpectationsWereMet())
 }
+
+func TestDealWorker_Run_StopsOnCancel(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, _ := setupMockRedis()
+
+	worker := NewDealWorker(zap.NewNop(), repository.NewDealRepository(db, redisClient), config.Worker{ProcessedTimeOut: time.Hour}, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		worker.Run(ctx)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop after context cancellation")
+	}
+
+	// Отменённый worker не должен обращаться к базе
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDealWorker_MarkAsProcessed_BatchSize(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, redisMock := setupMockRedis()
+
+	testDeal := models.Deal{Id: 1, Title: "Deal 1", Expenses: decimal.NewFromInt(100), Profit: decimal.NewFromInt(200), Currency: "USD", Status: "pending", UserId: 7}
+
+	// За один тик обрабатывается не больше BatchSize сделок,
+	// поэтому запроса "больше сделок нет" не будет
+	expectClaim(dbMock, testDeal)
+	dbMock.ExpectQuery(`INSERT INTO clear_profit`).
+		WillReturnRows(profitRows(1, testDeal))
+	expectTransition(dbMock, testDeal.Id, "processing", "processed", "")
+	dbMock.ExpectCommit()
+
+	redisMock.ExpectDel("notProcessedDeals:all:7", "processedDeals:all:7", "allDeals:get:7").SetVal(1)
+
+	worker := NewDealWorker(zap.NewNop(), repository.NewDealRepository(db, redisClient), config.Worker{BatchSize: 1}, "")
+
+	assert.NoError(t, worker.MarkAsProcessed(context.Background()))
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+	assert.NoError(t, redisMock.ExpectationsWereMet())
+}
+
+func TestDealWorker_MarkAsProcessed_ReturnsDatabaseError(t *testing.T) {
+	db, dbMock := setupMockDB(t)
+	defer db.Close()
+
+	redisClient, _ := setupMockRedis()
+
+	dbMock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+
+	worker := NewDealWorker(zap.NewNop(), repository.NewDealRepository(db, redisClient), config.Worker{}, "")
+
+	assert.EqualError(t, worker.MarkAsProcessed(context.Background()), "connection refused")
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDealWorker_MarkAsProcessed_MemoryStore(t *testing.T) {
+	store := memory.New(nil, nil, zap.NewNop())
+
+	for i := range 10 {
+		_, err := store.CreateNewDeal(context.Background(), 7, "Deal", decimal.NewFromInt(int64(i)), decimal.NewFromInt(100), "USD", models.StatusPending)
+		assert.NoError(t, err)
+	}
+
+	// Несколько горутин не должны провести одну сделку дважды
+	worker := NewDealWorker(zap.NewNop(), store, config.Worker{Concurrency: 4}, "")
+	assert.NoError(t, worker.MarkAsProcessed(context.Background()))
+
+	processed, err := store.GetAllProcessedDeals(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Len(t, processed, 10)
+
+	profits, err := store.GetAllProfitInfo(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Len(t, profits, 10)
+}
+
+func TestDealWorker_tick_FinishesAfterShutdown(t *testing.T) {
+	store := memory.New(nil, nil, zap.NewNop())
+
+	_, err := store.CreateNewDeal(context.Background(), 7, "Deal", decimal.NewFromInt(1), decimal.NewFromInt(100), "USD", models.StatusPending)
+	assert.NoError(t, err)
+
+	// Остановка сервера не прерывает уже начатую партию
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = store.CreateNewDeal(context.Background(), 7, "Draft", decimal.NewFromInt(1), decimal.NewFromInt(100), "USD", models.StatusDraft)
+	assert.NoError(t, err)
+
+	metrics.WorkerBacklog.Set(42)
+
+	worker := NewDealWorker(zap.NewNop(), store, config.Worker{}, "")
+	assert.Equal(t, DefaultTickTimeout, worker.cfg.TickTimeout)
+	assert.NoError(t, worker.tick(ctx))
+
+	// После партии в очереди не осталось ожидающих сделок
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.WorkerBacklog))
+
+	processed, err := store.GetAllProcessedDeals(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Len(t, processed, 1)
+}
+
+func TestDealWorker_tick_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	store := memory.New(nil, nil, zap.NewNop())
+	for range 2 {
+		_, err := store.CreateNewDeal(context.Background(), 7, "Deal", decimal.NewFromInt(1), decimal.NewFromInt(100), "USD", models.StatusPending)
+		assert.NoError(t, err)
+	}
+
+	worker := NewDealWorker(zap.NewNop(), store, config.Worker{}, "")
+	assert.NoError(t, worker.tick(context.Background()))
+
+	var tick sdktrace.ReadOnlySpan
+	var deals []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "worker.tick":
+			tick = span
+		case "worker.process_deal":
+			deals = append(deals, span)
+		}
+	}
+
+	// Каждый тик — отдельная трассировка, сделки — её дочерние спаны
+	if assert.NotNil(t, tick) {
+		assert.False(t, tick.Parent().IsValid())
+	}
+
+	processed := 0
+	for _, span := range deals {
+		assert.Equal(t, tick.SpanContext().TraceID(), span.SpanContext().TraceID())
+		for _, attr := range span.Attributes() {
+			if attr.Key == "deal.id" {
+				processed++
+			}
+		}
+	}
+	assert.Equal(t, 2, processed)
+}
+
+func TestDealWorker_CheckHeartbeat(t *testing.T) {
+	worker := NewDealWorker(zap.NewNop(), nil, config.Worker{
+		ProcessedTimeOut: time.Second,
+		MaxBackoff:       time.Second,
+		TickTimeout:      time.Second,
+	}, "")
+
+	assert.EqualError(t, worker.CheckHeartbeat(context.Background()), "worker not started")
+
+	worker.beat()
+	assert.NoError(t, worker.CheckHeartbeat(context.Background()))
+
+	// Цикл, не завершивший тик дольше допустимого, считается зависшим
+	worker.heartbeat.Store(time.Now().Add(-time.Minute).UnixNano())
+	assert.ErrorContains(t, worker.CheckHeartbeat(context.Background()), "no tick for")
+}
+
+func TestDealWorker_nextDelay(t *testing.T) {
+	worker := NewDealWorker(zap.NewNop(), nil, config.Worker{
+		ProcessedTimeOut: time.Second,
+		MaxBackoff:       10 * time.Second,
+	}, "")
+
+	assert.Equal(t, time.Second, worker.nextDelay(0))
+	assert.Equal(t, 2*time.Second, worker.nextDelay(1))
+	assert.Equal(t, 8*time.Second, worker.nextDelay(3))
+	assert.Equal(t, 10*time.Second, worker.nextDelay(4))
+	assert.Equal(t, 10*time.Second, worker.nextDelay(100))
+
+	// Джиттер добавляется сверху и не превышает настроенного значения
+	worker = NewDealWorker(zap.NewNop(), nil, config.Worker{
+		ProcessedTimeOut: time.Second,
+		Jitter:           100 * time.Millisecond,
+	}, "")
+	for range 20 {
+		delay := worker.nextDelay(0)
+		assert.GreaterOrEqual(t, delay, time.Second)
+		assert.Less(t, delay, time.Second+100*time.Millisecond)
+	}
+}
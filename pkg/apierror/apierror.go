@@ -0,0 +1,67 @@
+// Package apierror writes the JSON error envelope every endpoint fails with:
+//
+//	{"error": {"code": "validation_failed", "message": "...", "fields": [...], "request_id": "..."}}
+package apierror
+
+import (
+	"Brocker-pet-project/pkg/requestlog"
+	"encoding/json"
+	"net/http"
+)
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Body struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestId string       `json:"request_id,omitempty"`
+}
+
+type Response struct {
+	Error Body `json:"error"`
+}
+
+// codes are the machine readable codes of the statuses handlers fail with.
+var codes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusUnprocessableEntity:   "validation_failed",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusGatewayTimeout:        "timeout",
+}
+
+// Code returns the envelope code of status.
+func Code(status int) string {
+	if code, ok := codes[status]; ok {
+		return code
+	}
+	return "error"
+}
+
+// Write sends status with an error envelope carrying message, the rejected
+// fields if any, and the id of the request.
+func Write(w http.ResponseWriter, r *http.Request, status int, message string, fields ...FieldError) {
+	body := Response{Error: Body{
+		Code:      Code(status),
+		Message:   message,
+		Fields:    fields,
+		RequestId: requestlog.ID(r.Context()),
+	}}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
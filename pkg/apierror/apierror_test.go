@@ -0,0 +1,48 @@
+package apierror
+
+import (
+	"Brocker-pet-project/pkg/requestlog"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	handler := requestlog.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, http.StatusUnprocessableEntity, "Validation failed", FieldError{Field: "title", Message: "must not be empty"})
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/new_deal", nil)
+	req.Header.Set(requestlog.Header, "req-42")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var resp Response
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, Body{
+		Code:      "validation_failed",
+		Message:   "Validation failed",
+		Fields:    []FieldError{{Field: "title", Message: "must not be empty"}},
+		RequestId: "req-42",
+	}, resp.Error)
+}
+
+func TestWrite_NoFields(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	// Без middleware идентификатора запроса нет, поля fields и request_id опускаются
+	Write(w, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusNotFound, "Deal not found")
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": {"code": "not_found", "message": "Deal not found"}}`, w.Body.String())
+	assert.Equal(t, "timeout", Code(http.StatusGatewayTimeout))
+	assert.Equal(t, "error", Code(http.StatusTeapot))
+}
@@ -2,10 +2,15 @@ package database
 
 import (
 	"Brocker-pet-project/internal/config"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
 	"log"
+	"time"
 )
 
 var DB *sql.DB
@@ -17,7 +22,9 @@ func InitDB(cfg *config.Config) {
 
 	var err error
 
-	DB, err = sql.Open("postgres", psqlInfo)
+	// Every query gets a span, a child of the request or worker span in its
+	// context.
+	DB, err = otelsql.Open("postgres", psqlInfo, otelsql.WithAttributes(attribute.String("db.system", "postgresql")))
 	if err != nil {
 		log.Printf("Error opening database: %v", err)
 		return
@@ -29,11 +36,53 @@ func InitDB(cfg *config.Config) {
 
 }
 
+const (
+	defaultConnectTimeout = 30 * time.Second
+	maxConnectBackoff     = 5 * time.Second
+)
+
+// WaitForDB pings db until it answers, waiting twice as long after every
+// failed attempt, and gives up with the last error once timeout (30s when
+// zero) has passed. It lets the server start before Postgres does instead
+// of running against a dead database.
+func WaitForDB(ctx context.Context, db *sql.DB, timeout time.Duration) error {
+	if db == nil {
+		return errors.New("database is not opened")
+	}
+	if timeout <= 0 {
+		timeout = defaultConnectTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	backoff := 100 * time.Millisecond
+	for {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		log.Printf("Database is not reachable, retrying in %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database not reachable after %s: %w", timeout, err)
+		case <-time.After(backoff):
+		}
+
+		backoff = min(2*backoff, maxConnectBackoff)
+	}
+}
+
 func ReturnDB() *sql.DB {
 	return DB
 }
 
 func CloseDB() error {
+	if DB == nil {
+		return nil
+	}
 	err := DB.Close()
 	if err != nil {
 		return err
@@ -2,8 +2,12 @@ package database
 
 import (
 	"Brocker-pet-project/internal/config"
+	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -53,3 +57,25 @@ func TestDatabase(t *testing.T) {
 		assert.Error(t, err, "Ping should fail after closing connection")
 	})
 }
+
+func TestWaitForDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// База отвечает со второй попытки
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing()
+
+	assert.NoError(t, WaitForDB(context.Background(), db, time.Second))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	err = WaitForDB(context.Background(), db, 150*time.Millisecond)
+	assert.ErrorContains(t, err, "connection refused")
+
+	assert.Error(t, WaitForDB(context.Background(), nil, time.Second))
+}
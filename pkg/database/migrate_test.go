@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMigrationsFS() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_init.up.sql":     {Data: []byte("CREATE TABLE a (id INT);")},
+		"0001_init.down.sql":   {Data: []byte("DROP TABLE a;")},
+		"0002_second.up.sql":   {Data: []byte("CREATE TABLE b (id INT);")},
+		"0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"README.md":            {Data: []byte("ignored")},
+	}
+}
+
+func setupMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock, *sql.DB) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	migrator, err := newMigrator(db, testMigrationsFS())
+	require.NoError(t, err)
+
+	return migrator, mock, db
+}
+
+func expectLockAndVerify(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).
+		WithArgs(migrationLockKey).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, checksum, applied_at FROM schema_migrations`).
+		WillReturnRows(rows)
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).
+		WithArgs(migrationLockKey).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(testMigrationsFS())
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+
+	assert.Equal(t, int64(1), migrations[0].Version)
+	assert.Equal(t, "init", migrations[0].Name)
+	assert.Equal(t, "DROP TABLE a;", migrations[0].Down)
+	assert.NotEmpty(t, migrations[0].Checksum)
+	assert.Equal(t, int64(2), migrations[1].Version)
+
+	_, err = loadMigrations(fstest.MapFS{"0001_init.down.sql": {Data: []byte("DROP TABLE a;")}})
+	assert.Error(t, err, "migration without up script should be rejected")
+
+	_, err = loadMigrations(fstest.MapFS{"init.up.sql": {Data: []byte("SELECT 1;")}})
+	assert.Error(t, err, "migration without version should be rejected")
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrator, err := NewMigrator(nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrator.migrations)
+
+	for i, migration := range migrator.migrations {
+		assert.Equal(t, int64(i+1), migration.Version, "migration versions should be sequential")
+		assert.NotEmpty(t, migration.Down, "migration %d should have a down script", migration.Version)
+	}
+}
+
+func TestMigrator_Up(t *testing.T) {
+	migrator, mock, db := setupMigrator(t)
+	defer db.Close()
+
+	applied := sqlmock.NewRows([]string{"version", "checksum", "applied_at"}).
+		AddRow(1, migrator.migrations[0].Checksum, time.Now())
+	expectLockAndVerify(mock, applied)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE b`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).
+		WithArgs(int64(2), "second", migrator.migrations[1].Checksum).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	count, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Up_FailedMigrationRollsBack(t *testing.T) {
+	migrator, mock, db := setupMigrator(t)
+	defer db.Close()
+
+	expectLockAndVerify(mock, sqlmock.NewRows([]string{"version", "checksum", "applied_at"}))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE a`).WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+	expectUnlock(mock)
+
+	count, err := migrator.Up(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 0, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Up_ChecksumMismatch(t *testing.T) {
+	migrator, mock, db := setupMigrator(t)
+	defer db.Close()
+
+	applied := sqlmock.NewRows([]string{"version", "checksum", "applied_at"}).
+		AddRow(1, "tampered", time.Now())
+	expectLockAndVerify(mock, applied)
+	expectUnlock(mock)
+
+	_, err := migrator.Up(context.Background())
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Down(t *testing.T) {
+	migrator, mock, db := setupMigrator(t)
+	defer db.Close()
+
+	applied := sqlmock.NewRows([]string{"version", "checksum", "applied_at"}).
+		AddRow(1, migrator.migrations[0].Checksum, time.Now()).
+		AddRow(2, migrator.migrations[1].Checksum, time.Now())
+	expectLockAndVerify(mock, applied)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DROP TABLE b`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM schema_migrations WHERE version=\$1`).
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	count, err := migrator.Down(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Status(t *testing.T) {
+	migrator, mock, db := setupMigrator(t)
+	defer db.Close()
+
+	appliedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	applied := sqlmock.NewRows([]string{"version", "checksum", "applied_at"}).
+		AddRow(1, migrator.migrations[0].Checksum, appliedAt)
+	expectLockAndVerify(mock, applied)
+	expectUnlock(mock)
+
+	statuses, err := migrator.Status(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []MigrationStatus{
+		{Version: 1, Name: "init", Applied: true, AppliedAt: appliedAt},
+		{Version: 2, Name: "second"},
+	}, statuses)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Pending(t *testing.T) {
+	migrator, mock, db := setupMigrator(t)
+	defer db.Close()
+
+	// Проверка не берёт блокировку миграций
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+
+	pending, err := migrator.Pending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, pending)
+
+	// Таблицы версий ещё нет — не применена ни одна миграция
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).
+		WillReturnError(&pq.Error{Code: "42P01"})
+
+	pending, err = migrator.Pending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, pending)
+
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).
+		WillReturnError(errors.New("connection refused"))
+
+	_, err = migrator.Pending(context.Background())
+	assert.ErrorContains(t, err, "connection refused")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS clear_profit;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS users
+(
+    id       BIGSERIAL PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS transactions
+(
+    id       BIGSERIAL PRIMARY KEY,
+    title    TEXT             NOT NULL,
+    expenses DOUBLE PRECISION NOT NULL,
+    profit   DOUBLE PRECISION NOT NULL,
+    status   TEXT             NOT NULL DEFAULT 'not processed'
+);
+
+CREATE INDEX IF NOT EXISTS transactions_status_idx ON transactions (status);
+
+CREATE TABLE IF NOT EXISTS clear_profit
+(
+    id         BIGSERIAL PRIMARY KEY,
+    deals_id   BIGINT           NOT NULL REFERENCES transactions (id),
+    all_profit DOUBLE PRECISION NOT NULL
+);
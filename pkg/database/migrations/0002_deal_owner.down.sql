@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS clear_profit_user_id_idx;
+ALTER TABLE clear_profit DROP COLUMN IF EXISTS user_id;
+
+DROP INDEX IF EXISTS transactions_user_id_status_idx;
+ALTER TABLE transactions DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,15 @@
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS user_id BIGINT REFERENCES users (id);
+
+CREATE INDEX IF NOT EXISTS transactions_user_id_status_idx ON transactions (user_id, status);
+
+ALTER TABLE clear_profit
+    ADD COLUMN IF NOT EXISTS user_id BIGINT REFERENCES users (id);
+
+UPDATE clear_profit cp
+SET user_id = t.user_id
+FROM transactions t
+WHERE t.id = cp.deals_id
+  AND cp.user_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS clear_profit_user_id_idx ON clear_profit (user_id);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS deal_status_history;
+
+ALTER TABLE transactions
+    DROP CONSTRAINT IF EXISTS transactions_status_check,
+    DROP COLUMN IF EXISTS status_changed_at,
+    DROP COLUMN IF EXISTS created_at,
+    ALTER COLUMN status SET DEFAULT 'not processed';
+
+UPDATE transactions SET status = 'not processed' WHERE status IN ('draft', 'pending', 'processing', 'failed');
@@ -0,0 +1,21 @@
+UPDATE transactions SET status = 'pending' WHERE status = 'not processed';
+
+ALTER TABLE transactions
+    ALTER COLUMN status SET DEFAULT 'pending',
+    ADD COLUMN IF NOT EXISTS created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD CONSTRAINT transactions_status_check
+        CHECK (status IN ('draft', 'pending', 'processing', 'processed', 'failed', 'cancelled'));
+
+CREATE TABLE IF NOT EXISTS deal_status_history
+(
+    id          BIGSERIAL PRIMARY KEY,
+    deal_id     BIGINT      NOT NULL REFERENCES transactions (id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status   TEXT        NOT NULL,
+    actor       TEXT        NOT NULL,
+    reason      TEXT        NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS deal_status_history_deal_id_idx ON deal_status_history (deal_id, id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS clear_profit_deals_id_key;
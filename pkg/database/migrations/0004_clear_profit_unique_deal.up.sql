@@ -0,0 +1,7 @@
+-- Earlier worker runs could book a deal twice; keep the first booking.
+DELETE FROM clear_profit cp
+USING clear_profit earlier
+WHERE earlier.deals_id = cp.deals_id
+  AND earlier.id < cp.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS clear_profit_deals_id_key ON clear_profit (deals_id);
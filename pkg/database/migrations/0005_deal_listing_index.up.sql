@@ -0,0 +1,2 @@
+-- Keyset pagination of GET /api/deals sorted by creation time.
+CREATE INDEX IF NOT EXISTS transactions_user_id_created_at_idx ON transactions (user_id, created_at, id);
@@ -0,0 +1,6 @@
+ALTER TABLE clear_profit
+    ALTER COLUMN all_profit TYPE DOUBLE PRECISION;
+
+ALTER TABLE transactions
+    ALTER COLUMN expenses TYPE DOUBLE PRECISION,
+    ALTER COLUMN profit TYPE DOUBLE PRECISION;
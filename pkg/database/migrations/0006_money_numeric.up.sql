@@ -0,0 +1,6 @@
+ALTER TABLE transactions
+    ALTER COLUMN expenses TYPE NUMERIC(19, 4) USING round(expenses::numeric, 4),
+    ALTER COLUMN profit TYPE NUMERIC(19, 4) USING round(profit::numeric, 4);
+
+ALTER TABLE clear_profit
+    ALTER COLUMN all_profit TYPE NUMERIC(19, 4) USING round(all_profit::numeric, 4);
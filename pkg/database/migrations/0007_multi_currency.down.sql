@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS fx_rates;
+
+ALTER TABLE clear_profit
+    DROP COLUMN IF EXISTS fx_rate,
+    DROP COLUMN IF EXISTS reporting_currency,
+    DROP COLUMN IF EXISTS reporting_profit,
+    DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,31 @@
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+ALTER TABLE clear_profit
+    ADD COLUMN IF NOT EXISTS currency           CHAR(3),
+    ADD COLUMN IF NOT EXISTS reporting_profit   NUMERIC(19, 4),
+    ADD COLUMN IF NOT EXISTS reporting_currency CHAR(3),
+    ADD COLUMN IF NOT EXISTS fx_rate            NUMERIC(24, 10);
+
+UPDATE clear_profit
+SET currency           = 'USD',
+    reporting_profit   = all_profit,
+    reporting_currency = 'USD',
+    fx_rate            = 1
+WHERE currency IS NULL;
+
+ALTER TABLE clear_profit
+    ALTER COLUMN currency SET NOT NULL,
+    ALTER COLUMN reporting_profit SET NOT NULL,
+    ALTER COLUMN reporting_currency SET NOT NULL,
+    ALTER COLUMN fx_rate SET NOT NULL;
+
+CREATE TABLE IF NOT EXISTS fx_rates
+(
+    id             BIGSERIAL PRIMARY KEY,
+    base_currency  CHAR(3)         NOT NULL,
+    quote_currency CHAR(3)         NOT NULL,
+    rate           NUMERIC(24, 10) NOT NULL CHECK (rate > 0),
+    effective_at   TIMESTAMPTZ     NOT NULL,
+    UNIQUE (base_currency, quote_currency, effective_at)
+);
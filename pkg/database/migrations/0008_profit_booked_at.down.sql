@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS clear_profit_user_booked_at_idx;
+
+ALTER TABLE clear_profit
+    DROP COLUMN IF EXISTS booked_at;
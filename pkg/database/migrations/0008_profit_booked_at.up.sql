@@ -0,0 +1,10 @@
+ALTER TABLE clear_profit
+    ADD COLUMN IF NOT EXISTS booked_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+UPDATE clear_profit c
+SET booked_at = t.status_changed_at
+FROM transactions t
+WHERE t.id = c.deals_id;
+
+-- Date range filters of the profit reports.
+CREATE INDEX IF NOT EXISTS clear_profit_user_booked_at_idx ON clear_profit (user_id, booked_at);
@@ -0,0 +1,68 @@
+package hasher
+
+import (
+	"crypto/subtle"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"sync"
+)
+
+type Hasher struct {
+	cost int
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+// NewHasher returns a bcrypt hasher. A cost outside bcrypt's supported range
+// falls back to bcrypt.DefaultCost.
+func NewHasher(cost int) *Hasher {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &Hasher{cost: cost}
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify reports whether password matches the stored hash and whether the
+// hash should be replaced, either because it was produced with a different
+// cost or because it is a legacy plaintext value.
+func (h *Hasher) Verify(hash, password string) (ok bool, needsRehash bool) {
+	if !isBcryptHash(hash) {
+		ok = subtle.ConstantTimeCompare([]byte(hash), []byte(password)) == 1
+		return ok, ok
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return false, false
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true, true
+	}
+
+	return true, cost != h.cost
+}
+
+// DummyHash returns a bcrypt hash made at the configured cost that matches
+// no password. Verifying against it when a user does not exist makes the
+// lookup cost as much as checking a real password.
+func (h *Hasher) DummyHash() string {
+	h.dummyOnce.Do(func() {
+		// The error is impossible for a short password and a valid cost.
+		h.dummy, _ = h.Hash("dummy password for unknown users")
+	})
+	return h.dummy
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
@@ -0,0 +1,66 @@
+package hasher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHasher_HashAndVerify(t *testing.T) {
+	h := NewHasher(bcrypt.MinCost)
+
+	hash, err := h.Hash("secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, "secret", hash)
+
+	ok, rehash := h.Verify(hash, "secret")
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	ok, rehash = h.Verify(hash, "wrong")
+	assert.False(t, ok)
+	assert.False(t, rehash)
+}
+
+func TestHasher_Verify_CostChanged(t *testing.T) {
+	hash, err := NewHasher(bcrypt.MinCost).Hash("secret")
+	require.NoError(t, err)
+
+	ok, rehash := NewHasher(bcrypt.MinCost+1).Verify(hash, "secret")
+	assert.True(t, ok)
+	assert.True(t, rehash, "hash with outdated cost should be rehashed")
+}
+
+func TestHasher_Verify_LegacyPlaintext(t *testing.T) {
+	h := NewHasher(bcrypt.MinCost)
+
+	ok, rehash := h.Verify("secret", "secret")
+	assert.True(t, ok)
+	assert.True(t, rehash, "plaintext password should be rehashed")
+
+	ok, rehash = h.Verify("secret", "wrong")
+	assert.False(t, ok)
+	assert.False(t, rehash)
+}
+
+func TestNewHasher_InvalidCost(t *testing.T) {
+	assert.Equal(t, bcrypt.DefaultCost, NewHasher(0).cost)
+	assert.Equal(t, bcrypt.DefaultCost, NewHasher(bcrypt.MaxCost+1).cost)
+	assert.Equal(t, 12, NewHasher(12).cost)
+}
+
+func TestHasher_DummyHash(t *testing.T) {
+	h := NewHasher(bcrypt.MinCost + 1)
+
+	dummy := h.DummyHash()
+	// Хеш создаётся один раз с настроенной стоимостью
+	assert.Equal(t, dummy, h.DummyHash())
+	cost, err := bcrypt.Cost([]byte(dummy))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost+1, cost)
+
+	ok, _ := h.Verify(dummy, "")
+	assert.False(t, ok)
+}
@@ -1,23 +1,309 @@
 package jwt
 
 import (
+	"Brocker-pet-project/internal/config"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"os"
 	"time"
 )
 
-var secretKey = []byte("your_strong_secret_key") // Замени на случайный ключ!
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+	DefaultIssuer          = "broker-pet"
+	DefaultAudience        = "broker-pet-api"
 
-func GenerateToken(userID int64) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(), // Токен действует 24 часа
+	// legacyKeyID names the HS256 key built from config.Jwt.Token when no
+	// explicit keys are configured.
+	legacyKeyID = "default"
+
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+var (
+	ErrWrongTokenType = errors.New("wrong token type")
+	ErrUnknownKey     = errors.New("unknown signing key")
+)
+
+// Claims are carried by both access and refresh tokens. Every pair issued
+// from one login shares the same Family, so revoking the family revokes
+// all tokens descended from that login.
+type Claims struct {
+	UserID int64  `json:"user_id"`
+	Type   string `json:"typ"`
+	Family string `json:"fam"`
+	jwt.RegisteredClaims
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type key struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   any // nil for verification-only keys
+	verifyKey any
+}
+
+// Manager issues and validates tokens. It signs with one active key and
+// accepts any configured key, so a new key can be rolled out before the
+// old one is retired.
+type Manager struct {
+	issuer     string
+	audience   string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	signing    *key
+	keys       map[string]*key
+	methods    []string
+}
+
+func NewManager(cfg config.Jwt) (*Manager, error) {
+	m := &Manager{
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		accessTTL:  cfg.AccessTTL,
+		refreshTTL: cfg.RefreshTTL,
+		keys:       map[string]*key{},
+	}
+
+	if m.issuer == "" {
+		m.issuer = DefaultIssuer
+	}
+	if m.audience == "" {
+		m.audience = DefaultAudience
+	}
+	if m.accessTTL <= 0 {
+		m.accessTTL = DefaultAccessTokenTTL
+	}
+	if m.refreshTTL <= 0 {
+		m.refreshTTL = DefaultRefreshTokenTTL
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(secretKey)
+
+	keyConfigs := cfg.Keys
+	signingKey := cfg.SigningKey
+
+	if len(keyConfigs) == 0 {
+		if cfg.Token == "" {
+			return nil, errors.New("jwt: no signing keys configured")
+		}
+		keyConfigs = []config.JwtKey{{Kid: legacyKeyID, Algorithm: "HS256", Secret: cfg.Token}}
+		signingKey = legacyKeyID
+	}
+
+	seenMethods := map[string]bool{}
+
+	for _, keyConfig := range keyConfigs {
+		k, err := loadKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: key %q: %w", keyConfig.Kid, err)
+		}
+		if _, ok := m.keys[k.id]; ok {
+			return nil, fmt.Errorf("jwt: duplicate key id %q", k.id)
+		}
+		m.keys[k.id] = k
+
+		if !seenMethods[k.method.Alg()] {
+			seenMethods[k.method.Alg()] = true
+			m.methods = append(m.methods, k.method.Alg())
+		}
+	}
+
+	if signingKey == "" && len(keyConfigs) == 1 {
+		signingKey = keyConfigs[0].Kid
+	}
+
+	m.signing = m.keys[signingKey]
+	if m.signing == nil {
+		return nil, fmt.Errorf("jwt: signing key %q is not configured", signingKey)
+	}
+	if m.signing.signKey == nil {
+		return nil, fmt.Errorf("jwt: signing key %q has no private key", signingKey)
+	}
+
+	return m, nil
 }
 
-func ValidateToken(tokenString string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
+func loadKey(cfg config.JwtKey) (*key, error) {
+	if cfg.Kid == "" {
+		return nil, errors.New("missing kid")
+	}
+
+	k := &key{id: cfg.Kid}
+
+	switch cfg.Algorithm {
+	case "HS256":
+		if cfg.Secret == "" {
+			return nil, errors.New("missing secret")
+		}
+		k.method = jwt.SigningMethodHS256
+		k.signKey = []byte(cfg.Secret)
+		k.verifyKey = []byte(cfg.Secret)
+	case "RS256":
+		k.method = jwt.SigningMethodRS256
+		if cfg.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(cfg.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			k.signKey = private
+			k.verifyKey = &private.PublicKey
+		}
+		if cfg.PublicKeyFile != "" {
+			pem, err := os.ReadFile(cfg.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if k.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(pem); err != nil {
+				return nil, err
+			}
+		}
+	case "EdDSA":
+		k.method = jwt.SigningMethodEdDSA
+		if cfg.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(cfg.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			parsed, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			private, ok := parsed.(ed25519.PrivateKey)
+			if !ok {
+				return nil, errors.New("private key is not an Ed25519 key")
+			}
+			k.signKey = private
+			k.verifyKey = private.Public()
+		}
+		if cfg.PublicKeyFile != "" {
+			pem, err := os.ReadFile(cfg.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if k.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(pem); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.Algorithm)
+	}
+
+	if k.verifyKey == nil {
+		return nil, errors.New("missing private or public key file")
+	}
+
+	return k, nil
+}
+
+func (m *Manager) RefreshTTL() time.Duration {
+	return m.refreshTTL
+}
+
+// GenerateTokenPair issues an access and refresh token for a new login.
+func (m *Manager) GenerateTokenPair(userID int64) (*TokenPair, error) {
+	return m.generateTokenPair(userID, rand.Text())
+}
+
+// RotateTokenPair issues a new pair in the family of a used refresh token.
+func (m *Manager) RotateTokenPair(refresh *Claims) (*TokenPair, error) {
+	return m.generateTokenPair(refresh.UserID, refresh.Family)
+}
+
+func (m *Manager) generateTokenPair(userID int64, family string) (*TokenPair, error) {
+	accessToken, err := m.generateToken(userID, family, TokenTypeAccess, m.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := m.generateToken(userID, family, TokenTypeRefresh, m.refreshTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(m.accessTTL.Seconds()),
+	}, nil
+}
+
+func (m *Manager) generateToken(userID int64, family, tokenType string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		UserID: userID,
+		Type:   tokenType,
+		Family: family,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        rand.Text(),
+			Issuer:    m.issuer,
+			Audience:  jwt.ClaimStrings{m.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	token := jwt.NewWithClaims(m.signing.method, claims)
+	token.Header["kid"] = m.signing.id
+	return token.SignedString(m.signing.signKey)
+}
+
+// ValidateToken parses an access token.
+func (m *Manager) ValidateToken(tokenString string) (*Claims, error) {
+	return m.validate(tokenString, TokenTypeAccess)
+}
+
+// ValidateRefreshToken parses a refresh token.
+func (m *Manager) ValidateRefreshToken(tokenString string) (*Claims, error) {
+	return m.validate(tokenString, TokenTypeRefresh)
+}
+
+func (m *Manager) validate(tokenString, tokenType string) (*Claims, error) {
+	var claims Claims
+
+	_, err := jwt.ParseWithClaims(tokenString, &claims, m.keyFunc,
+		jwt.WithValidMethods(m.methods),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithAudience(m.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Type != tokenType {
+		return nil, ErrWrongTokenType
+	}
+
+	return &claims, nil
+}
+
+// keyFunc picks the verification key by kid and rejects tokens whose alg
+// differs from the one configured for that key.
+func (m *Manager) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	k, ok := m.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+	}
+
+	return k.verifyKey, nil
 }
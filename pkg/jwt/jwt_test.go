@@ -1,103 +1,296 @@
 package jwt
 
 import (
+	"Brocker-pet-project/internal/config"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+const testSecret = "test_secret_key"
+
+func newTestManager(t *testing.T) *Manager {
+	manager, err := NewManager(config.Jwt{Token: testSecret})
+	require.NoError(t, err)
+	return manager
+}
+
+// writePEM stores a private key as PKCS#8 and its public key as PKIX and
+// returns both file paths.
+func writePEM(t *testing.T, name string, private any, public any) (string, string) {
+	dir := t.TempDir()
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+
+	privatePath := filepath.Join(dir, name+".pem")
+	publicPath := filepath.Join(dir, name+".pub.pem")
+
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600))
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644))
+
+	return privatePath, publicPath
+}
+
 func TestGenerateAndValidateToken(t *testing.T) {
+	manager := newTestManager(t)
 
 	userID := int64(123)
 
-	tokenString, err := GenerateToken(userID)
+	pair, err := manager.GenerateTokenPair(userID)
 	assert.NoError(t, err)
-	assert.NotEmpty(t, tokenString)
+	assert.NotEmpty(t, pair.AccessToken)
+	assert.NotEmpty(t, pair.RefreshToken)
+	assert.Equal(t, int64(DefaultAccessTokenTTL.Seconds()), pair.ExpiresIn)
 
-	token, err := ValidateToken(tokenString)
+	claims, err := manager.ValidateToken(pair.AccessToken)
 	assert.NoError(t, err)
-	assert.True(t, token.Valid)
+	assert.Equal(t, userID, claims.UserID)
+	assert.Equal(t, TokenTypeAccess, claims.Type)
+	assert.Equal(t, DefaultIssuer, claims.Issuer)
+	assert.Equal(t, jwt.ClaimStrings{DefaultAudience}, claims.Audience)
+	assert.NotEmpty(t, claims.ID)
+	assert.NotEmpty(t, claims.Family)
+	assert.True(t, claims.ExpiresAt.Time.After(time.Now()))
+	assert.True(t, claims.ExpiresAt.Time.Before(time.Now().Add(DefaultAccessTokenTTL+time.Minute)))
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	assert.True(t, ok)
-	assert.Equal(t, float64(userID), claims["user_id"]) // jwt библиотека конвертирует числа в float64
+	refresh, err := manager.ValidateRefreshToken(pair.RefreshToken)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, refresh.UserID)
+	assert.Equal(t, claims.Family, refresh.Family)
+	assert.NotEqual(t, claims.ID, refresh.ID)
+}
 
-	exp, err := claims.GetExpirationTime()
+func TestValidateToken_WrongType(t *testing.T) {
+	manager := newTestManager(t)
+
+	pair, err := manager.GenerateTokenPair(1)
 	assert.NoError(t, err)
-	assert.True(t, exp.Time.After(time.Now()))
+
+	_, err = manager.ValidateToken(pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrWrongTokenType, "refresh token must not be accepted as access token")
+
+	_, err = manager.ValidateRefreshToken(pair.AccessToken)
+	assert.ErrorIs(t, err, ErrWrongTokenType, "access token must not be accepted as refresh token")
+}
+
+func TestRotateTokenPair(t *testing.T) {
+	manager := newTestManager(t)
+
+	pair, err := manager.GenerateTokenPair(5)
+	assert.NoError(t, err)
+
+	refresh, err := manager.ValidateRefreshToken(pair.RefreshToken)
+	assert.NoError(t, err)
+
+	rotated, err := manager.RotateTokenPair(refresh)
+	assert.NoError(t, err)
+
+	rotatedRefresh, err := manager.ValidateRefreshToken(rotated.RefreshToken)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), rotatedRefresh.UserID)
+	assert.Equal(t, refresh.Family, rotatedRefresh.Family, "rotation keeps the token family")
+	assert.NotEqual(t, refresh.ID, rotatedRefresh.ID)
 }
 
 func TestValidateToken_Invalid(t *testing.T) {
+	manager := newTestManager(t)
+
+	validClaims := func() jwt.MapClaims {
+		now := time.Now()
+		return jwt.MapClaims{
+			"user_id": 123,
+			"typ":     TokenTypeAccess,
+			"iss":     DefaultIssuer,
+			"aud":     DefaultAudience,
+			"iat":     now.Unix(),
+			"exp":     now.Add(time.Hour).Unix(),
+		}
+	}
+
+	sign := func(method jwt.SigningMethod, kid string, claims jwt.MapClaims, key any) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		tokenString, err := token.SignedString(key)
+		require.NoError(t, err)
+		return tokenString
+	}
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-24 * time.Hour).Unix()
+
+	noExpiry := validClaims()
+	delete(noExpiry, "exp")
+
+	wrongIssuer := validClaims()
+	wrongIssuer["iss"] = "someone-else"
+
+	wrongAudience := validClaims()
+	wrongAudience["aud"] = "another-api"
+
+	notYetValid := validClaims()
+	notYetValid["nbf"] = time.Now().Add(time.Hour).Unix()
+
 	testCases := []struct {
 		name        string
 		tokenString string
-		expectError bool
 	}{
-		{
-			name:        "empty token",
-			tokenString: "",
-			expectError: true,
-		},
-		{
-			name:        "invalid token",
-			tokenString: "invalid.token.string",
-			expectError: true,
-		},
-		{
-			name:        "expired token",
-			tokenString: generateExpiredToken(t),
-			expectError: true,
-		},
-		{
-			name:        "wrong signing method",
-			tokenString: generateTokenWithWrongSigningMethod(t),
-			expectError: true,
-		},
+		{name: "empty token", tokenString: ""},
+		{name: "invalid token", tokenString: "invalid.token.string"},
+		{name: "expired token", tokenString: sign(jwt.SigningMethodHS256, legacyKeyID, expired, []byte(testSecret))},
+		{name: "missing expiry", tokenString: sign(jwt.SigningMethodHS256, legacyKeyID, noExpiry, []byte(testSecret))},
+		{name: "wrong issuer", tokenString: sign(jwt.SigningMethodHS256, legacyKeyID, wrongIssuer, []byte(testSecret))},
+		{name: "wrong audience", tokenString: sign(jwt.SigningMethodHS256, legacyKeyID, wrongAudience, []byte(testSecret))},
+		{name: "not valid yet", tokenString: sign(jwt.SigningMethodHS256, legacyKeyID, notYetValid, []byte(testSecret))},
+		{name: "missing kid", tokenString: sign(jwt.SigningMethodHS256, "", validClaims(), []byte(testSecret))},
+		{name: "unknown kid", tokenString: sign(jwt.SigningMethodHS256, "other", validClaims(), []byte(testSecret))},
+		{name: "wrong secret", tokenString: sign(jwt.SigningMethodHS256, legacyKeyID, validClaims(), []byte("other secret"))},
+		{name: "wrong signing method", tokenString: sign(jwt.SigningMethodES256, legacyKeyID, validClaims(), ecdsaKey)},
+		{name: "none algorithm", tokenString: sign(jwt.SigningMethodNone, legacyKeyID, validClaims(), jwt.UnsafeAllowNoneSignatureType)},
 	}
 
+	// Make sure the helpers themselves produce acceptable tokens.
+	_, err = manager.ValidateToken(sign(jwt.SigningMethodHS256, legacyKeyID, validClaims(), []byte(testSecret)))
+	require.NoError(t, err)
+
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			token, err := ValidateToken(tc.tokenString)
-			if tc.expectError {
-				assert.Error(t, err)
-				if token != nil {
-					assert.False(t, token.Valid)
-				}
-			} else {
-				assert.NoError(t, err)
-				assert.True(t, token.Valid)
-			}
+			claims, err := manager.ValidateToken(tc.tokenString)
+			assert.Error(t, err)
+			assert.Nil(t, claims)
 		})
 	}
 }
 
-func generateExpiredToken(t *testing.T) string {
-	claims := jwt.MapClaims{
-		"user_id": 123,
-		"exp":     time.Now().Add(-24 * time.Hour).Unix(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(secretKey)
-	assert.NoError(t, err)
-	return tokenString
+func TestValidateToken_AlgorithmConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaPrivatePath, rsaPublicPath := writePEM(t, "rsa", rsaKey, &rsaKey.PublicKey)
+	rsaPublicPEM, err := os.ReadFile(rsaPublicPath)
+	require.NoError(t, err)
+
+	manager, err := NewManager(config.Jwt{
+		Keys: []config.JwtKey{{Kid: "rsa", Algorithm: "RS256", PrivateKeyFile: rsaPrivatePath}},
+	})
+	require.NoError(t, err)
+
+	// An attacker signs an HS256 token using the published RSA key as the
+	// HMAC secret and points kid at the RSA key.
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": 1,
+		"typ":     TokenTypeAccess,
+		"iss":     DefaultIssuer,
+		"aud":     DefaultAudience,
+		"iat":     now.Unix(),
+		"exp":     now.Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "rsa"
+	forged, err := token.SignedString(rsaPublicPEM)
+	require.NoError(t, err)
+
+	_, err = manager.ValidateToken(forged)
+	assert.Error(t, err)
 }
 
-func generateTokenWithWrongSigningMethod(t *testing.T) string {
-	// Генерируем ECDSA ключ для теста
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	assert.NoError(t, err)
+func TestManager_AsymmetricKeyRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaPrivatePath, rsaPublicPath := writePEM(t, "rsa", rsaKey, &rsaKey.PublicKey)
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edPrivatePath, _ := writePEM(t, "ed", edPrivate, edPublic)
+
+	// Old deployment signs with RS256.
+	oldManager, err := NewManager(config.Jwt{
+		Keys: []config.JwtKey{{Kid: "old", Algorithm: "RS256", PrivateKeyFile: rsaPrivatePath}},
+	})
+	require.NoError(t, err)
+
+	// New deployment signs with EdDSA but still verifies the RS256 key.
+	newManager, err := NewManager(config.Jwt{
+		SigningKey: "new",
+		Keys: []config.JwtKey{
+			{Kid: "new", Algorithm: "EdDSA", PrivateKeyFile: edPrivatePath},
+			{Kid: "old", Algorithm: "RS256", PublicKeyFile: rsaPublicPath},
+		},
+	})
+	require.NoError(t, err)
+
+	oldPair, err := oldManager.GenerateTokenPair(9)
+	require.NoError(t, err)
+	newPair, err := newManager.GenerateTokenPair(9)
+	require.NoError(t, err)
+
+	claims, err := newManager.ValidateToken(oldPair.AccessToken)
+	require.NoError(t, err, "tokens signed with the retiring key must stay valid")
+	assert.Equal(t, int64(9), claims.UserID)
+
+	claims, err = newManager.ValidateToken(newPair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), claims.UserID)
+
+	_, err = oldManager.ValidateToken(newPair.AccessToken)
+	assert.Error(t, err, "old deployment does not know the new key")
+
+	token, _, err := jwt.NewParser().ParseUnverified(newPair.AccessToken, &Claims{})
+	require.NoError(t, err)
+	assert.Equal(t, "new", token.Header["kid"])
+	assert.Equal(t, "EdDSA", token.Method.Alg())
+}
+
+func TestNewManager_Errors(t *testing.T) {
+	_, publicPath := func() (string, string) {
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		return writePEM(t, "rsa", rsaKey, &rsaKey.PublicKey)
+	}()
 
-	claims := jwt.MapClaims{
-		"user_id": 123,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+	testCases := []struct {
+		name string
+		cfg  config.Jwt
+	}{
+		{name: "no keys", cfg: config.Jwt{}},
+		{name: "unsupported algorithm", cfg: config.Jwt{Keys: []config.JwtKey{{Kid: "a", Algorithm: "HS512", Secret: "s"}}}},
+		{name: "missing secret", cfg: config.Jwt{Keys: []config.JwtKey{{Kid: "a", Algorithm: "HS256"}}}},
+		{name: "missing kid", cfg: config.Jwt{Keys: []config.JwtKey{{Algorithm: "HS256", Secret: "s"}}}},
+		{name: "unknown signing key", cfg: config.Jwt{SigningKey: "b", Keys: []config.JwtKey{{Kid: "a", Algorithm: "HS256", Secret: "s"}}}},
+		{name: "ambiguous signing key", cfg: config.Jwt{Keys: []config.JwtKey{
+			{Kid: "a", Algorithm: "HS256", Secret: "s"},
+			{Kid: "b", Algorithm: "HS256", Secret: "t"},
+		}}},
+		{name: "duplicate kid", cfg: config.Jwt{SigningKey: "a", Keys: []config.JwtKey{
+			{Kid: "a", Algorithm: "HS256", Secret: "s"},
+			{Kid: "a", Algorithm: "HS256", Secret: "t"},
+		}}},
+		{name: "signing key without private key", cfg: config.Jwt{Keys: []config.JwtKey{{Kid: "a", Algorithm: "RS256", PublicKeyFile: publicPath}}}},
+		{name: "missing key file", cfg: config.Jwt{Keys: []config.JwtKey{{Kid: "a", Algorithm: "EdDSA", PrivateKeyFile: "does-not-exist.pem"}}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewManager(tc.cfg)
+			assert.Error(t, err)
+		})
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
-	tokenString, err := token.SignedString(privateKey)
-	assert.NoError(t, err)
-	return tokenString
 }
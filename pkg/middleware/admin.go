@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"Brocker-pet-project/pkg/apierror"
+	"net/http"
+)
+
+// AdminMiddleware lets through only the configured admin users. It must run
+// after AuthMiddleware.
+type AdminMiddleware struct {
+	admins map[int64]bool
+}
+
+func NewAdminMiddleware(userIds []int64) *AdminMiddleware {
+	admins := make(map[int64]bool, len(userIds))
+	for _, id := range userIds {
+		admins[id] = true
+	}
+	return &AdminMiddleware{admins: admins}
+}
+
+func (m *AdminMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := UserIDFromContext(r.Context())
+		if !ok {
+			apierror.Write(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		if !m.admins[userID] {
+			apierror.Write(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         int64
+		expectedStatus int
+	}{
+		{name: "Admin", userID: 1, expectedStatus: http.StatusOK},
+		{name: "Not an admin", userID: 2, expectedStatus: http.StatusForbidden},
+		{name: "Unauthenticated", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "http://example.com", nil)
+			// Без пользователя в контексте middleware должен вернуть 401
+			if tt.userID != 0 {
+				req = req.WithContext(WithUserID(req.Context(), tt.userID))
+			}
+
+			rr := httptest.NewRecorder()
+			NewAdminMiddleware([]int64{1}).Handler(handler).ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+		})
+	}
+}
@@ -1,24 +1,107 @@
 package middleware
 
 import (
+	"Brocker-pet-project/pkg/apierror"
 	jwt2 "Brocker-pet-project/pkg/jwt"
+	"Brocker-pet-project/pkg/requestlog"
+	"Brocker-pet-project/pkg/tokenstore"
+	"context"
+	"errors"
+	"go.uber.org/zap"
 	"net/http"
+	"time"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
+type contextKey string
+
+const (
+	userIDKey contextKey = "user_id"
+	claimsKey contextKey = "claims"
+)
+
+type AuthMiddleware struct {
+	tokens *jwt2.Manager
+	store  tokenstore.Store
+
+	// lookupTimeout bounds the revocation lookup, also on routes that run
+	// without a request deadline. 0 leaves it to the request context.
+	lookupTimeout time.Duration
+}
+
+func NewAuthMiddleware(tokens *jwt2.Manager, store tokenstore.Store, lookupTimeout time.Duration) *AuthMiddleware {
+	return &AuthMiddleware{tokens: tokens, store: store, lookupTimeout: lookupTimeout}
+}
+
+func (m *AuthMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tokenString := r.Header.Get("Authorization")
 		if tokenString == "" {
-			http.Error(w, "Missing token", http.StatusUnauthorized)
+			apierror.Write(w, r, http.StatusUnauthorized, "Missing token")
+			return
+		}
+
+		claims, err := m.tokens.ValidateToken(tokenString)
+		if err != nil || claims.UserID <= 0 {
+			apierror.Write(w, r, http.StatusForbidden, "Invalid token")
 			return
 		}
 
-		_, err := jwt2.ValidateToken(tokenString)
+		revoked, err := m.isRevoked(r.Context(), claims)
+		if errors.Is(err, context.DeadlineExceeded) {
+			requestlog.Logger(r.Context(), zap.L()).Warn("Token revocation check timed out", zap.Error(err))
+			apierror.Write(w, r, http.StatusGatewayTimeout, "Request timed out")
+			return
+		}
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusForbidden)
+			requestlog.Logger(r.Context(), zap.L()).Error("Error checking token revocation", zap.Error(err))
+			apierror.Write(w, r, http.StatusInternalServerError, "Internal server error")
 			return
 		}
+		if revoked {
+			apierror.Write(w, r, http.StatusUnauthorized, "Token revoked")
+			return
+		}
+
+		ctx := WithUserID(r.Context(), claims.UserID)
+		ctx = WithClaims(ctx, claims)
+		ctx = requestlog.WithUserID(ctx, claims.UserID)
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+func (m *AuthMiddleware) isRevoked(ctx context.Context, claims *jwt2.Claims) (bool, error) {
+	if m.lookupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.lookupTimeout)
+		defer cancel()
+	}
+
+	revoked, err := m.store.IsRevoked(ctx, claims.ID)
+	if err != nil || revoked {
+		return revoked, err
+	}
+	return m.store.IsFamilyRevoked(ctx, claims.Family)
+}
+
+// WithUserID returns a copy of ctx carrying the authenticated user id.
+func WithUserID(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext returns the user id stored by AuthMiddleware.
+func UserIDFromContext(ctx context.Context) (int64, bool) {
+	userID, ok := ctx.Value(userIDKey).(int64)
+	return userID, ok
+}
+
+// WithClaims returns a copy of ctx carrying the access token claims.
+func WithClaims(ctx context.Context, claims *jwt2.Claims) context.Context {
+	return context.WithValue(ctx, claimsKey, claims)
+}
+
+// ClaimsFromContext returns the access token claims stored by AuthMiddleware.
+func ClaimsFromContext(ctx context.Context) (*jwt2.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*jwt2.Claims)
+	return claims, ok
+}
@@ -1,18 +1,43 @@
 package middleware
 
 import (
+	"Brocker-pet-project/internal/config"
 	"Brocker-pet-project/pkg/jwt"
+	"Brocker-pet-project/pkg/tokenstore"
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestAuthMiddleware(t *testing.T) {
+	tokens, err := jwt.NewManager(config.Jwt{Token: "test_secret_key"})
+	if err != nil {
+		t.Fatalf("Failed to create token manager: %v", err)
+	}
+
 	// Генерируем валидный тестовый токен
-	validToken, err := jwt.GenerateToken(1)
+	pair, err := tokens.GenerateTokenPair(1)
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	revokedPair, err := tokens.GenerateTokenPair(1)
 	if err != nil {
 		t.Fatalf("Failed to generate test token: %v", err)
 	}
+	revokedClaims, _ := tokens.ValidateToken(revokedPair.AccessToken)
+
+	familyPair, err := tokens.GenerateTokenPair(1)
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+	familyClaims, _ := tokens.ValidateToken(familyPair.AccessToken)
+
+	store := tokenstore.NewMemoryStore()
+	store.Revoke(context.Background(), revokedClaims.ID, time.Hour)
+	store.RevokeFamily(context.Background(), familyClaims.Family, time.Hour)
 
 	tests := []struct {
 		name           string
@@ -21,7 +46,7 @@ func TestAuthMiddleware(t *testing.T) {
 	}{
 		{
 			name:           "Valid token",
-			token:          validToken,
+			token:          pair.AccessToken,
 			expectedStatus: http.StatusOK,
 		},
 		{
@@ -34,12 +59,33 @@ func TestAuthMiddleware(t *testing.T) {
 			token:          "invalid.token.here",
 			expectedStatus: http.StatusForbidden,
 		},
+		{
+			name:           "Refresh token used as access token",
+			token:          pair.RefreshToken,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Revoked token",
+			token:          revokedPair.AccessToken,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Revoked token family",
+			token:          familyPair.AccessToken,
+			expectedStatus: http.StatusUnauthorized,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Создаем тестовый обработчик, который будет вызван после middleware
 			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userID, ok := UserIDFromContext(r.Context())
+				claims, claimsOk := ClaimsFromContext(r.Context())
+				if !ok || !claimsOk || userID != 1 || claims.UserID != userID {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
 				w.WriteHeader(http.StatusOK)
 			})
 
@@ -53,7 +99,7 @@ func TestAuthMiddleware(t *testing.T) {
 			rr := httptest.NewRecorder()
 
 			// Применяем middleware к тестовому обработчику
-			middleware := AuthMiddleware(handler)
+			middleware := NewAuthMiddleware(tokens, store, time.Second).Handler(handler)
 			middleware.ServeHTTP(rr, req)
 
 			// Проверяем статус код
@@ -64,3 +110,44 @@ func TestAuthMiddleware(t *testing.T) {
 		})
 	}
 }
+
+// slowStore is a token store whose revocation lookup hangs until its
+// context is done, like Redis that does not answer.
+type slowStore struct {
+	tokenstore.Store
+}
+
+func (slowStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func TestAuthMiddleware_LookupTimeout(t *testing.T) {
+	tokens, err := jwt.NewManager(config.Jwt{Token: "test_secret_key"})
+	if err != nil {
+		t.Fatalf("Failed to create token manager: %v", err)
+	}
+	pair, err := tokens.GenerateTokenPair(1)
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set("Authorization", pair.AccessToken)
+	rr := httptest.NewRecorder()
+
+	// Проверка отзыва ограничена по времени даже без дедлайна запроса
+	NewAuthMiddleware(tokens, slowStore{tokenstore.NewMemoryStore()}, 10*time.Millisecond).Handler(handler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusGatewayTimeout)
+	}
+	if called {
+		t.Error("handler called after the revocation lookup timed out")
+	}
+}
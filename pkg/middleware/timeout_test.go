@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		hasDeadline bool
+	}{
+		{name: "With timeout", timeout: time.Second, hasDeadline: true},
+		{name: "Disabled", timeout: 0, hasDeadline: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deadline time.Time
+			var ok bool
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				deadline, ok = r.Context().Deadline()
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "http://example.com", nil)
+			rr := httptest.NewRecorder()
+			start := time.Now()
+			Timeout(tt.timeout)(handler).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.hasDeadline, ok)
+			if tt.hasDeadline {
+				assert.WithinDuration(t, start.Add(tt.timeout), deadline, 100*time.Millisecond)
+			}
+		})
+	}
+}
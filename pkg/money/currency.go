@@ -0,0 +1,29 @@
+package money
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/text/currency"
+)
+
+// DefaultCurrency is used for deals created before currencies were tracked
+// and when no reporting currency is configured.
+const DefaultCurrency = "USD"
+
+var ErrCurrency = errors.New("unknown ISO 4217 currency")
+
+// ParseCurrency returns the upper-case ISO 4217 code for s.
+func ParseCurrency(s string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(s))
+	if len(code) != 3 {
+		return "", ErrCurrency
+	}
+
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return "", ErrCurrency
+	}
+
+	return unit.String(), nil
+}
@@ -0,0 +1,19 @@
+package money
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCurrency(t *testing.T) {
+	code, err := ParseCurrency(" eur ")
+	assert.NoError(t, err)
+	assert.Equal(t, "EUR", code)
+
+	_, err = ParseCurrency("ABC")
+	assert.ErrorIs(t, err, ErrCurrency)
+
+	_, err = ParseCurrency("EURO")
+	assert.ErrorIs(t, err, ErrCurrency)
+}
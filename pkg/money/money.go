@@ -0,0 +1,45 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Scale and Precision match the NUMERIC(19,4) columns amounts are stored in.
+const (
+	Scale     = 4
+	Precision = 19
+)
+
+var (
+	ErrScale     = fmt.Errorf("amount has more than %d decimal places", Scale)
+	ErrPrecision = fmt.Errorf("amount has more than %d integer digits", Precision-Scale)
+	ErrInvalid   = errors.New("invalid amount")
+)
+
+var limit = decimal.New(1, Precision-Scale)
+
+// Validate reports whether amount can be stored without rounding.
+func Validate(amount decimal.Decimal) error {
+	if !amount.Equal(amount.Truncate(Scale)) {
+		return ErrScale
+	}
+	if amount.Abs().GreaterThanOrEqual(limit) {
+		return ErrPrecision
+	}
+	return nil
+}
+
+// Parse reads a decimal string such as "1250.50" and validates it.
+func Parse(s string) (decimal.Decimal, error) {
+	amount, err := decimal.NewFromString(s)
+	if err != nil {
+		return decimal.Decimal{}, fmt.Errorf("%w %q", ErrInvalid, s)
+	}
+	if err := Validate(amount); err != nil {
+		return decimal.Decimal{}, err
+	}
+	return amount, nil
+}
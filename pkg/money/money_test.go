@@ -0,0 +1,51 @@
+package money
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		amount string
+		err    error
+	}{
+		{"0", nil},
+		{"100.5", nil},
+		{"-42.1234", nil},
+		{"1.10000", nil}, // нули в конце не увеличивают точность
+		{"999999999999999.9999", nil},
+		{"0.00001", ErrScale},
+		{"1000000000000000", ErrPrecision},
+		{"-1000000000000000", ErrPrecision},
+	}
+
+	for _, tt := range tests {
+		err := Validate(decimal.RequireFromString(tt.amount))
+		if tt.err == nil {
+			assert.NoError(t, err, tt.amount)
+		} else {
+			assert.ErrorIs(t, err, tt.err, tt.amount)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	amount, err := Parse("1250.50")
+	assert.NoError(t, err)
+	assert.True(t, amount.Equal(decimal.RequireFromString("1250.5")))
+
+	_, err = Parse("12,5")
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	_, err = Parse("0.123456")
+	assert.ErrorIs(t, err, ErrScale)
+}
+
+func TestExactArithmetic(t *testing.T) {
+	// 0.3 - 0.1 в float64 даёт 0.19999999999999998
+	profit := decimal.RequireFromString("0.3").Sub(decimal.RequireFromString("0.1"))
+	assert.Equal(t, "0.2", profit.String())
+}
@@ -2,11 +2,21 @@ package redis
 
 import (
 	"Brocker-pet-project/internal/config"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
+	"log"
 )
 
+// NewRedisClient returns a client whose commands are traced as children of
+// the span in their context.
 func NewRedisClient(cfg *config.Config) *redis.Client {
-	return redis.NewClient(&redis.Options{
+	client := redis.NewClient(&redis.Options{
 		Addr: cfg.Redis.Address,
 	})
+
+	if err := redisotel.InstrumentTracing(client); err != nil {
+		log.Printf("Error instrumenting redis tracing: %v", err)
+	}
+
+	return client
 }
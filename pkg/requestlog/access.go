@@ -0,0 +1,97 @@
+package requestlog
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// entry collects what inner middleware learn about the request, such as
+// the authenticated user, for the access line written on the way out.
+type entry struct {
+	userID int64
+}
+
+// AccessLog puts a logger tagged with the request id, plus whatever
+// contextFields returns for the request, in the context of every request
+// and writes one access line when it completes. It must run after
+// RequestID and on the root router, as the route pattern is only complete
+// once the request has been routed.
+func AccessLog(log *zap.Logger, contextFields func(context.Context) []zap.Field) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			fields := []zap.Field{zap.String("request_id", ID(r.Context()))}
+			if contextFields != nil {
+				fields = append(fields, contextFields(r.Context())...)
+			}
+			requestLog := log.With(fields...)
+
+			e := &entry{}
+			ctx := context.WithValue(WithLogger(r.Context(), requestLog), entryKey, e)
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			route := ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+
+			accessFields := []zap.Field{
+				zap.String("method", r.Method),
+				zap.String("route", route),
+				zap.String("path", r.URL.Path),
+				zap.Int("status", status),
+				zap.Int("bytes", ww.BytesWritten()),
+				zap.Duration("latency", time.Since(start)),
+			}
+			if e.userID != 0 {
+				accessFields = append(accessFields, zap.Int64("user_id", e.userID))
+			}
+
+			if status >= http.StatusInternalServerError {
+				requestLog.Error("Request handled", accessFields...)
+				return
+			}
+			requestLog.Info("Request handled", accessFields...)
+		})
+	}
+}
+
+// WithLogger returns ctx carrying log as the request logger.
+func WithLogger(ctx context.Context, log *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, log)
+}
+
+// Logger returns the request logger of ctx, or fallback when ctx does not
+// come from a request passed through AccessLog.
+func Logger(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if log, ok := ctx.Value(loggerKey).(*zap.Logger); ok {
+		return log
+	}
+	return fallback
+}
+
+// WithUserID records the authenticated user of the request for the access
+// line and returns ctx with the request logger tagged with it.
+func WithUserID(ctx context.Context, userID int64) context.Context {
+	if e, ok := ctx.Value(entryKey).(*entry); ok {
+		e.userID = userID
+	}
+
+	log, ok := ctx.Value(loggerKey).(*zap.Logger)
+	if !ok {
+		return ctx
+	}
+	return WithLogger(ctx, log.With(zap.Int64("user_id", userID)))
+}
@@ -0,0 +1,99 @@
+package requestlog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newTestRouter(log *zap.Logger) chi.Router {
+	r := chi.NewRouter()
+	r.Use(RequestID)
+	r.Use(AccessLog(log, func(context.Context) []zap.Field {
+		return []zap.Field{zap.String("trace_id", "trace")}
+	}))
+	return r
+}
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	r := newTestRouter(zap.New(core))
+	r.Get("/api/deals/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithUserID(r.Context(), 7)
+		Logger(ctx, zap.NewNop()).Info("Inside handler")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/deals/42", nil)
+	req.Header.Set(Header, "req-1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+
+	// Лог обработчика помечен id запроса, трассой и пользователем
+	inner := entries[0].ContextMap()
+	assert.Equal(t, "Inside handler", entries[0].Message)
+	assert.Equal(t, "req-1", inner["request_id"])
+	assert.Equal(t, "trace", inner["trace_id"])
+	assert.Equal(t, int64(7), inner["user_id"])
+
+	// Строка доступа содержит шаблон маршрута, статус, размер и пользователя
+	access := entries[1]
+	assert.Equal(t, "Request handled", access.Message)
+	assert.Equal(t, zapcore.InfoLevel, access.Level)
+	fields := access.ContextMap()
+	assert.Equal(t, "req-1", fields["request_id"])
+	assert.Equal(t, http.MethodGet, fields["method"])
+	assert.Equal(t, "/api/deals/{id}", fields["route"])
+	assert.Equal(t, "/api/deals/42", fields["path"])
+	assert.Equal(t, int64(http.StatusCreated), fields["status"])
+	assert.Equal(t, int64(5), fields["bytes"])
+	assert.Equal(t, int64(7), fields["user_id"])
+	assert.Contains(t, fields, "latency")
+}
+
+func TestAccessLog_ServerErrorAtErrorLevel(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	r := newTestRouter(zap.New(core))
+	r.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 1)
+	assert.Equal(t, zapcore.ErrorLevel, entries[0].Level)
+	assert.NotContains(t, entries[0].ContextMap(), "user_id")
+}
+
+func TestAccessLog_ImplicitOK(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	r := newTestRouter(zap.New(core))
+	r.Get("/empty", func(w http.ResponseWriter, r *http.Request) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/empty", nil))
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(http.StatusOK), entries[0].ContextMap()["status"])
+}
+
+func TestLogger_Fallback(t *testing.T) {
+	fallback := zap.NewNop()
+	assert.Same(t, fallback, Logger(context.Background(), fallback))
+
+	// Без AccessLog WithUserID не меняет контекст
+	ctx := context.Background()
+	assert.Equal(t, ctx, WithUserID(ctx, 1))
+}
@@ -0,0 +1,64 @@
+// Package requestlog identifies requests and logs them: it assigns every
+// request an id, writes one access line per request and carries a logger
+// tagged with the request through its context.
+package requestlog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header carries the request id, both ways.
+const Header = "X-Request-ID"
+
+// maxIDLength bounds ids taken from clients, which end up in every log line.
+const maxIDLength = 128
+
+type contextKey string
+
+const (
+	requestIDKey contextKey = "request_id"
+	loggerKey    contextKey = "logger"
+	entryKey     contextKey = "access_entry"
+)
+
+// RequestID takes the id of the request from the X-Request-ID header, or
+// generates one when it is missing or malformed, stores it in the context
+// and echoes it in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !validID(id) {
+			id = newID()
+		}
+
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// ID returns the id RequestID gave the request, or "" outside of it.
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func validID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
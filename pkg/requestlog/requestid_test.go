@@ -0,0 +1,54 @@
+package requestlog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "Keeps client id", incoming: "abc-123", keep: true},
+		{name: "Generates missing id", incoming: "", keep: false},
+		{name: "Replaces id with spaces", incoming: "bad id", keep: false},
+		{name: "Replaces too long id", incoming: strings.Repeat("a", maxIDLength+1), keep: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(Header, tt.incoming)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if tt.keep {
+				assert.Equal(t, tt.incoming, got)
+			} else {
+				// Сгенерированный id — 32 hex-символа
+				assert.NotEqual(t, tt.incoming, got)
+				assert.Len(t, got, 32)
+			}
+			// Ответ возвращает тот же id, что видел обработчик
+			assert.Equal(t, got, rr.Header().Get(Header))
+		})
+	}
+}
+
+func TestID_OutsideRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Empty(t, ID(req.Context()))
+}
@@ -0,0 +1,76 @@
+package tokenstore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]time.Time // key -> expiry
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]time.Time{}, now: time.Now}
+}
+
+func (s *MemoryStore) Revoke(ctx context.Context, jti string, ttl time.Duration) error {
+	s.set(revokedTokenPrefix+jti, ttl)
+	return nil
+}
+
+func (s *MemoryStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return s.exists(revokedTokenPrefix + jti), nil
+}
+
+func (s *MemoryStore) RevokeFamily(ctx context.Context, family string, ttl time.Duration) error {
+	s.set(revokedFamilyPrefix+family, ttl)
+	return nil
+}
+
+func (s *MemoryStore) IsFamilyRevoked(ctx context.Context, family string) (bool, error) {
+	return s.exists(revokedFamilyPrefix + family), nil
+}
+
+func (s *MemoryStore) MarkUsed(ctx context.Context, jti string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+
+	key := usedRefreshPrefix + jti
+	if expiry, ok := s.entries[key]; ok && s.now().Before(expiry) {
+		return false, nil
+	}
+
+	s.entries[key] = s.now().Add(ttl)
+	return true, nil
+}
+
+func (s *MemoryStore) set(key string, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+	s.entries[key] = s.now().Add(ttl)
+}
+
+func (s *MemoryStore) exists(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiry, ok := s.entries[key]
+	return ok && s.now().Before(expiry)
+}
+
+// purge drops expired entries; callers must hold mu.
+func (s *MemoryStore) purge() {
+	now := s.now()
+	for key, expiry := range s.entries {
+		if !now.Before(expiry) {
+			delete(s.entries, key)
+		}
+	}
+}
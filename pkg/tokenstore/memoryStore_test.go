@@ -0,0 +1,61 @@
+package tokenstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_Revoke(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	revoked, err := store.IsRevoked(ctx, "jti-1")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	require.NoError(t, store.Revoke(ctx, "jti-1", time.Minute))
+
+	revoked, err = store.IsRevoked(ctx, "jti-1")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	familyRevoked, err := store.IsFamilyRevoked(ctx, "jti-1")
+	require.NoError(t, err)
+	assert.False(t, familyRevoked, "token and family namespaces must not collide")
+
+	now = now.Add(2 * time.Minute)
+
+	revoked, err = store.IsRevoked(ctx, "jti-1")
+	require.NoError(t, err)
+	assert.False(t, revoked, "revocation should expire with its ttl")
+}
+
+func TestMemoryStore_RevokeFamily(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	require.NoError(t, store.RevokeFamily(ctx, "fam", time.Hour))
+
+	revoked, err := store.IsFamilyRevoked(ctx, "fam")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestMemoryStore_MarkUsed(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	first, err := store.MarkUsed(ctx, "refresh-1", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, first)
+
+	second, err := store.MarkUsed(ctx, "refresh-1", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, second, "reused refresh token should be detected")
+}
@@ -0,0 +1,49 @@
+package tokenstore
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const (
+	revokedTokenPrefix  = "token:revoked:"
+	revokedFamilyPrefix = "token:family:revoked:"
+	usedRefreshPrefix   = "token:refresh:used:"
+)
+
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Revoke(ctx context.Context, jti string, ttl time.Duration) error {
+	return s.client.Set(ctx, revokedTokenPrefix+jti, 1, ttl).Err()
+}
+
+func (s *RedisStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return s.exists(ctx, revokedTokenPrefix+jti)
+}
+
+func (s *RedisStore) RevokeFamily(ctx context.Context, family string, ttl time.Duration) error {
+	return s.client.Set(ctx, revokedFamilyPrefix+family, 1, ttl).Err()
+}
+
+func (s *RedisStore) IsFamilyRevoked(ctx context.Context, family string) (bool, error) {
+	return s.exists(ctx, revokedFamilyPrefix+family)
+}
+
+func (s *RedisStore) MarkUsed(ctx context.Context, jti string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, usedRefreshPrefix+jti, 1, ttl).Result()
+}
+
+func (s *RedisStore) exists(ctx context.Context, key string) (bool, error) {
+	n, err := s.client.Exists(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
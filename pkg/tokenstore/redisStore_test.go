@@ -0,0 +1,69 @@
+package tokenstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStore_Revoke(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	store := NewRedisStore(client)
+	ctx := context.Background()
+
+	mock.ExpectSet("token:revoked:jti-1", 1, time.Minute).SetVal("OK")
+	mock.ExpectExists("token:revoked:jti-1").SetVal(1)
+	mock.ExpectExists("token:revoked:jti-2").SetVal(0)
+
+	require.NoError(t, store.Revoke(ctx, "jti-1", time.Minute))
+
+	revoked, err := store.IsRevoked(ctx, "jti-1")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = store.IsRevoked(ctx, "jti-2")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedisStore_RevokeFamily(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	store := NewRedisStore(client)
+	ctx := context.Background()
+
+	mock.ExpectSet("token:family:revoked:fam", 1, time.Hour).SetVal("OK")
+	mock.ExpectExists("token:family:revoked:fam").SetErr(errors.New("connection refused"))
+
+	require.NoError(t, store.RevokeFamily(ctx, "fam", time.Hour))
+
+	_, err := store.IsFamilyRevoked(ctx, "fam")
+	assert.Error(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedisStore_MarkUsed(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	store := NewRedisStore(client)
+	ctx := context.Background()
+
+	mock.ExpectSetNX("token:refresh:used:refresh-1", 1, time.Hour).SetVal(true)
+	mock.ExpectSetNX("token:refresh:used:refresh-1", 1, time.Hour).SetVal(false)
+
+	first, err := store.MarkUsed(ctx, "refresh-1", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, first)
+
+	second, err := store.MarkUsed(ctx, "refresh-1", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, second)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
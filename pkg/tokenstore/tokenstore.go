@@ -0,0 +1,34 @@
+package tokenstore
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Store keeps the token revocation list and the set of consumed refresh
+// tokens used for reuse detection.
+type Store interface {
+	// Revoke blacklists a single token id until ttl elapses.
+	Revoke(ctx context.Context, jti string, ttl time.Duration) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+
+	// RevokeFamily blacklists every token issued from one login.
+	RevokeFamily(ctx context.Context, family string, ttl time.Duration) error
+	IsFamilyRevoked(ctx context.Context, family string) (bool, error)
+
+	// MarkUsed records a refresh token as consumed. It returns false when
+	// the token had already been used, which means it was replayed.
+	MarkUsed(ctx context.Context, jti string, ttl time.Duration) (bool, error)
+}
+
+// New returns a Redis backed store, or an in-memory one when Redis does
+// not answer. The in-memory store is not shared between replicas.
+func New(ctx context.Context, client *redis.Client, log *zap.Logger) Store {
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Warn("Redis unavailable, using in-memory token store", zap.Error(err))
+		return NewMemoryStore()
+	}
+	return NewRedisStore(client)
+}
@@ -0,0 +1,156 @@
+// Package xlsx writes single-sheet XLSX workbooks row by row, so a sheet of
+// any size is streamed without being held in memory.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrClosed = errors.New("xlsx: writer is closed")
+
+// Cell is a single sheet cell; build one with String or Number.
+type Cell struct {
+	value   string
+	numeric bool
+}
+
+// String returns a text cell.
+func String(s string) Cell {
+	return Cell{value: s}
+}
+
+// Number returns a numeric cell. s must be a decimal number such as "-12.5";
+// it is written as is, so no precision is lost.
+func Number(s string) Cell {
+	return Cell{value: s, numeric: true}
+}
+
+// Empty returns a blank cell.
+func Empty() Cell {
+	return Cell{}
+}
+
+const (
+	contentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+
+	rootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	workbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+
+	sheetStart = xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	sheetEnd   = `</sheetData></worksheet>`
+)
+
+// Writer streams rows into the only sheet of a workbook. Close must be
+// called to complete the file.
+type Writer struct {
+	zip    *zip.Writer
+	sheet  io.Writer
+	row    int
+	closed bool
+}
+
+// NewWriter starts a workbook on w with a single sheet named sheetName.
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	z := zip.NewWriter(w)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="` + escape(sheetName) + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+	}
+	for _, part := range parts {
+		f, err := z.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, sheetStart); err != nil {
+		return nil, err
+	}
+
+	return &Writer{zip: z, sheet: sheet}, nil
+}
+
+// WriteRow appends a row to the sheet.
+func (w *Writer) WriteRow(cells ...Cell) error {
+	if w.closed {
+		return ErrClosed
+	}
+
+	w.row++
+	row := strconv.Itoa(w.row)
+
+	var buf strings.Builder
+	buf.WriteString(`<row r="` + row + `">`)
+	for i, cell := range cells {
+		if cell.value == "" {
+			continue
+		}
+
+		ref := columnName(i) + row
+		if cell.numeric {
+			buf.WriteString(`<c r="` + ref + `"><v>` + cell.value + `</v></c>`)
+			continue
+		}
+		buf.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">` + escape(cell.value) + `</t></is></c>`)
+	}
+	buf.WriteString(`</row>`)
+
+	_, err := io.WriteString(w.sheet, buf.String())
+	return err
+}
+
+// Close ends the sheet and writes the zip directory. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+
+	if _, err := io.WriteString(w.sheet, sheetEnd); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+// columnName turns a zero-based column index into its letters: 0 is A, 26 is AA.
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s)) // strings.Builder never fails
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, "Deals & profit")
+	require.NoError(t, err)
+	require.NoError(t, w.WriteRow(String("id"), String("title"), String("profit")))
+	require.NoError(t, w.WriteRow(Number("1"), String(`<Deal "A">`), Number("-12.5")))
+	require.NoError(t, w.WriteRow(Number("2"), Empty(), Number("0")))
+	require.NoError(t, w.Close())
+
+	assert.ErrorIs(t, w.WriteRow(String("late")), ErrClosed)
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	files := map[string]string{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+
+		// Каждая часть архива должна быть корректным XML
+		require.NoError(t, xml.Unmarshal(data, new(any)), f.Name)
+		files[f.Name] = string(data)
+	}
+
+	assert.Contains(t, files, "[Content_Types].xml")
+	assert.Contains(t, files["xl/workbook.xml"], `name="Deals &amp; profit"`)
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `<c r="B2" t="inlineStr"><is><t xml:space="preserve">&lt;Deal &#34;A&#34;&gt;</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="C2"><v>-12.5</v></c>`)
+	// Пустая ячейка пропускается, ссылки соседних не сдвигаются
+	assert.Contains(t, sheet, `<row r="3"><c r="A3"><v>2</v></c><c r="C3"><v>0</v></c></row>`)
+}
+
+func TestColumnName(t *testing.T) {
+	assert.Equal(t, "A", columnName(0))
+	assert.Equal(t, "Z", columnName(25))
+	assert.Equal(t, "AA", columnName(26))
+	assert.Equal(t, "AZ", columnName(51))
+	assert.Equal(t, "BA", columnName(52))
+}